@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/cache"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// CacheMaxAge is the time after which a mirror not used is removed from the cache
+	CacheMaxAge = "max-age"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manages the cache of git repositories mirrors",
+}
+
+// cachePruneCmd represents the cache prune command
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes the mirrors of the cache not used recently",
+	Run: func(cmd *cobra.Command, args []string) {
+		cacheDir, _ := cmd.Flags().GetString(CacheDir)
+		maxAge, _ := cmd.Flags().GetDuration(CacheMaxAge)
+		logLevel, _ := cmd.Flags().GetString(LogLevel)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
+
+		if err := log.SetLogLevel(logLevel); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		c, err := cache.New(cacheDir)
+		if err != nil {
+			log.Errorf("Error opening cache directory %s: %v", cacheDir, err)
+			os.Exit(1)
+		}
+
+		pruned, err := c.Prune(maxAge)
+		if err != nil {
+			log.Errorf("Error pruning cache directory %s: %v", cacheDir, err)
+			os.Exit(1)
+		}
+		log.Infof("Removed %d mirrors from cache directory %s", len(pruned), cacheDir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+
+	cachePruneCmd.Flags().String(CacheDir, "", "directory where the mirrors of the git repos are kept")
+	cachePruneCmd.Flags().Duration(CacheMaxAge, 7*24*time.Hour, "remove the mirrors not used during this time")
+	cachePruneCmd.Flags().String(LogLevel, "info", "set the loglevel to one of trace|debug|info|warn|error")
+	cachePruneCmd.Flags().String(LogFormat, "text", "set the format of the logs to one of text|json|logfmt")
+
+	_ = cachePruneCmd.MarkFlagRequired(CacheDir)
+}
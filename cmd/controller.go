@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/controller"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/watch"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// KubeAPIServer is the url of the Kubernetes API, the one of the cluster where the controller runs is used if empty
+	KubeAPIServer = "kube-api-server"
+	// KubeTokenFile is the location of the file with the bearer token of the Kubernetes API
+	KubeTokenFile = "kube-token-file"
+	// KubeCAFile is the location of a PEM bundle with the CAs of the Kubernetes API
+	KubeCAFile = "kube-ca-file"
+	// KubeInsecureSkipTLSVerify disables the TLS certificate verification of the Kubernetes API
+	KubeInsecureSkipTLSVerify = "kube-insecure-skip-tls-verify"
+	// ControllerNamespace is the namespace of the policies reconciled by the controller
+	ControllerNamespace = "namespace"
+	// ControllerResyncInterval is the time between the lists of the policies reconciled by the controller
+	ControllerResyncInterval = "resync-interval"
+	// ControllerInterval is the time between the polls of the versions of the policies without interval
+	ControllerInterval = "interval"
+	// ControllerAllowedRepoURLs are the git repositories the policies can update besides the one of git-repo-url
+	ControllerAllowedRepoURLs = "allowed-repo-urls"
+)
+
+// newKubeClient returns the client of the Kubernetes API configured with the flags of the command
+func newKubeClient(cmd *cobra.Command) (*controller.Client, error) {
+	server, _ := cmd.Flags().GetString(KubeAPIServer)
+	tokenFile, _ := cmd.Flags().GetString(KubeTokenFile)
+	caFile, _ := cmd.Flags().GetString(KubeCAFile)
+	insecureSkipTLSVerify, _ := cmd.Flags().GetBool(KubeInsecureSkipTLSVerify)
+
+	cfg := controller.ClientConfig{
+		Server:                server,
+		TokenFile:             tokenFile,
+		CAFile:                caFile,
+		InsecureSkipTLSVerify: insecureSkipTLSVerify,
+	}
+	if server == "" {
+		inCluster, err := controller.InClusterConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%v, use --%s", err, KubeAPIServer)
+		}
+		cfg.Server = inCluster.Server
+		if cfg.TokenFile == "" {
+			cfg.TokenFile = inCluster.TokenFile
+		}
+		if cfg.CAFile == "" {
+			cfg.CAFile = inCluster.CAFile
+		}
+	}
+	return controller.NewClient(cfg)
+}
+
+// controllerCmd represents the controller command
+var controllerCmd = &cobra.Command{
+	Use:   "controller",
+	Short: "Reconciles the ImageUpdatePolicy resources of a Kubernetes cluster, updating the values when a newer version is found",
+	Run: func(cmd *cobra.Command, args []string) {
+		logLevel, _ := cmd.Flags().GetString(LogLevel)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
+		namespace, _ := cmd.Flags().GetString(ControllerNamespace)
+		resyncInterval, _ := cmd.Flags().GetDuration(ControllerResyncInterval)
+		interval, _ := cmd.Flags().GetDuration(ControllerInterval)
+		allowedRepoURLs, _ := cmd.Flags().GetStringSlice(ControllerAllowedRepoURLs)
+
+		if err := log.SetLogLevel(logLevel); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		kube, err := newKubeClient(cmd)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		cfg, err := newHelmUpdaterConfig(cmd, log.WithContext())
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		shutdownTracing, err := setupTracing(cmd)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		defer shutdownTracing()
+
+		c := controller.New(controller.Config{
+			Base:            cfg,
+			AllowedRepoURLs: allowedRepoURLs,
+			Namespace:       namespace,
+			ResyncInterval:  resyncInterval,
+			Interval:        interval,
+		}, kube)
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		serveMetrics(ctx, cmd)
+
+		if namespace == "" {
+			log.Infof("Reconciling %s of every namespace", controller.Plural)
+		} else {
+			log.Infof("Reconciling %s of namespace %s", controller.Plural, namespace)
+		}
+		c.Run(ctx)
+		updater.CleanupWorkspaces()
+		closeNotifier(cfg)
+		log.Infof("Stopped reconciling %s", controller.Plural)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(controllerCmd)
+
+	addGitFlags(controllerCmd.Flags())
+	controllerCmd.Flags().String(KubeAPIServer, "", "url of the Kubernetes API (default the API of the cluster where the controller runs)")
+	controllerCmd.Flags().String(KubeTokenFile, "", "file with the bearer token of the Kubernetes API (default the token of the service account of the pod)")
+	controllerCmd.Flags().String(KubeCAFile, "", "PEM bundle with the CAs of the Kubernetes API (default the CA of the service account of the pod)")
+	controllerCmd.Flags().Bool(KubeInsecureSkipTLSVerify, false, "disable the TLS certificate verification of the Kubernetes API")
+	controllerCmd.Flags().String(ControllerNamespace, "", "namespace of the policies reconciled (default every namespace)")
+	controllerCmd.Flags().Duration(ControllerResyncInterval, controller.DefaultResyncInterval, "time between the lists of the policies")
+	controllerCmd.Flags().Duration(ControllerInterval, watch.DefaultInterval, "time between the polls of the versions of the policies without interval")
+	controllerCmd.Flags().StringSlice(ControllerAllowedRepoURLs, nil, "git repos the policies can update besides --git-repo-url, as the git credentials are sent to them")
+	addMetricsFlags(controllerCmd.Flags())
+	addTracingFlags(controllerCmd.Flags())
+
+	_ = controllerCmd.MarkFlagRequired(GitCommitUser)
+	_ = controllerCmd.MarkFlagRequired(GitCommitEmail)
+}
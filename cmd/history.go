@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// HistoryMaxCount is the maximum number of commits listed by the history command
+	HistoryMaxCount = "max-count"
+	// HistoryTrailer is a key=value trailer, or only a key, the commits listed must have
+	HistoryTrailer = "trailer"
+	// HistoryOutput is the format of the commits listed by the history command
+	HistoryOutput = "output"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Lists the commits with trailers of a local checkout of a git repo",
+	Run: func(cmd *cobra.Command, args []string) {
+		localRepo, _ := cmd.Flags().GetString(LocalRepo)
+		gitBranch, _ := cmd.Flags().GetString(GitBranch)
+		maxCount, _ := cmd.Flags().GetInt(HistoryMaxCount)
+		historyTrailers, _ := cmd.Flags().GetStringArray(HistoryTrailer)
+		output, _ := cmd.Flags().GetString(HistoryOutput)
+		logLevel, _ := cmd.Flags().GetString(LogLevel)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
+
+		if err := log.SetLogLevel(logLevel); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		var filters []git.Trailer
+		for _, historyTrailer := range historyTrailers {
+			if !strings.Contains(historyTrailer, "=") {
+				filters = append(filters, git.Trailer{Key: historyTrailer})
+				continue
+			}
+			filter, err := git.ParseTrailer(historyTrailer)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			filters = append(filters, filter)
+		}
+
+		entries, err := updater.ReadHistory(localRepo, gitBranch, maxCount, filters)
+		if err != nil {
+			log.Errorf("Error reading history of %s: %v", localRepo, err)
+			os.Exit(1)
+		}
+
+		switch output {
+		case "json":
+			if entries == nil {
+				entries = []updater.HistoryEntry{}
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err = encoder.Encode(entries); err != nil {
+				log.Errorf("Error writing history: %v", err)
+				os.Exit(1)
+			}
+		case "text":
+			for _, entry := range entries {
+				fmt.Printf("%s %s %s\n", entry.Hash[:7], entry.When.Format(time.RFC3339), entry.Subject)
+				for _, trailer := range entry.Trailers {
+					fmt.Printf("    %s\n", trailer)
+				}
+			}
+		default:
+			fmt.Printf("unknown output %s, it must be one of text|json\n", output)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().String(LocalRepo, ".", "location of the checkout of the git repo")
+	historyCmd.Flags().String(GitBranch, "", "branch, tag or commit where the history starts (default is HEAD)")
+	historyCmd.Flags().Int(HistoryMaxCount, 20, "maximum number of commits listed, 0 for no limit")
+	historyCmd.Flags().StringArray(HistoryTrailer, nil, "list only the commits with this key=value trailer, or with any value if only the key is given, can be repeated")
+	historyCmd.Flags().String(HistoryOutput, "text", "format of the commits listed, one of text|json")
+	historyCmd.Flags().String(LogLevel, "info", "set the loglevel to one of trace|debug|info|warn|error")
+	historyCmd.Flags().String(LogFormat, "text", "set the format of the logs to one of text|json|logfmt")
+}
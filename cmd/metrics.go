@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	// MetricsAddress is the address where the Prometheus metrics are served, they are not served if empty
+	MetricsAddress = "metrics-address"
+	// MetricsPushgatewayURL is the url of a Pushgateway compatible endpoint where the metrics are pushed before exiting
+	MetricsPushgatewayURL = "metrics-pushgateway-url"
+	// MetricsJob is the job of the metrics pushed to the Pushgateway
+	MetricsJob = "metrics-job"
+	// metricsPushTimeout is the maximum duration of the push of the metrics to the Pushgateway
+	metricsPushTimeout = 30 * time.Second
+)
+
+// addMetricsFlags adds the flags of the metrics served by the long-running commands
+func addMetricsFlags(flags *pflag.FlagSet) {
+	flags.String(MetricsAddress, "", "address where the Prometheus metrics are served on /metrics, eg. :9090 (default the metrics are not served)")
+}
+
+// addMetricsPushFlags adds the flags of the metrics pushed by the one-shot commands
+func addMetricsPushFlags(flags *pflag.FlagSet) {
+	flags.String(MetricsPushgatewayURL, "", "url of a Pushgateway compatible endpoint where the metrics are pushed before exiting (default the metrics are not pushed)")
+	flags.String(MetricsJob, "helm-repo-updater", "job of the metrics pushed to the Pushgateway")
+}
+
+// serveMetrics serves the metrics on the address of the flags until ctx is done
+func serveMetrics(ctx context.Context, cmd *cobra.Command) {
+	address, _ := cmd.Flags().GetString(MetricsAddress)
+	if address == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	httpServer := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		log.Infof("Serving metrics on %s", address)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Error serving metrics on %s: %v", address, err)
+		}
+	}()
+}
+
+// pushMetrics pushes the metrics to the Pushgateway of the flags, replacing the metrics of the job,
+// so the metrics of the one-shot runs are kept after they exit. The errors are logged so they don't
+// change the result of the execution
+func pushMetrics(cmd *cobra.Command) {
+	pushgatewayURL, _ := cmd.Flags().GetString(MetricsPushgatewayURL)
+	job, _ := cmd.Flags().GetString(MetricsJob)
+	if pushgatewayURL == "" {
+		return
+	}
+	pusher := push.New(pushgatewayURL, job).Gatherer(prometheus.DefaultGatherer).Client(&http.Client{Timeout: metricsPushTimeout})
+	if err := pusher.Push(); err != nil {
+		log.Errorf("could not push metrics to %s: %v", pushgatewayURL, err)
+	}
+}
@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path"
+	"syscall"
 	"text/template"
 
 	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/lock"
 	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/notify"
 	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const (
@@ -17,45 +25,261 @@ const (
 	GitCommitUser = "git-commit-user"
 	// GitCommitEmail is the email used for commit changes
 	GitCommitEmail = "git-commit-email"
+	// GitAuthorName is the name of the author of the commit, when different from the committer
+	GitAuthorName = "git-author-name"
+	// GitAuthorEmail is the email of the author of the commit, when different from the committer
+	GitAuthorEmail = "git-author-email"
+	// GitAuthorFromEnv indicates that the author of the commit is the user who triggered the CI pipeline
+	GitAuthorFromEnv = "git-author-from-env"
+	// GitCommitDate is the date of the commit, to make it reproducible
+	GitCommitDate = "git-commit-date"
 	// GitPassword is the git password used for auth
 	GitPassword = "git-password"
+	// GitPasswordFile is the location of a file with the git password used for auth
+	GitPasswordFile = "git-password-file"
+	// GitPasswordFromEnv is the name of the environment variable with the git password used for auth
+	GitPasswordFromEnv = "git-password-from-env"
+	// GitPasswordStdin indicates that the git password used for auth is going to be read from stdin
+	GitPasswordStdin = "git-password-stdin"
+	// GitCredentialHelper is the git credential helper used to obtain HTTPS credentials
+	GitCredentialHelper = "git-credential-helper"
+	// GitUseNetrc indicates if the HTTPS credentials are going to be read from the .netrc file
+	GitUseNetrc = "git-use-netrc"
+	// GitNetrcFile is the location of the .netrc file
+	GitNetrcFile = "git-netrc-file"
 	// GitBranch is the branch of the git repository
 	GitBranch = "git-branch"
+	// GitCreateBranch indicates if the branch is going to be created when it doesn't exist in the git repository
+	GitCreateBranch = "git-create-branch"
+	// GitBaseRef is the branch, tag or commit SHA used to create the branch
+	GitBaseRef = "git-base-ref"
 	// GitRepoURL is the git repository url
 	GitRepoURL = "git-repo-url"
+	// GitShallowClone indicates if only the latest commit of the branch is going to be cloned
+	GitShallowClone = "git-shallow-clone"
+	// GitSparsePaths are the paths of the repository that are going to be checked out
+	GitSparsePaths = "git-sparse-paths"
+	// GitInMemory indicates if the git repository is going to be cloned in memory instead of in disk
+	GitInMemory = "git-in-memory"
+	// CacheDir is the directory where the mirrors of the git repositories are kept between runs
+	CacheDir = "cache-dir"
+	// LocalRepo is the location of an existing checkout of the git repository used instead of cloning it
+	LocalRepo = "local-repo"
+	// GitPushBranch is the branch where the changes are pushed
+	GitPushBranch = "git-push-branch"
+	// GitPushRepoURL is the git repository url where the changes are pushed
+	GitPushRepoURL = "git-push-repo-url"
+	// GitSkipPush indicates if the commit with the changes is not going to be pushed
+	GitSkipPush = "git-skip-push"
 	// GitFile is the file that is going to be changed
 	GitFile = "git-file"
 	// GitDir is the directory where the file to be changed is located
 	GitDir = "git-dir"
+	// CAFile is the location of a PEM bundle with additional CAs for the git server TLS connections
+	CAFile = "ca-file"
+	// InsecureSkipTLSVerify disables the TLS certificate verification of the git server
+	InsecureSkipTLSVerify = "insecure-skip-tls-verify"
+	// ClientCertFile is the location of the client certificate used for mTLS with the git server
+	ClientCertFile = "client-cert-file"
+	// ClientKeyFile is the location of the client key used for mTLS with the git server
+	ClientKeyFile = "client-key-file"
 	// AppName is the name of the helm application
 	AppName = "app-name"
 	// SSHPrivateKey is the location of the SSH private key used for auth
 	SSHPrivateKey = "ssh-private-key"
+	// SSHPrivateKeyFile is the location of the SSH private key used for auth
+	SSHPrivateKeyFile = "ssh-private-key-file"
+	// SSHPrivateKeyFromEnv is the name of the environment variable with the content of the SSH private key used for auth
+	SSHPrivateKeyFromEnv = "ssh-private-key-from-env"
+	// SSHPrivateKeyStdin indicates that the content of the SSH private key used for auth is going to be read from stdin
+	SSHPrivateKeyStdin = "ssh-private-key-stdin"
 	// UseSSHPrivateKeyAsInline indicates if the SSHPrivateKey is going to be created based in a string provided
 	UseSSHPrivateKeyAsInline = "use-ssh-private-key-as-inline"
 	// DryRun is going to indicate if the changes are going to be committed or not
 	DryRun = "dry-run"
 	// LogLevel will indicate the log level
 	LogLevel = "logLevel"
+	// LogFormat is the format of the logs, text for humans, or json and logfmt for log pipelines
+	LogFormat = "log-format"
 	// HelmKeyValues will be used for indicate the key and values to be changed in helm
 	HelmKeyValues = "helm-key-values"
 	// AllowErrorNothingToUpdate represents that is allowed the error nothing to update
 	AllowErrorNothingToUpdate = "allow-nothing-to-update"
-	// AllowErrorNothingToUpdateMessage represents the allowed error that will be the exception for make an os.Exit(1) call when is detected
-	AllowErrorNothingToUpdateMessage = "nothing to update, skipping commit"
+	// Timeout is the maximum duration of the whole execution
+	Timeout = "timeout"
+	// GitCloneTimeout is the maximum duration of the clone of the git repository
+	GitCloneTimeout = "git-clone-timeout"
+	// GitFetchTimeout is the maximum duration of the fetch of the latest changes of the git repository
+	GitFetchTimeout = "git-fetch-timeout"
+	// GitPullTimeout is the maximum duration of the pull of the latest changes of the git branch
+	GitPullTimeout = "git-pull-timeout"
+	// GitPushTimeout is the maximum duration of the push of the changes to the git repository
+	GitPushTimeout = "git-push-timeout"
+	// LockBackend is the backend used to coordinate the updates of the git repository with other processes
+	LockBackend = "lock-backend"
+	// LockDir is the directory where the lock files are stored by the file lock backend
+	LockDir = "lock-dir"
+	// LockRef is the reference of the git repository used as lock by the git-ref lock backend
+	LockRef = "lock-ref"
+	// LockTTL is the time after which a lock of the git-ref lock backend not released is considered abandoned
+	LockTTL = "lock-ttl"
+	// NotificationsConfig is the YAML file configuring the notifiers of the changes pushed
+	NotificationsConfig = "notifications-config"
+	// CommitTrailer is a key=value trailer added to the commit message, it can be repeated
+	CommitTrailer = "commit-trailer"
+	// TagTemplate is the template of the name of the tag created on the commit with the changes
+	TagTemplate = "tag-template"
+	// TagAnnotated indicates if the tag is annotated with the commit message
+	TagAnnotated = "tag-annotated"
+	// TagSignKeyFile is the location of the armored OpenPGP private key used to sign the tag
+	TagSignKeyFile = "tag-sign-key-file"
+	// TagPassphraseFromEnv is the name of the environment variable with the passphrase of the tag sign key
+	TagPassphraseFromEnv = "tag-passphrase-from-env"
+	// KeepWorkspace indicates if the temporal directory where the git repository is cloned is kept after the execution
+	KeepWorkspace = "keep-workspace"
+	// notificationsQueueSize is the maximum number of notifications waiting to be sent
+	notificationsQueueSize = 100
 )
 
 var cfg = updater.HelmUpdaterConfig{}
 
+// installGitTransport installs the transport of the HTTP(S) git repositories configured with the flags of the
+// command. go-git keeps the transports in a global registry, so it's installed once before any update
+func installGitTransport(cmd *cobra.Command) error {
+	caFile, _ := cmd.Flags().GetString(CAFile)
+	insecureSkipTLSVerify, _ := cmd.Flags().GetBool(InsecureSkipTLSVerify)
+	clientCertFile, _ := cmd.Flags().GetString(ClientCertFile)
+	clientKeyFile, _ := cmd.Flags().GetString(ClientKeyFile)
+	return git.TransportConf{
+		CAFile:                caFile,
+		InsecureSkipTLSVerify: insecureSkipTLSVerify,
+		ClientCertFile:        clientCertFile,
+		ClientKeyFile:         clientKeyFile,
+	}.Install()
+}
+
+// newLockBackend returns the lock backend configured with the flags of the command
+func newLockBackend(cmd *cobra.Command) (lock.Backend, error) {
+	backend, _ := cmd.Flags().GetString(LockBackend)
+	switch backend {
+	case "", "none":
+		return nil, nil
+	case "file":
+		lockDir, _ := cmd.Flags().GetString(LockDir)
+		if lockDir == "" {
+			lockDir = path.Join(os.TempDir(), "helm-repo-updater-locks")
+		}
+		return lock.NewFileBackend(lockDir)
+	case "git-ref":
+		lockRef, _ := cmd.Flags().GetString(LockRef)
+		lockTTL, _ := cmd.Flags().GetDuration(LockTTL)
+		return lock.NewGitRefBackend(lockRef, lockTTL)
+	}
+	return nil, fmt.Errorf("unknown lock backend %s, it must be one of none|file|git-ref", backend)
+}
+
+// newNotifier returns the notifier of the changes pushed configured with the flags of the command, which is nil
+// if there are no notifications
+func newNotifier(cmd *cobra.Command) (notify.Notifier, error) {
+	notificationsConfig, _ := cmd.Flags().GetString(NotificationsConfig)
+	if notificationsConfig == "" {
+		return nil, nil
+	}
+	dispatcher, err := notify.LoadConfig(notificationsConfig)
+	if err != nil {
+		return nil, err
+	}
+	// the notifications are sent in the background, so the updates don't wait for the notifiers
+	return notify.NewQueue(dispatcher, notificationsQueueSize), nil
+}
+
+// closeNotifier waits for the notifications of the configuration queued to be sent, up to the shutdown timeout
+func closeNotifier(cfg updater.HelmUpdaterConfig) {
+	queue, ok := cfg.Notifier.(*notify.Queue)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := queue.Close(ctx); err != nil {
+		log.Errorf("could not close notifications: %v", err)
+	}
+}
+
+// newTagConf returns the configuration of the tag created on the commit with the changes
+func newTagConf(cmd *cobra.Command) (git.TagConf, error) {
+	tagTemplate, _ := cmd.Flags().GetString(TagTemplate)
+	tagAnnotated, _ := cmd.Flags().GetBool(TagAnnotated)
+	tagSignKeyFile, _ := cmd.Flags().GetString(TagSignKeyFile)
+	tagPassphraseFromEnv, _ := cmd.Flags().GetString(TagPassphraseFromEnv)
+
+	if tagTemplate == "" {
+		if tagAnnotated || tagSignKeyFile != "" {
+			return git.TagConf{}, fmt.Errorf("--%s is required to create a tag", TagTemplate)
+		}
+		return git.TagConf{}, nil
+	}
+
+	tpl, err := template.New("tagName").Parse(tagTemplate)
+	if err != nil {
+		return git.TagConf{}, fmt.Errorf("could not parse tag name template: %v", err)
+	}
+	tagConf := git.TagConf{
+		NameTemplate: tpl,
+		Annotated:    tagAnnotated,
+	}
+
+	if tagSignKeyFile != "" {
+		passphrase, err := utils.SecretSource{
+			Name:   "tag sign key passphrase",
+			EnvVar: tagPassphraseFromEnv,
+		}.Resolve(os.Stdin)
+		if err != nil {
+			return git.TagConf{}, err
+		}
+		log.AddSecret(passphrase)
+		if tagConf.SignKey, err = git.LoadSignKey(tagSignKeyFile, passphrase); err != nil {
+			return git.TagConf{}, err
+		}
+	}
+
+	return tagConf, nil
+}
+
+// newCommitAuthor returns the author of the commit configured with the flags of the command,
+// an empty identity means that the committer is the author
+func newCommitAuthor(cmd *cobra.Command, logCtx *log.Context) (git.Identity, error) {
+	authorName, _ := cmd.Flags().GetString(GitAuthorName)
+	authorEmail, _ := cmd.Flags().GetString(GitAuthorEmail)
+	authorFromEnv, _ := cmd.Flags().GetBool(GitAuthorFromEnv)
+
+	author := git.Identity{Name: authorName, Email: authorEmail}
+	if (author.Name == "") != (author.Email == "") {
+		return git.Identity{}, fmt.Errorf("both --%s and --%s must be provided", GitAuthorName, GitAuthorEmail)
+	}
+	if !authorFromEnv {
+		return author, nil
+	}
+	if !author.IsZero() {
+		return git.Identity{}, fmt.Errorf("only one of --%s and --%s can be used", GitAuthorName, GitAuthorFromEnv)
+	}
+
+	author, found := git.AuthorFromEnv(os.Getenv)
+	if !found {
+		logCtx.Warnf("Could not find the user who triggered the pipeline in the environment, the committer is the author")
+	}
+	return author, nil
+}
+
 // runImageUpdater checks and apply the necessary update in the helm application
-func runImageUpdater(cfg updater.HelmUpdaterConfig) error {
+func runImageUpdater(ctx context.Context, cfg updater.HelmUpdaterConfig) error {
 
 	syncState := updater.NewSyncIterationState()
 
 	err := func(cfg updater.HelmUpdaterConfig) error {
 		log.Debugf("Processing application %s in directory %s", cfg.AppName, cfg.File)
 
-		_, err := updater.UpdateApplication(cfg, syncState)
+		_, err := updater.UpdateApplication(ctx, cfg, syncState)
 		if err != nil {
 			return err
 		}
@@ -69,16 +293,186 @@ func runImageUpdater(cfg updater.HelmUpdaterConfig) error {
 	return nil
 }
 
-// checkExecutionRunImageUpdater represents the check of the execution of the runImageUpdater command
-func checkExecutionRunImageUpdater(cfg updater.HelmUpdaterConfig, logCtx *log.Context, appName string) {
-	if err := runImageUpdater(cfg); err != nil {
-		if err.Error() != AllowErrorNothingToUpdateMessage || !cfg.AllowErrorNothingToUpdate {
+// checkExecutionRunImageUpdater represents the check of the execution of the runImageUpdater command,
+// returning false when the execution has failed
+func checkExecutionRunImageUpdater(ctx context.Context, cfg updater.HelmUpdaterConfig, logCtx *log.Context, appName string) bool {
+	if err := runImageUpdater(ctx, cfg); err != nil {
+		if !errors.Is(err, updater.ErrNothingToUpdate) || !cfg.AllowErrorNothingToUpdate {
 			logCtx.Errorf("Error trying to update the %s application: %v", appName, err)
-			os.Exit(1)
+			return false
 		}
 		logCtx.Infof("%s", err.Error())
-		return
 	}
+	return true
+}
+
+// newHelmUpdaterConfig returns the configuration shared by all the updates, built with the git flags
+// of the command. The application, the file and the changes to be made are not set
+func newHelmUpdaterConfig(cmd *cobra.Command, logCtx *log.Context) (updater.HelmUpdaterConfig, error) {
+	gitUser, _ := cmd.Flags().GetString(GitCommitUser)
+	gitEmail, _ := cmd.Flags().GetString(GitCommitEmail)
+	gitCommitDate, _ := cmd.Flags().GetString(GitCommitDate)
+	gitPass, _ := cmd.Flags().GetString(GitPassword)
+	gitPassFile, _ := cmd.Flags().GetString(GitPasswordFile)
+	gitPassFromEnv, _ := cmd.Flags().GetString(GitPasswordFromEnv)
+	gitPassStdin, _ := cmd.Flags().GetBool(GitPasswordStdin)
+	gitCredentialHelper, _ := cmd.Flags().GetString(GitCredentialHelper)
+	gitUseNetrc, _ := cmd.Flags().GetBool(GitUseNetrc)
+	gitNetrcFile, _ := cmd.Flags().GetString(GitNetrcFile)
+	gitBranch, _ := cmd.Flags().GetString(GitBranch)
+	gitCreateBranch, _ := cmd.Flags().GetBool(GitCreateBranch)
+	gitBaseRef, _ := cmd.Flags().GetString(GitBaseRef)
+	gitRepoURL, _ := cmd.Flags().GetString(GitRepoURL)
+	gitShallowClone, _ := cmd.Flags().GetBool(GitShallowClone)
+	gitSparsePaths, _ := cmd.Flags().GetStringSlice(GitSparsePaths)
+	gitInMemory, _ := cmd.Flags().GetBool(GitInMemory)
+	cacheDir, _ := cmd.Flags().GetString(CacheDir)
+	localRepo, _ := cmd.Flags().GetString(LocalRepo)
+	gitPushBranch, _ := cmd.Flags().GetString(GitPushBranch)
+	gitPushRepoURL, _ := cmd.Flags().GetString(GitPushRepoURL)
+	gitSkipPush, _ := cmd.Flags().GetBool(GitSkipPush)
+	sshKey, _ := cmd.Flags().GetString(SSHPrivateKey)
+	sshKeyFile, _ := cmd.Flags().GetString(SSHPrivateKeyFile)
+	sshKeyFromEnv, _ := cmd.Flags().GetString(SSHPrivateKeyFromEnv)
+	sshKeyStdin, _ := cmd.Flags().GetBool(SSHPrivateKeyStdin)
+	logLevel, _ := cmd.Flags().GetString(LogLevel)
+	dryRun, _ := cmd.Flags().GetBool(DryRun)
+	useSSHPrivateKeyAsInline, _ := cmd.Flags().GetBool(UseSSHPrivateKeyAsInline)
+	keepWorkspace, _ := cmd.Flags().GetBool(KeepWorkspace)
+	commitTrailers, _ := cmd.Flags().GetStringArray(CommitTrailer)
+	gitCloneTimeout, _ := cmd.Flags().GetDuration(GitCloneTimeout)
+	gitFetchTimeout, _ := cmd.Flags().GetDuration(GitFetchTimeout)
+	gitPullTimeout, _ := cmd.Flags().GetDuration(GitPullTimeout)
+	gitPushTimeout, _ := cmd.Flags().GetDuration(GitPushTimeout)
+
+	var tpl *template.Template
+	var err error
+
+	if gitPassStdin && sshKeyStdin {
+		return updater.HelmUpdaterConfig{}, fmt.Errorf("only one of --%s and --%s can be used", GitPasswordStdin, SSHPrivateKeyStdin)
+	}
+
+	if err := installGitTransport(cmd); err != nil {
+		return updater.HelmUpdaterConfig{}, fmt.Errorf("could not configure git transport: %v", err)
+	}
+
+	lockBackend, err := newLockBackend(cmd)
+	if err != nil {
+		return updater.HelmUpdaterConfig{}, err
+	}
+
+	notifier, err := newNotifier(cmd)
+	if err != nil {
+		return updater.HelmUpdaterConfig{}, err
+	}
+
+	tagConf, err := newTagConf(cmd)
+	if err != nil {
+		return updater.HelmUpdaterConfig{}, err
+	}
+
+	var trailers []git.Trailer
+	for _, commitTrailer := range commitTrailers {
+		trailer, err := git.ParseTrailer(commitTrailer)
+		if err != nil {
+			return updater.HelmUpdaterConfig{}, err
+		}
+		trailers = append(trailers, trailer)
+	}
+
+	gitPass, err = utils.SecretSource{
+		Name:   "git password",
+		Value:  gitPass,
+		File:   gitPassFile,
+		EnvVar: gitPassFromEnv,
+		Stdin:  gitPassStdin,
+	}.Resolve(os.Stdin)
+	if err != nil {
+		return updater.HelmUpdaterConfig{}, err
+	}
+
+	if sshKeyFile != "" {
+		if sshKey != "" {
+			return updater.HelmUpdaterConfig{}, fmt.Errorf("only one of --%s and --%s can be used", SSHPrivateKey, SSHPrivateKeyFile)
+		}
+		sshKey = sshKeyFile
+		useSSHPrivateKeyAsInline = false
+	} else if sshKeyFromEnv != "" || sshKeyStdin {
+		sshKey, err = utils.SecretSource{
+			Name:   "ssh private key",
+			Value:  sshKey,
+			EnvVar: sshKeyFromEnv,
+			Stdin:  sshKeyStdin,
+		}.Resolve(os.Stdin)
+		if err != nil {
+			return updater.HelmUpdaterConfig{}, err
+		}
+		useSSHPrivateKeyAsInline = true
+	}
+
+	log.AddSecret(gitPass)
+	if useSSHPrivateKeyAsInline {
+		log.AddSecret(sshKey)
+	}
+
+	gitCredentials := &git.Credentials{
+		Username:             gitUser,
+		Email:                gitEmail,
+		Password:             gitPass,
+		SSHPrivKey:           sshKey,
+		SSHPrivKeyFileInline: useSSHPrivateKeyAsInline,
+		CredentialHelper:     gitCredentialHelper,
+		UseNetrc:             gitUseNetrc,
+		NetrcFile:            gitNetrcFile,
+	}
+
+	gitConf := &git.Conf{
+		RepoURL:      gitRepoURL,
+		Branch:       gitBranch,
+		CreateBranch: gitCreateBranch,
+		BaseRef:      gitBaseRef,
+		ShallowClone: gitShallowClone,
+		SparsePaths:  gitSparsePaths,
+		InMemory:     gitInMemory,
+		CacheDir:     cacheDir,
+		LocalRepo:    localRepo,
+		PushBranch:   gitPushBranch,
+		PushRepoURL:  gitPushRepoURL,
+		SkipPush:     gitSkipPush,
+		Trailers:     trailers,
+		Tag:          tagConf,
+		Timeouts: git.Timeouts{
+			Clone: gitCloneTimeout,
+			Fetch: gitFetchTimeout,
+			Pull:  gitPullTimeout,
+			Push:  gitPushTimeout,
+		},
+	}
+
+	if gitConf.Author, err = newCommitAuthor(cmd, logCtx); err != nil {
+		return updater.HelmUpdaterConfig{}, err
+	}
+	if gitCommitDate != "" {
+		if gitConf.CommitDate, err = git.ParseCommitDate(gitCommitDate); err != nil {
+			return updater.HelmUpdaterConfig{}, err
+		}
+	}
+
+	if tpl, err = template.New("commitMessage").Parse(git.DefaultGitCommitMessage); err != nil {
+		return updater.HelmUpdaterConfig{}, fmt.Errorf("could not parse commit message template: %v", err)
+	}
+	logCtx.Debugf("Successfully parsed commit message template")
+	gitConf.Message = tpl
+
+	return updater.HelmUpdaterConfig{
+		DryRun:         dryRun,
+		LogLevel:       logLevel,
+		GitCredentials: gitCredentials,
+		GitConf:        gitConf,
+		KeepWorkspace:  keepWorkspace,
+		LockBackend:    lockBackend,
+		Notifier:       notifier,
+	}, nil
 }
 
 // runCmd represents the run command
@@ -86,26 +480,25 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Runs the helm repo updater",
 	Run: func(cmd *cobra.Command, args []string) {
-		gitUser, _ := cmd.Flags().GetString(GitCommitUser)
-		gitEmail, _ := cmd.Flags().GetString(GitCommitEmail)
-		gitPass, _ := cmd.Flags().GetString(GitPassword)
-		gitBranch, _ := cmd.Flags().GetString(GitBranch)
-		gitRepoURL, _ := cmd.Flags().GetString(GitRepoURL)
 		gitFile, _ := cmd.Flags().GetString(GitFile)
 		gitDir, _ := cmd.Flags().GetString(GitDir)
-		sshKey, _ := cmd.Flags().GetString(SSHPrivateKey)
 		appName, _ := cmd.Flags().GetString(AppName)
 		logLevel, _ := cmd.Flags().GetString(LogLevel)
-		dryRun, _ := cmd.Flags().GetBool(DryRun)
-		useSSHPrivateKeyAsInline, _ := cmd.Flags().GetBool(UseSSHPrivateKeyAsInline)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
 		helmKVs, _ := cmd.Flags().GetStringToString(HelmKeyValues)
 		allowErrorNothingToUpdate, _ := cmd.Flags().GetBool(AllowErrorNothingToUpdate)
+		timeout, _ := cmd.Flags().GetDuration(Timeout)
 
 		if err := log.SetLogLevel(logLevel); err != nil {
 			fmt.Println(err)
 
 			os.Exit(1)
 		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
 
 		if len(helmKVs) == 0 {
 			if err := cmd.Help(); err != nil {
@@ -115,9 +508,18 @@ var runCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var updateApps []updater.ChangeEntry
-		var tpl *template.Template
+		// the logs of the run are correlated by its run id
+		ctx := log.ContextWithRunID(cmd.Context(), log.NewRunID())
+		logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
 		var err error
+		if cfg, err = newHelmUpdaterConfig(cmd, logCtx); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		var updateApps []updater.ChangeEntry
 		for k, v := range helmKVs {
 			updateApps = append(updateApps, updater.ChangeEntry{
 				Key:      k,
@@ -125,61 +527,108 @@ var runCmd = &cobra.Command{
 			})
 		}
 
-		gitCredentials := &git.Credentials{
-			Username:             gitUser,
-			Email:                gitEmail,
-			Password:             gitPass,
-			SSHPrivKey:           sshKey,
-			SSHPrivKeyFileInline: useSSHPrivateKeyAsInline,
-		}
+		cfg.AppName = appName
+		cfg.UpdateApps = updateApps
+		cfg.File = path.Join(gitDir, appName, gitFile)
+		cfg.AllowErrorNothingToUpdate = allowErrorNothingToUpdate
 
-		gitConf := &git.Conf{
-			RepoURL: gitRepoURL,
-			Branch:  gitBranch,
-		}
+		shutdownTracing, err := setupTracing(cmd)
+		if err != nil {
+			fmt.Println(err)
 
-		logCtx := log.WithContext().AddField("application", appName)
+			os.Exit(1)
+		}
+		defer shutdownTracing()
 
-		if tpl, err = template.New("commitMessage").Parse(git.DefaultGitCommitMessage); err != nil {
-			logCtx.Fatalf("could not parse commit message template: %v", err)
+		// the update is cancelled when the process is interrupted, cleaning up its workspace
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-			return
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
 		}
-		logCtx.Debugf("Successfully parsed commit message template")
-		gitConf.Message = tpl
 
-		cfg = updater.HelmUpdaterConfig{
-			DryRun:                    dryRun,
-			LogLevel:                  logLevel,
-			AppName:                   appName,
-			UpdateApps:                updateApps,
-			File:                      path.Join(gitDir, appName, gitFile),
-			GitCredentials:            gitCredentials,
-			GitConf:                   gitConf,
-			AllowErrorNothingToUpdate: allowErrorNothingToUpdate,
+		succeeded := checkExecutionRunImageUpdater(ctx, cfg, logCtx, appName)
+		updater.CleanupWorkspaces()
+		closeNotifier(cfg)
+		pushMetrics(cmd)
+		if !succeeded {
+			shutdownTracing()
+			os.Exit(1)
 		}
-
-		checkExecutionRunImageUpdater(cfg, logCtx, appName)
 	},
 }
 
+// addGitFlags adds the flags needed to build the configuration shared by all the updates
+func addGitFlags(flags *pflag.FlagSet) {
+	flags.String(GitCommitUser, "", "Username to use for Git commits")
+	flags.String(GitCommitEmail, "", "e-mail address to use for Git commits")
+	flags.String(GitAuthorName, "", "name of the author of the commit when it's not the committer, eg. the user who triggered the pipeline")
+	flags.String(GitAuthorEmail, "", "e-mail address of the author of the commit when it's not the committer")
+	flags.Bool(GitAuthorFromEnv, false, "use as author of the commit the user who triggered the CI pipeline, read from the GIT_AUTHOR_*, GitLab CI, GitHub Actions or Jenkins environment variables")
+	flags.String(GitCommitDate, "", "date of the commit as RFC3339 or unix timestamp prefixed by @, eg. @$SOURCE_DATE_EPOCH (default is the current time)")
+	flags.String(GitPassword, "", "Password for github user")
+	flags.String(GitPasswordFile, "", "file with the password for github user")
+	flags.String(GitPasswordFromEnv, "", "name of the environment variable with the password for github user")
+	flags.Bool(GitPasswordStdin, false, "read the password for github user from stdin")
+	flags.String(GitCredentialHelper, "", "git credential helper used to obtain HTTPS credentials when no password is provided, eg. store or !my-helper")
+	flags.Bool(GitUseNetrc, false, "obtain HTTPS credentials from the .netrc file when no password is provided")
+	flags.String(GitNetrcFile, "", "location of the .netrc file (default is $NETRC or $HOME/.netrc)")
+	flags.String(GitBranch, "develop", "git repo branch")
+	flags.Bool(GitCreateBranch, false, "create the git repo branch from the base ref when it doesn't exist")
+	flags.String(GitBaseRef, "", "branch, tag or commit SHA used to create the git repo branch (default is the default branch)")
+	flags.String(GitRepoURL, "", "git repo url")
+	flags.Bool(GitShallowClone, false, "clone only the latest commit of the git repo branch")
+	flags.StringSlice(GitSparsePaths, nil, "paths of the git repo to check out, the rest of files are not written to disk eg. production/charts/")
+	flags.Bool(GitInMemory, false, "clone the git repo in memory without writing it to disk, recommended only for small repositories")
+	flags.String(CacheDir, "", "directory where a mirror of the git repo is kept between runs, so only the latest changes are fetched")
+	flags.String(LocalRepo, "", "location of an existing clean checkout of the git repo used instead of cloning it")
+	flags.String(GitPushBranch, "", "branch where the changes are pushed, overwriting it if nobody else updated it meanwhile (default is the git repo branch)")
+	flags.String(GitPushRepoURL, "", "git repo url where the changes are pushed, eg. a fork (default is the git repo url)")
+	flags.Bool(GitSkipPush, false, "commit the changes without pushing them to the git repo")
+	flags.String(GitDir, "", "file eg. /production/charts/")
+	flags.String(CAFile, "", "PEM bundle with additional CAs trusted for the TLS connections with the git server")
+	flags.Bool(InsecureSkipTLSVerify, false, "skip the TLS certificate verification of the git server")
+	flags.String(ClientCertFile, "", "PEM client certificate used for mTLS with the git server")
+	flags.String(ClientKeyFile, "", "PEM client key used for mTLS with the git server")
+	flags.String(SSHPrivateKey, "", "ssh private key")
+	flags.String(SSHPrivateKeyFile, "", "file with the ssh private key")
+	flags.String(SSHPrivateKeyFromEnv, "", "name of the environment variable with the content of the ssh private key")
+	flags.Bool(SSHPrivateKeyStdin, false, "read the content of the ssh private key from stdin")
+	flags.Bool(UseSSHPrivateKeyAsInline, false, "ssh private key inline creation, if true it will use ssh-private-key as input for create ssh private key file in temporal directory")
+	flags.Bool(DryRun, false, "run in dry-run mode. If set to true, do not perform any changes")
+	flags.String(LogLevel, "info", "set the loglevel to one of trace|debug|info|warn|error")
+	flags.String(LogFormat, "text", "set the format of the logs to one of text|json|logfmt")
+	flags.Duration(GitCloneTimeout, 0, "maximum duration of the clone of the git repo (default no limit)")
+	flags.Duration(GitFetchTimeout, 0, "maximum duration of the fetch of the git repo latest changes (default no limit)")
+	flags.Duration(GitPullTimeout, 0, "maximum duration of the pull of the git repo branch latest changes (default no limit)")
+	flags.Duration(GitPushTimeout, 0, "maximum duration of the push of the changes to the git repo (default no limit)")
+	flags.String(LockBackend, "none", "backend used to coordinate the updates of the git repo with other processes, one of none|file|git-ref")
+	flags.String(LockDir, "", "directory where the lock files are stored by the file lock backend (default is $TMPDIR/helm-repo-updater-locks)")
+	flags.String(LockRef, lock.DefaultLockRef, "reference of the git repo used as lock by the git-ref lock backend")
+	flags.Duration(LockTTL, lock.DefaultTTL, "time after which a lock of the git-ref lock backend not released is considered abandoned")
+	flags.String(NotificationsConfig, "", "YAML file configuring the notifiers of the changes pushed to the git repo per app, eg. to Slack (default no notifications)")
+	flags.StringArray(CommitTrailer, nil, "key=value trailer added to the commit message, can be repeated eg. Pipeline-URL=https://ci.example.com/pipelines/1")
+	flags.String(TagTemplate, "", "template of the name of the tag created on the commit with the changes and pushed with it, eg. {{ .AppName }}-{{ (index .KeyChanges 0).NewValue }}")
+	flags.Bool(TagAnnotated, false, "create an annotated tag with the commit message instead of a lightweight one")
+	flags.String(TagSignKeyFile, "", "file with the armored OpenPGP private key used to sign the tag, which implies an annotated tag")
+	flags.String(TagPassphraseFromEnv, "", "name of the environment variable with the passphrase of the tag sign key")
+	flags.Bool(KeepWorkspace, false, "keep the temporal directory where the git repo is cloned after the execution, useful for debugging")
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
-	runCmd.Flags().String(GitCommitUser, "", "Username to use for Git commits")
-	runCmd.Flags().String(GitCommitEmail, "", "e-mail address to use for Git commits")
-	runCmd.Flags().String(GitPassword, "", "Password for github user")
-	runCmd.Flags().String(GitBranch, "develop", "git repo branch")
-	runCmd.Flags().String(GitRepoURL, "", "git repo url")
+	addGitFlags(runCmd.Flags())
 	runCmd.Flags().String(GitFile, "", "file eg. values.yaml")
-	runCmd.Flags().String(GitDir, "", "file eg. /production/charts/")
 	runCmd.Flags().String(AppName, "", "app name")
-	runCmd.Flags().String(SSHPrivateKey, "", "ssh private key")
-	runCmd.Flags().Bool(UseSSHPrivateKeyAsInline, false, "ssh private key inline creation, if true it will use ssh-private-key as input for create ssh private key file in temporal directory")
-	runCmd.Flags().Bool(DryRun, false, "run in dry-run mode. If set to true, do not perform any changes")
-	runCmd.Flags().String(LogLevel, "info", "set the loglevel to one of trace|debug|info|warn|error")
 	runCmd.Flags().StringToString(HelmKeyValues, nil, "helm key-values sets")
+	runCmd.Flags().Duration(Timeout, 0, "maximum duration of the execution, eg. 5m (default no limit)")
 	runCmd.Flags().Bool(AllowErrorNothingToUpdate, true, "allow the error message 'nothing to update, skipping commit' and finish without exit 1 the execution")
+	addMetricsPushFlags(runCmd.Flags())
+	addTracingFlags(runCmd.Flags())
 
 	_ = runCmd.MarkFlagRequired(GitCommitUser)
 	_ = runCmd.MarkFlagRequired(GitCommitEmail)
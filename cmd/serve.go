@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/server"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"github.com/docplanner/helm-repo-updater/internal/app/webhook"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// ListenAddress is the address where the serve command listens for requests
+	ListenAddress = "listen-address"
+	// APITokenFile is the location of a file with the tokens accepted by the API, one per line
+	APITokenFile = "api-token-file"
+	// APITokenFromEnv is the name of the environment variable with the token accepted by the API
+	APITokenFromEnv = "api-token-from-env"
+	// Workers is the number of update jobs processed at the same time by the serve command
+	Workers = "workers"
+	// QueueSize is the maximum number of update jobs waiting to be processed by the serve command
+	QueueSize = "queue-size"
+	// MaxJobs is the maximum number of finished update jobs whose status is kept by the serve command
+	MaxJobs = "max-jobs"
+	// JobTimeout is the maximum duration of an update job of the serve command
+	JobTimeout = "job-timeout"
+	// BatchWindow is the time the update jobs are waited for to be coalesced in a single commit by the serve command
+	BatchWindow = "batch-window"
+	// BatchStrategy resolves the updates of the same key coalesced in a single commit by the serve command
+	BatchStrategy = "batch-strategy"
+	// WebhookRulesFile is the location of a file with the rules mapping the images pushed to the keys updated
+	WebhookRulesFile = "webhook-rules-file"
+	// WebhookSecretFile is the location of a file with the secret of the signatures of the webhooks
+	WebhookSecretFile = "webhook-secret-file"
+	// WebhookSecretFromEnv is the name of the environment variable with the secret of the signatures of the webhooks
+	WebhookSecretFromEnv = "webhook-secret-from-env"
+	// WebhookMaxAge is the maximum age of the webhooks accepted, older ones are rejected as replayed
+	WebhookMaxAge = "webhook-max-age"
+	// shutdownTimeout is the maximum time waited for the requests being served when the server stops
+	shutdownTimeout = 10 * time.Second
+)
+
+// readAPITokens returns the tokens accepted by the API, read from the file and the environment variable
+func readAPITokens(tokenFile, tokenFromEnv string) ([]string, error) {
+	var tokens []string
+	if tokenFile != "" {
+		content, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read API tokens from file %s: %v", tokenFile, err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if token := strings.TrimSpace(line); token != "" && !strings.HasPrefix(token, "#") {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	if tokenFromEnv != "" {
+		if token := strings.TrimSpace(os.Getenv(tokenFromEnv)); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("at least one API token is required, use --%s or --%s", APITokenFile, APITokenFromEnv)
+	}
+	return tokens, nil
+}
+
+// newWebhookHandler returns the handler of the webhooks of the registries queueing the updates in
+// enqueuer, or nil if no rules are configured
+func newWebhookHandler(cmd *cobra.Command, enqueuer webhook.Enqueuer) (http.Handler, error) {
+	rulesFile, _ := cmd.Flags().GetString(WebhookRulesFile)
+	secretFile, _ := cmd.Flags().GetString(WebhookSecretFile)
+	secretFromEnv, _ := cmd.Flags().GetString(WebhookSecretFromEnv)
+	maxAge, _ := cmd.Flags().GetDuration(WebhookMaxAge)
+
+	if rulesFile == "" {
+		return nil, nil
+	}
+	rules, err := webhook.LoadRules(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.SecretSource{
+		Name:   "webhook secret",
+		File:   secretFile,
+		EnvVar: secretFromEnv,
+	}.Resolve(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("the webhook secret is required, use --%s or --%s", WebhookSecretFile, WebhookSecretFromEnv)
+	}
+	log.AddSecret(secret)
+
+	return webhook.NewHandler(webhook.Config{
+		Rules:  rules,
+		Secret: []byte(secret),
+		MaxAge: maxAge,
+	}, enqueuer), nil
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves an API to request updates, processed in the background with the git credentials of the server",
+	Run: func(cmd *cobra.Command, args []string) {
+		gitDir, _ := cmd.Flags().GetString(GitDir)
+		logLevel, _ := cmd.Flags().GetString(LogLevel)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
+		listenAddress, _ := cmd.Flags().GetString(ListenAddress)
+		apiTokenFile, _ := cmd.Flags().GetString(APITokenFile)
+		apiTokenFromEnv, _ := cmd.Flags().GetString(APITokenFromEnv)
+		workers, _ := cmd.Flags().GetInt(Workers)
+		queueSize, _ := cmd.Flags().GetInt(QueueSize)
+		maxJobs, _ := cmd.Flags().GetInt(MaxJobs)
+		jobTimeout, _ := cmd.Flags().GetDuration(JobTimeout)
+		batchWindow, _ := cmd.Flags().GetDuration(BatchWindow)
+		batchStrategy, _ := cmd.Flags().GetString(BatchStrategy)
+
+		if err := log.SetLogLevel(logLevel); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		if batchStrategy != server.LatestWins && batchStrategy != server.SemverMax {
+			fmt.Printf("unknown batch strategy %s, it must be one of %s|%s\n", batchStrategy, server.LatestWins, server.SemverMax)
+
+			os.Exit(1)
+		}
+
+		tokens, err := readAPITokens(apiTokenFile, apiTokenFromEnv)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		for _, token := range tokens {
+			log.AddSecret(token)
+		}
+
+		cfg, err := newHelmUpdaterConfig(cmd, log.WithContext())
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		shutdownTracing, err := setupTracing(cmd)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		defer shutdownTracing()
+
+		s := server.New(server.Config{
+			Base:          cfg,
+			Dir:           gitDir,
+			Tokens:        tokens,
+			Workers:       workers,
+			QueueSize:     queueSize,
+			MaxJobs:       maxJobs,
+			JobTimeout:    jobTimeout,
+			BatchWindow:   batchWindow,
+			BatchStrategy: batchStrategy,
+		})
+
+		handler := http.NewServeMux()
+		handler.Handle("/", s.Handler())
+		webhookHandler, err := newWebhookHandler(cmd, s)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		if webhookHandler != nil {
+			handler.Handle(webhook.Path, webhookHandler)
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		s.Start(ctx)
+
+		httpServer := &http.Server{
+			Addr:              listenAddress,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			<-ctx.Done()
+			log.Infof("Shutting down server")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(shutdownCtx); err != nil {
+				log.Errorf("could not shut down server: %v", err)
+			}
+		}()
+
+		log.Infof("Listening on %s", listenAddress)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Error serving on %s: %v", listenAddress, err)
+
+			os.Exit(1)
+		}
+		s.Wait()
+		updater.CleanupWorkspaces()
+		closeNotifier(cfg)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	addGitFlags(serveCmd.Flags())
+	serveCmd.Flags().String(ListenAddress, ":8080", "address where the API listens for requests")
+	serveCmd.Flags().String(APITokenFile, "", "file with the bearer tokens accepted by the API, one per line")
+	serveCmd.Flags().String(APITokenFromEnv, "", "name of the environment variable with the bearer token accepted by the API")
+	serveCmd.Flags().Int(Workers, 2, "number of update jobs processed at the same time")
+	serveCmd.Flags().Int(QueueSize, 100, "maximum number of update jobs waiting to be processed")
+	serveCmd.Flags().Int(MaxJobs, 1000, "maximum number of finished update jobs whose status is kept")
+	serveCmd.Flags().Duration(JobTimeout, 0, "maximum duration of an update job, eg. 5m (default no limit)")
+	serveCmd.Flags().Duration(BatchWindow, 0, "time the update jobs queued are waited for to be coalesced in a single commit, eg. 30s (default each job is committed on its own)")
+	serveCmd.Flags().String(BatchStrategy, server.LatestWins, "how the updates of the same key coalesced in a single commit are resolved, one of latest-wins|semver-max")
+	serveCmd.Flags().String(WebhookRulesFile, "", "file with the rules mapping the images pushed to the keys updated, which enables the registry webhooks")
+	serveCmd.Flags().String(WebhookSecretFile, "", "file with the secret of the HMAC-SHA256 signatures of the registry webhooks")
+	serveCmd.Flags().String(WebhookSecretFromEnv, "", "name of the environment variable with the secret of the signatures of the registry webhooks")
+	serveCmd.Flags().Duration(WebhookMaxAge, webhook.DefaultMaxAge, "maximum age of the registry webhooks accepted, older ones are rejected as replayed")
+	addTracingFlags(serveCmd.Flags())
+
+	_ = serveCmd.MarkFlagRequired(GitCommitUser)
+	_ = serveCmd.MarkFlagRequired(GitCommitEmail)
+	_ = serveCmd.MarkFlagRequired(GitRepoURL)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// TracingOTLPEndpoint is the url of the OTLP/HTTP endpoint where the spans are exported
+	TracingOTLPEndpoint = "tracing-otlp-endpoint"
+	// TracingOTLPHeaders are the headers sent to the OTLP/HTTP endpoint, eg. to authenticate with the backend
+	TracingOTLPHeaders = "tracing-otlp-headers"
+	// TracingFile is the location of a file where the spans are written as JSON
+	TracingFile = "tracing-file"
+	// TracingServiceName is the name of the service of the spans exported
+	TracingServiceName = "tracing-service-name"
+
+	// tracingShutdownTimeout is the maximum time waited for the export of the last spans
+	tracingShutdownTimeout = 10 * time.Second
+)
+
+// addTracingFlags adds the flags of the export of the spans of the updates
+func addTracingFlags(flags *pflag.FlagSet) {
+	flags.String(TracingOTLPEndpoint, "", "url of the OTLP/HTTP endpoint where the spans of the updates are exported, eg. http://localhost:4318 (default $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flags.StringToString(TracingOTLPHeaders, nil, "headers sent to the OTLP/HTTP endpoint, eg. Authorization=Bearer token, which replace the ones of $OTEL_EXPORTER_OTLP_HEADERS")
+	flags.String(TracingFile, "", "file where the spans of the updates are appended as JSON instead of exporting them, eg. to inspect them offline")
+	flags.String(TracingServiceName, tracing.DefaultServiceName, "name of the service of the spans exported, which overrides $OTEL_SERVICE_NAME when set")
+}
+
+// setupTracing enables the export of the spans configured by the flags of the command and the OTEL_* environment
+// variables, returning the function exporting the last spans, which must be called before exiting. The spans are
+// not recorded if no export is configured
+func setupTracing(cmd *cobra.Command) (func(), error) {
+	var cfg tracing.Config
+	cfg.OTLPEndpoint, _ = cmd.Flags().GetString(TracingOTLPEndpoint)
+	cfg.OTLPHeaders, _ = cmd.Flags().GetStringToString(TracingOTLPHeaders)
+	cfg.File, _ = cmd.Flags().GetString(TracingFile)
+	if cmd.Flags().Changed(TracingServiceName) {
+		cfg.ServiceName, _ = cmd.Flags().GetString(TracingServiceName)
+	}
+	if !cfg.Enabled() {
+		return func() {}, nil
+	}
+	for _, value := range cfg.OTLPHeaders {
+		log.AddSecret(value)
+	}
+
+	provider, err := tracing.NewProvider(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Errorf("could not export spans: %v", err)
+	}))
+	otel.SetTracerProvider(provider)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			log.Errorf("could not export spans: %v", err)
+		}
+	}, nil
+}
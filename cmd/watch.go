@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/watch"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// WatchSourcesFile is the location of a file with the image repositories and Helm charts polled
+	WatchSourcesFile = "sources-file"
+	// WatchStateFile is the location of the file where the state of the sources is kept between runs
+	WatchStateFile = "state-file"
+	// WatchInterval is the time between the polls of the sources without interval
+	WatchInterval = "interval"
+	// WatchJitter is the maximum random delay added to the interval of each poll
+	WatchJitter = "jitter"
+	// WatchOnce indicates that the sources are polled once instead of periodically
+	WatchOnce = "once"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Polls image repositories and Helm chart indexes periodically, updating the values when a newer version is found",
+	Run: func(cmd *cobra.Command, args []string) {
+		gitDir, _ := cmd.Flags().GetString(GitDir)
+		logLevel, _ := cmd.Flags().GetString(LogLevel)
+		logFormat, _ := cmd.Flags().GetString(LogFormat)
+		sourcesFile, _ := cmd.Flags().GetString(WatchSourcesFile)
+		stateFile, _ := cmd.Flags().GetString(WatchStateFile)
+		interval, _ := cmd.Flags().GetDuration(WatchInterval)
+		jitter, _ := cmd.Flags().GetDuration(WatchJitter)
+		once, _ := cmd.Flags().GetBool(WatchOnce)
+
+		if err := log.SetLogLevel(logLevel); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		if err := log.SetLogFormat(logFormat); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		sources, err := watch.LoadSources(sourcesFile)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		for _, source := range sources {
+			if source.PasswordFromEnv != "" {
+				log.AddSecret(os.Getenv(source.PasswordFromEnv))
+			}
+		}
+
+		state, err := watch.LoadState(stateFile)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		cfg, err := newHelmUpdaterConfig(cmd, log.WithContext())
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		shutdownTracing, err := setupTracing(cmd)
+		if err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+		defer shutdownTracing()
+
+		w := watch.New(watch.Config{
+			Base:     cfg,
+			Dir:      gitDir,
+			Sources:  sources,
+			Interval: interval,
+			Jitter:   jitter,
+		}, state)
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if once {
+			failed := w.CheckAll(ctx)
+			updater.CleanupWorkspaces()
+			closeNotifier(cfg)
+			pushMetrics(cmd)
+			if failed > 0 {
+				fmt.Printf("could not check %d of %d sources\n", failed, len(sources))
+				shutdownTracing()
+
+				os.Exit(1)
+			}
+			return
+		}
+
+		serveMetrics(ctx, cmd)
+		log.Infof("Watching %d sources", len(sources))
+		w.Run(ctx)
+		updater.CleanupWorkspaces()
+		closeNotifier(cfg)
+		log.Infof("Stopped watching sources")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	addGitFlags(watchCmd.Flags())
+	watchCmd.Flags().String(WatchSourcesFile, "", "file with the image repositories and Helm charts polled and the keys they update")
+	watchCmd.Flags().String(WatchStateFile, "", "file where the versions set and the last polls are kept between runs (default the state is not kept)")
+	watchCmd.Flags().Duration(WatchInterval, watch.DefaultInterval, "time between the polls of the sources without interval")
+	watchCmd.Flags().Duration(WatchJitter, 30*time.Second, "maximum random delay added to the interval of each poll")
+	watchCmd.Flags().Bool(WatchOnce, false, "poll every source once and exit, eg. to run the watcher as a cron job")
+	addMetricsFlags(watchCmd.Flags())
+	addMetricsPushFlags(watchCmd.Flags())
+	addTracingFlags(watchCmd.Flags())
+
+	_ = watchCmd.MarkFlagRequired(GitCommitUser)
+	_ = watchCmd.MarkFlagRequired(GitCommitEmail)
+	_ = watchCmd.MarkFlagRequired(GitRepoURL)
+	_ = watchCmd.MarkFlagRequired(WatchSourcesFile)
+}
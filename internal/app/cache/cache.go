@@ -0,0 +1,289 @@
+// Package cache maintains bare mirrors of git repositories in a local directory,
+// so they can be reused between runs fetching only the latest changes.
+//
+// Every mirror has two lock files: the update lock, taken in exclusive mode while
+// the mirror is fetched, and the usage lock, taken in shared mode while a run has
+// a worktree whose objects are stored in the mirror. Pruning a mirror requires
+// both locks in exclusive mode, so mirrors in use are never removed.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/gofrs/flock"
+)
+
+const (
+	mirrorSuffix     = ".git"
+	updateLockSuffix = ".lock"
+	usageLockSuffix  = ".use"
+	remoteName       = "origin"
+	// lockRetryDelay is the time waited between attempts to take the update lock of a mirror
+	lockRetryDelay = 100 * time.Millisecond
+)
+
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Cache is a directory storing bare mirrors of git repositories
+type Cache struct {
+	Dir string
+}
+
+// Mirror is a bare mirror of a git repository stored in the cache, in use
+// until Release is called
+type Mirror struct {
+	Path       string
+	Repository *git.Repository
+	usageLock  *flock.Flock
+}
+
+// New returns the cache stored in dir, creating the directory if it doesn't exist
+func New(dir string) (*Cache, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(absDir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create cache directory: %v", err)
+	}
+	return &Cache{Dir: absDir}, nil
+}
+
+// mirrorName returns a file name for the mirror of repoURL which is unique and
+// still recognizable by humans inspecting the cache directory
+func mirrorName(repoURL string) string {
+	sum := sha256.Sum256([]byte(repoURL))
+	name := strings.TrimSuffix(repoURL[strings.LastIndexAny(repoURL, "/:")+1:], mirrorSuffix)
+	name = unsafeNameChars.ReplaceAllString(name, "-")
+	return fmt.Sprintf("%s-%s", name, hex.EncodeToString(sum[:8]))
+}
+
+// MirrorPath returns the location of the mirror of repoURL in the cache
+func (c *Cache) MirrorPath(repoURL string) string {
+	return filepath.Join(c.Dir, mirrorName(repoURL)+mirrorSuffix)
+}
+
+// Mirror returns the mirror of repoURL with the latest changes of the remote, creating it
+// if it doesn't exist yet. The mirror can't be pruned until it is released
+func (c *Cache) Mirror(ctx context.Context, repoURL string, auth transport.AuthMethod) (*Mirror, error) {
+	mirrorPath := c.MirrorPath(repoURL)
+	logCtx := log.FromContext(ctx).AddField(log.FieldRepo, log.RedactURL(repoURL))
+
+	updateLock := flock.New(mirrorPath + updateLockSuffix)
+	logCtx.Debugf("Waiting for update lock of mirror %s", mirrorPath)
+	if _, err := updateLock.TryLockContext(ctx, lockRetryDelay); err != nil {
+		return nil, fmt.Errorf("could not lock mirror %s: %v", mirrorPath, err)
+	}
+	defer updateLock.Unlock()
+
+	repo, err := openOrInitMirror(mirrorPath, repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	logCtx.Infof("Fetching latest changes in mirror located in %s", mirrorPath)
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: remoteName,
+		Auth:       auth,
+		Force:      true,
+		Progress:   os.Stdout,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+	if err = updateMirrorHead(ctx, repo, auth); err != nil {
+		return nil, err
+	}
+
+	usageLock := flock.New(mirrorPath + usageLockSuffix)
+	if err = usageLock.RLock(); err != nil {
+		return nil, fmt.Errorf("could not lock mirror %s: %v", mirrorPath, err)
+	}
+	// the modification time of the usage lock tracks when the mirror was used for the last time
+	now := time.Now()
+	if err = os.Chtimes(usageLock.Path(), now, now); err != nil {
+		logCtx.Warnf("could not update last usage time of mirror %s: %v", mirrorPath, err)
+	}
+
+	return &Mirror{
+		Path:       mirrorPath,
+		Repository: repo,
+		usageLock:  usageLock,
+	}, nil
+}
+
+// openOrInitMirror opens the bare mirror located in mirrorPath, initializing it if it doesn't exist
+func openOrInitMirror(mirrorPath string, repoURL string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(mirrorPath)
+	if err == nil {
+		return repo, nil
+	}
+	if err != git.ErrRepositoryNotExists {
+		return nil, err
+	}
+
+	log.Debugf("Initializing mirror of %s in %s", log.RedactURL(repoURL), mirrorPath)
+	repo, err = git.PlainInit(mirrorPath, true)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: remoteName,
+		URLs: []string{repoURL},
+		Fetch: []config.RefSpec{
+			"+refs/heads/*:refs/heads/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// updateMirrorHead points the HEAD of the mirror to the default branch of the remote
+func updateMirrorHead(ctx context.Context, repo *git.Repository, auth transport.AuthMethod) error {
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, ref.Target()))
+		}
+	}
+	return nil
+}
+
+// NewWorktree creates in dir a repository with a working tree whose objects are shared with
+// the mirror through git alternates, with origin pointing to repoURL and the local and remote
+// branches at the same commits as in the mirror
+func (m *Mirror) NewWorktree(dir string, repoURL string) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	alternatesFile := filepath.Join(dir, git.GitDirName, "objects", "info", "alternates")
+	if err = os.MkdirAll(filepath.Dir(alternatesFile), 0755); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(alternatesFile, []byte(filepath.Join(m.Path, "objects")+"\n"), 0644); err != nil {
+		return nil, err
+	}
+
+	if _, err = repo.CreateRemote(&config.RemoteConfig{Name: remoteName, URLs: []string{repoURL}}); err != nil {
+		return nil, err
+	}
+
+	refs, err := m.Repository.References()
+	if err != nil {
+		return nil, err
+	}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		switch {
+		case ref.Name().IsBranch():
+			remoteRef := plumbing.NewRemoteReferenceName(remoteName, ref.Name().Short())
+			if err := repo.Storer.SetReference(plumbing.NewHashReference(remoteRef, ref.Hash())); err != nil {
+				return err
+			}
+			return repo.Storer.SetReference(ref)
+		case ref.Name().IsTag():
+			return repo.Storer.SetReference(ref)
+		case ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference:
+			return repo.Storer.SetReference(ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// Release marks the mirror as not in use by this process
+func (m *Mirror) Release() error {
+	return m.usageLock.Unlock()
+}
+
+// Prune removes the mirrors of the cache not used for maxAge which are not in use
+// by any process, returning the locations of the removed mirrors
+func (c *Cache) Prune(maxAge time.Duration) ([]string, error) {
+	entries, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasSuffix(entry.Name(), mirrorSuffix) {
+			continue
+		}
+		mirrorPath := filepath.Join(c.Dir, entry.Name())
+
+		lastUsed := entry.ModTime()
+		if usageInfo, err := os.Stat(mirrorPath + usageLockSuffix); err == nil {
+			lastUsed = usageInfo.ModTime()
+		}
+		if time.Since(lastUsed) < maxAge {
+			continue
+		}
+
+		removed, err := removeUnusedMirror(mirrorPath)
+		if err != nil {
+			return pruned, err
+		}
+		if removed {
+			pruned = append(pruned, mirrorPath)
+		}
+	}
+
+	return pruned, nil
+}
+
+// removeUnusedMirror removes the mirror located in mirrorPath if no process is using it
+func removeUnusedMirror(mirrorPath string) (bool, error) {
+	updateLock := flock.New(mirrorPath + updateLockSuffix)
+	locked, err := updateLock.TryLock()
+	if err != nil || !locked {
+		return false, err
+	}
+	defer updateLock.Unlock()
+
+	usageLock := flock.New(mirrorPath + usageLockSuffix)
+	locked, err = usageLock.TryLock()
+	if err != nil || !locked {
+		if !locked {
+			log.Infof("Mirror %s is in use, skipping", mirrorPath)
+		}
+		return false, err
+	}
+	defer usageLock.Unlock()
+
+	log.Infof("Removing mirror %s", mirrorPath)
+	if err = os.RemoveAll(mirrorPath); err != nil {
+		return false, err
+	}
+	// the lock files are kept, removing them could allow two processes
+	// to hold the same lock over different files
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/gofrs/flock"
+	"gotest.tools/v3/assert"
+)
+
+// newRemoteRepository creates a bare repository with a commit in the main branch
+func newRemoteRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary is required to create the remote repository")
+	}
+
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	remote := filepath.Join(root, "remote.git")
+	for _, args := range [][]string{
+		{"init", "-q", src},
+		{"-C", src, "commit", "-q", "--allow-empty", "-m", "initial commit"},
+		{"-C", src, "branch", "-M", "main"},
+		{"clone", "-q", "--bare", src, remote},
+	} {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@docplanner.com"}, args...)
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+
+	return remote
+}
+
+func TestMirrorPath(t *testing.T) {
+	c := &Cache{Dir: "/cache"}
+
+	assert.Equal(t, c.MirrorPath("https://github.com/docplanner/helm-repo-updater.git"), c.MirrorPath("https://github.com/docplanner/helm-repo-updater.git"))
+	assert.Assert(t, c.MirrorPath("https://github.com/docplanner/helm-repo-updater.git") != c.MirrorPath("ssh://git@github.com/docplanner/helm-repo-updater.git"))
+	assert.Assert(t, strings.HasPrefix(c.MirrorPath("git@github.com:docplanner/helm-repo-updater.git"), "/cache/helm-repo-updater-"))
+}
+
+func TestMirrorNewWorktree(t *testing.T) {
+	remote := newRemoteRepository(t)
+	c, err := New(t.TempDir())
+	assert.NilError(t, err)
+
+	mirror, err := c.Mirror(context.Background(), remote, nil)
+	assert.NilError(t, err)
+	defer mirror.Release()
+
+	repo, err := mirror.NewWorktree(t.TempDir(), remote)
+	assert.NilError(t, err)
+
+	head, err := repo.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, head.Name(), plumbing.NewBranchReferenceName("main"))
+	_, err = repo.CommitObject(head.Hash())
+	assert.NilError(t, err)
+
+	remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", "main"), false)
+	assert.NilError(t, err)
+	assert.Equal(t, remoteRef.Hash(), head.Hash())
+}
+
+func TestMirrorInvalidRepository(t *testing.T) {
+	c, err := New(t.TempDir())
+	assert.NilError(t, err)
+
+	_, err = c.Mirror(context.Background(), filepath.Join(t.TempDir(), "missing.git"), nil)
+	assert.ErrorContains(t, err, "repository not found")
+}
+
+func TestPrune(t *testing.T) {
+	remote := newRemoteRepository(t)
+	c, err := New(t.TempDir())
+	assert.NilError(t, err)
+
+	mirror, err := c.Mirror(context.Background(), remote, nil)
+	assert.NilError(t, err)
+
+	pruned, err := c.Prune(time.Hour)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pruned), 0)
+
+	// mirrors in use are never pruned
+	pruned, err = c.Prune(0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pruned), 0)
+
+	assert.NilError(t, mirror.Release())
+	pruned, err = c.Prune(0)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pruned, []string{mirror.Path})
+
+	_, err = os.Stat(mirror.Path)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestMirrorLockTimeout(t *testing.T) {
+	remote := newRemoteRepository(t)
+	c, err := New(t.TempDir())
+	assert.NilError(t, err)
+
+	updateLock := flock.New(c.MirrorPath(remote) + updateLockSuffix)
+	assert.NilError(t, updateLock.Lock())
+	defer updateLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = c.Mirror(ctx, remote, nil)
+	assert.ErrorContains(t, err, "could not lock mirror")
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
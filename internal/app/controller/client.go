@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// serviceAccountDir is where the credentials of the service account of the pod are mounted
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// apiTimeout is the maximum duration of the requests to the Kubernetes API
+	apiTimeout = 30 * time.Second
+	// maxAPIResponseSize is the maximum size of the responses of the Kubernetes API
+	maxAPIResponseSize = 32 << 20
+)
+
+// ClientConfig is the configuration of the connection with the Kubernetes API
+type ClientConfig struct {
+	// Server is the url of the Kubernetes API, eg. https://kubernetes.default.svc
+	Server string
+	// TokenFile is the location of the file with the bearer token, read again in each request because the
+	// tokens of the service accounts are rotated. The requests are not authenticated if empty
+	TokenFile string
+	// CAFile is the location of a PEM bundle with the CAs of the Kubernetes API, the system ones are used if empty
+	CAFile string
+	// InsecureSkipTLSVerify disables the TLS certificate verification of the Kubernetes API
+	InsecureSkipTLSVerify bool
+}
+
+// InClusterConfig returns the configuration of the connection with the Kubernetes API from a pod,
+// using the credentials of its service account
+func InClusterConfig() (ClientConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return ClientConfig{}, fmt.Errorf("not running in a Kubernetes cluster, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	return ClientConfig{
+		Server:    "https://" + net.JoinHostPort(host, port),
+		TokenFile: serviceAccountDir + "/token",
+		CAFile:    serviceAccountDir + "/ca.crt",
+	}, nil
+}
+
+// Client is a client of the Kubernetes API for the ImageUpdatePolicy custom resources
+type Client struct {
+	cfg  ClientConfig
+	http *http.Client
+}
+
+// NewClient returns a client of the Kubernetes API
+func NewClient(cfg ClientConfig) (*Client, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("the url of the Kubernetes API is required")
+	}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- explicitly requested by the user
+		InsecureSkipVerify: cfg.InsecureSkipTLSVerify,
+	}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file %s of the Kubernetes API: %v", cfg.CAFile, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA file %s of the Kubernetes API", cfg.CAFile)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		cfg:  cfg,
+		http: &http.Client{Transport: transport, Timeout: apiTimeout},
+	}, nil
+}
+
+// policiesPath returns the path of the policies of the namespace, or of all namespaces if empty
+func policiesPath(namespace string) string {
+	if namespace == "" {
+		return fmt.Sprintf("/apis/%s/%s/%s", Group, Version, Plural)
+	}
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", Group, Version, url.PathEscape(namespace), Plural)
+}
+
+// ListPolicies lists the policies of the namespace, or of all namespaces if empty
+func (c *Client) ListPolicies(ctx context.Context, namespace string) ([]ImageUpdatePolicy, error) {
+	var list policyList
+	if err := c.do(ctx, http.MethodGet, policiesPath(namespace), "", nil, &list); err != nil {
+		return nil, fmt.Errorf("could not list %s: %v", Plural, err)
+	}
+	return list.Items, nil
+}
+
+// UpdateStatus replaces the status of the policy with a merge patch of its status subresource,
+// so the changes of the spec made at the same time are not overwritten
+func (c *Client) UpdateStatus(ctx context.Context, policy *ImageUpdatePolicy) error {
+	status, err := json.Marshal(policy.Status)
+	if err != nil {
+		return err
+	}
+	// the fields of the status not set are removed, as a merge patch only removes the null ones
+	fields := map[string]interface{}{
+		"lastSeenVersion":    nil,
+		"lastAppliedVersion": nil,
+		"lastCommit":         nil,
+		"lastCheckTime":      nil,
+		"lastUpdateTime":     nil,
+		"error":              nil,
+	}
+	if err = json.Unmarshal(status, &fields); err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{"status": fields})
+	if err != nil {
+		return err
+	}
+
+	path := policiesPath(policy.Metadata.Namespace) + "/" + url.PathEscape(policy.Metadata.Name) + "/status"
+	if err = c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil); err != nil {
+		return fmt.Errorf("could not update status of %s %s: %v", Kind, policy.ID(), err)
+	}
+	return nil
+}
+
+// do makes a request to the Kubernetes API, decoding the body of the response into out
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.cfg.Server, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.cfg.TokenFile != "" {
+		token, err := os.ReadFile(c.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("could not read token file %s of the Kubernetes API: %v", c.cfg.TokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// the errors of the API are Status objects explaining the cause
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(content, &status) == nil && status.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, status.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(content, out)
+}
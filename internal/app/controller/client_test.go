@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testToken = "test-token"
+
+// testAPIServer is a stand-in of the Kubernetes API serving the policies stored in memory
+type testAPIServer struct {
+	mu       sync.Mutex
+	policies map[string]*ImageUpdatePolicy
+	patches  int
+}
+
+// newTestAPIServer returns a stand-in of the Kubernetes API serving the policies, and a client of it
+func newTestAPIServer(t *testing.T, policies ...ImageUpdatePolicy) (*testAPIServer, *Client) {
+	t.Helper()
+	s := &testAPIServer{policies: make(map[string]*ImageUpdatePolicy)}
+	for i := range policies {
+		policy := policies[i]
+		s.policies[policy.ID()] = &policy
+	}
+	httpServer := httptest.NewTLSServer(s)
+	t.Cleanup(httpServer.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NilError(t, os.WriteFile(tokenFile, []byte(testToken+"\n"), 0600))
+	client, err := NewClient(ClientConfig{Server: httpServer.URL, TokenFile: tokenFile, InsecureSkipTLSVerify: true})
+	assert.NilError(t, err)
+	return s, client
+}
+
+// policy returns a copy of the policy stored
+func (s *testAPIServer) policy(id string) ImageUpdatePolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.policies[id]
+}
+
+// writeStatus writes a Status object of the Kubernetes API with the error
+func writeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "status": "Failure", "message": message, "code": code})
+}
+
+func (s *testAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+testToken {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := "/apis/" + Group + "/" + Version + "/"
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == prefix+Plural:
+		s.list(w, "")
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "namespaces" && parts[2] == Plural:
+		s.list(w, parts[1])
+	case r.Method == http.MethodPatch && len(parts) == 5 && parts[0] == "namespaces" && parts[2] == Plural && parts[4] == "status":
+		s.patchStatus(w, r, parts[1]+"/"+parts[3])
+	default:
+		writeStatus(w, http.StatusNotFound, "the server could not find the requested resource")
+	}
+}
+
+// list writes the policies of the namespace, or of all namespaces if empty
+func (s *testAPIServer) list(w http.ResponseWriter, namespace string) {
+	list := policyList{Items: []ImageUpdatePolicy{}}
+	for _, policy := range s.policies {
+		if namespace == "" || policy.Metadata.Namespace == namespace {
+			list.Items = append(list.Items, *policy)
+		}
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].ID() < list.Items[j].ID() })
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+// patchStatus applies the merge patch of the request to the status of the policy
+func (s *testAPIServer) patchStatus(w http.ResponseWriter, r *http.Request, id string) {
+	policy, found := s.policies[id]
+	if !found {
+		writeStatus(w, http.StatusNotFound, fmt.Sprintf("%s.%s %q not found", Plural, Group, id))
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/merge-patch+json" {
+		writeStatus(w, http.StatusUnsupportedMediaType, "unsupported patch type")
+		return
+	}
+	var patch struct {
+		Status map[string]interface{} `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeStatus(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	content, _ := json.Marshal(policy.Status)
+	status := make(map[string]interface{})
+	_ = json.Unmarshal(content, &status)
+	for field, value := range patch.Status {
+		if value == nil {
+			delete(status, field)
+		} else {
+			status[field] = value
+		}
+	}
+	content, _ = json.Marshal(status)
+	policy.Status = PolicyStatus{}
+	if err := json.Unmarshal(content, &policy.Status); err != nil {
+		writeStatus(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	s.patches++
+	_ = json.NewEncoder(w).Encode(policy)
+}
+
+// newTestPolicy returns a policy of the image of the example app
+func newTestPolicy(namespace, name string) ImageUpdatePolicy {
+	return ImageUpdatePolicy{
+		APIVersion: Group + "/" + Version,
+		Kind:       Kind,
+		Metadata:   ObjectMeta{Name: name, Namespace: namespace, Generation: 1},
+		Spec: PolicySpec{
+			File:  "example-app/values.yaml",
+			Key:   ".image.tag",
+			Image: "ghcr.io/docplanner/example-app",
+		},
+	}
+}
+
+func TestClientListPolicies(t *testing.T) {
+	_, client := newTestAPIServer(t, newTestPolicy("team-a", "example-app"), newTestPolicy("team-b", "other-app"))
+
+	policies, err := client.ListPolicies(context.Background(), "")
+	assert.NilError(t, err)
+	assert.Equal(t, len(policies), 2)
+	assert.Equal(t, policies[0].ID(), "team-a/example-app")
+	assert.Equal(t, policies[0].Spec.Image, "ghcr.io/docplanner/example-app")
+
+	policies, err = client.ListPolicies(context.Background(), "team-b")
+	assert.NilError(t, err)
+	assert.Equal(t, len(policies), 1)
+	assert.Equal(t, policies[0].ID(), "team-b/other-app")
+}
+
+func TestClientUpdateStatus(t *testing.T) {
+	policy := newTestPolicy("team-a", "example-app")
+	policy.Status = PolicyStatus{LastSeenVersion: "1.0.0", LastCommit: "4c9ba4a0", Error: "could not push changes"}
+	s, client := newTestAPIServer(t, policy)
+
+	// the fields not set are removed
+	policy.Status = PolicyStatus{ObservedGeneration: 1, LastSeenVersion: "1.1.0", LastCommit: "4c9ba4a0"}
+	assert.NilError(t, client.UpdateStatus(context.Background(), &policy))
+	assert.DeepEqual(t, s.policy(policy.ID()).Status, policy.Status)
+
+	policy.Metadata.Name = "missing-app"
+	err := client.UpdateStatus(context.Background(), &policy)
+	assert.ErrorContains(t, err, "could not update status of ImageUpdatePolicy team-a/missing-app: 404 Not Found: "+Plural)
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	_, client := newTestAPIServer(t)
+	assert.NilError(t, os.WriteFile(client.cfg.TokenFile, []byte("other-token"), 0600))
+
+	_, err := client.ListPolicies(context.Background(), "")
+	assert.Error(t, err, "could not list "+Plural+": 401 Unauthorized: Unauthorized")
+}
+
+func TestInClusterConfig(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+	cfg, err := InClusterConfig()
+	assert.NilError(t, err)
+	assert.Equal(t, cfg.Server, "https://10.0.0.1:443")
+	assert.Equal(t, cfg.TokenFile, serviceAccountDir+"/token")
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err = InClusterConfig()
+	assert.ErrorContains(t, err, "not running in a Kubernetes cluster")
+}
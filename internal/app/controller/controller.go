@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/watch"
+)
+
+const (
+	// DefaultResyncInterval is the time between the lists of the policies
+	DefaultResyncInterval = 30 * time.Second
+	// requestTimeout is the maximum duration of the requests to the registries and chart repositories
+	requestTimeout = 30 * time.Second
+)
+
+// updateFunc updates the values of an application, returning the hash of the commit
+type updateFunc func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, string, error)
+
+// versionsFunc lists the versions of a source
+type versionsFunc func(ctx context.Context, client *http.Client, source *watch.Source) ([]string, error)
+
+// Config is the configuration of the controller
+type Config struct {
+	// Base is the configuration of the updates, whose repository, branch, file and values are set from the policies
+	Base updater.HelmUpdaterConfig
+	// AllowedRepoURLs are the git repositories the policies can update besides the one of Base, as
+	// the credentials of the controller are sent to them
+	AllowedRepoURLs []string
+	// Namespace is the namespace of the policies reconciled, every namespace if empty
+	Namespace string
+	// ResyncInterval is the time between the lists of the policies
+	ResyncInterval time.Duration
+	// Interval is the time between the polls of the versions of the policies without interval
+	Interval time.Duration
+	// Client is the HTTP client of the registries and chart repositories
+	Client *http.Client
+}
+
+// Controller reconciles the ImageUpdatePolicy resources, setting the newest eligible version of each
+// of them in its key and recording the result in its status
+type Controller struct {
+	cfg       Config
+	kube      *Client
+	syncState *updater.SyncIterationState
+	update    updateFunc
+	versions  versionsFunc
+}
+
+// New returns a controller of the policies of the Kubernetes API of kube
+func New(cfg Config, kube *Client) *Controller {
+	if cfg.ResyncInterval <= 0 {
+		cfg.ResyncInterval = DefaultResyncInterval
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = watch.DefaultInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Controller{
+		cfg:       cfg,
+		kube:      kube,
+		syncState: updater.NewSyncIterationState(),
+		update:    updater.UpdateApplicationCommit,
+		versions: func(ctx context.Context, client *http.Client, source *watch.Source) ([]string, error) {
+			return source.Versions(ctx, client)
+		},
+	}
+}
+
+// Run reconciles the policies every resync interval until ctx is done
+func (c *Controller) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.ResyncInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.ReconcileAll(ctx); err != nil {
+			log.Errorf("Could not reconcile %s: %v", Plural, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileAll reconciles the policies listed, the errors of each policy are recorded in its status
+func (c *Controller) ReconcileAll(ctx context.Context) error {
+	policies, err := c.kube.ListPolicies(ctx, c.cfg.Namespace)
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		policy := &policies[i]
+		if !c.due(policy, time.Now()) {
+			continue
+		}
+		c.Reconcile(ctx, policy)
+		if err = c.kube.UpdateStatus(ctx, policy); err != nil {
+			log.WithContext().AddField("policy", policy.ID()).Errorf("%v", err)
+		}
+	}
+	return nil
+}
+
+// due checks if the policy has to be reconciled, because it has changed or its interval has elapsed since the last check
+func (c *Controller) due(policy *ImageUpdatePolicy, now time.Time) bool {
+	status := policy.Status
+	if status.ObservedGeneration != policy.Metadata.Generation || status.LastCheckTime == nil {
+		return true
+	}
+	interval := c.cfg.Interval
+	if parsed, err := time.ParseDuration(policy.Spec.Interval); err == nil && parsed > 0 {
+		interval = parsed
+	}
+	return !now.Before(status.LastCheckTime.Add(interval))
+}
+
+// Reconcile polls the versions of the policy, updating its key if the newest eligible version is not the one
+// known to be set, and records the result in the status of the policy
+func (c *Controller) Reconcile(ctx context.Context, policy *ImageUpdatePolicy) {
+	ctx = log.ContextWithRunID(ctx, log.NewRunID())
+	logCtx := log.FromContext(ctx).AddField("policy", policy.ID())
+	now := time.Now().UTC().Truncate(time.Second)
+	status := &policy.Status
+	if status.ObservedGeneration != policy.Metadata.Generation {
+		// the spec has changed, so the version set by the previous spec may not be the one set now
+		status.LastAppliedVersion = ""
+	}
+	status.ObservedGeneration = policy.Metadata.Generation
+	status.LastCheckTime = &now
+	status.Error = ""
+
+	if err := c.reconcile(ctx, policy, now); err != nil {
+		logCtx.Errorf("Could not reconcile %s: %v", Kind, err)
+		status.Error = err.Error()
+	}
+}
+
+// reconcile polls the versions of the policy and updates its key
+func (c *Controller) reconcile(ctx context.Context, policy *ImageUpdatePolicy, now time.Time) error {
+	logCtx := log.FromContext(ctx).AddField("policy", policy.ID())
+	status := &policy.Status
+	source, err := policy.source(c.cfg.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid spec: %v", err)
+	}
+	cfg, err := c.updaterConfig(policy)
+	if err != nil {
+		return fmt.Errorf("invalid spec: %v", err)
+	}
+
+	versions, err := c.versions(ctx, c.cfg.Client, source)
+	if err != nil {
+		return err
+	}
+	newest := source.Newest(versions)
+	if newest == "" {
+		return fmt.Errorf("no eligible version of %s found", source)
+	}
+	status.LastSeenVersion = newest
+	if newest == status.LastAppliedVersion {
+		logCtx.Debugf("Version %s of %s is already set in key %s", newest, source, policy.Spec.Key)
+		return nil
+	}
+
+	logCtx.Infof("Setting key %s to version %s of %s", policy.Spec.Key, newest, source)
+	cfg.UpdateApps = []updater.ChangeEntry{{Key: policy.Spec.Key, NewValue: newest}}
+	_, commit, err := c.update(ctx, cfg, c.syncState)
+	if err != nil && !errors.Is(err, updater.ErrNothingToUpdate) {
+		return err
+	}
+	if cfg.DryRun {
+		return nil
+	}
+	status.LastAppliedVersion = newest
+	if commit != "" {
+		status.LastCommit = commit
+		status.LastUpdateTime = &now
+	}
+	return nil
+}
+
+// updaterConfig returns the configuration of the update of the key of the policy
+func (c *Controller) updaterConfig(policy *ImageUpdatePolicy) (updater.HelmUpdaterConfig, error) {
+	cfg := c.cfg.Base
+	gitConf := *cfg.GitConf
+	cfg.GitConf = &gitConf
+	cfg.AppName = policy.Metadata.Name
+	cfg.File = policy.Spec.File
+	gitConf.File = ""
+
+	if policy.Spec.RepoURL != "" && policy.Spec.RepoURL != gitConf.RepoURL {
+		allowed := false
+		for _, repoURL := range c.cfg.AllowedRepoURLs {
+			allowed = allowed || repoURL == policy.Spec.RepoURL
+		}
+		if !allowed {
+			return cfg, fmt.Errorf("repository %s is not allowed", policy.Spec.RepoURL)
+		}
+		gitConf.RepoURL = policy.Spec.RepoURL
+	}
+	if gitConf.RepoURL == "" {
+		return cfg, fmt.Errorf("the repository is required")
+	}
+	if policy.Spec.Branch != "" {
+		gitConf.Branch = policy.Spec.Branch
+	}
+
+	switch policy.Spec.WriteBack.Method {
+	case "", WriteBackCommit:
+	case WriteBackBranch:
+		if policy.Spec.WriteBack.Branch == "" {
+			return cfg, fmt.Errorf("the write-back branch is required by the %s method", WriteBackBranch)
+		}
+		gitConf.PushBranch = policy.Spec.WriteBack.Branch
+	default:
+		return cfg, fmt.Errorf("invalid write-back method %s, it must be one of %s|%s", policy.Spec.WriteBack.Method, WriteBackCommit, WriteBackBranch)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/watch"
+	"gotest.tools/v3/assert"
+)
+
+// fakeUpdater records the updates, committing them with the hash of the commit unless there is nothing to update
+type fakeUpdater struct {
+	cfgs   []updater.HelmUpdaterConfig
+	values map[string]string
+	err    error
+}
+
+func (u *fakeUpdater) update(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, string, error) {
+	u.cfgs = append(u.cfgs, cfg)
+	if u.err != nil {
+		return nil, "", u.err
+	}
+	id := cfg.GitConf.RepoURL + ":" + cfg.File + ":" + cfg.UpdateApps[0].Key
+	if u.values[id] == cfg.UpdateApps[0].NewValue {
+		return nil, "", updater.ErrNothingToUpdate
+	}
+	u.values[id] = cfg.UpdateApps[0].NewValue
+	return &cfg.UpdateApps, "commit-" + cfg.UpdateApps[0].NewValue, nil
+}
+
+// newTestController returns a controller of the policies of the API server stand-in, which are
+// updated by u with the tags listed
+func newTestController(t *testing.T, client *Client, u *fakeUpdater, tags *[]string) *Controller {
+	t.Helper()
+	c := New(Config{
+		Base: updater.HelmUpdaterConfig{
+			GitCredentials: &git.Credentials{},
+			GitConf:        &git.Conf{RepoURL: "https://git.example.com/gitops.git", Branch: "main", File: "ignored"},
+		},
+		AllowedRepoURLs: []string{"https://git.example.com/other.git"},
+		Interval:        time.Hour,
+	}, client)
+	c.update = u.update
+	c.versions = func(ctx context.Context, client *http.Client, source *watch.Source) ([]string, error) {
+		return *tags, nil
+	}
+	return c
+}
+
+func TestControllerReconcile(t *testing.T) {
+	policy := newTestPolicy("team-a", "example-app")
+	policy.Spec.Version = "^1.0"
+	s, client := newTestAPIServer(t, policy)
+	u := &fakeUpdater{values: map[string]string{}}
+	tags := []string{"1.0.0", "1.1.0", "2.0.0", "latest"}
+	c := newTestController(t, client, u, &tags)
+
+	// the newest version satisfying the constraint is committed
+	assert.NilError(t, c.ReconcileAll(context.Background()))
+	assert.Equal(t, len(u.cfgs), 1)
+	assert.Equal(t, u.cfgs[0].AppName, "example-app")
+	assert.Equal(t, u.cfgs[0].File, "example-app/values.yaml")
+	assert.Equal(t, u.cfgs[0].GitConf.File, "")
+	assert.Equal(t, u.cfgs[0].GitConf.RepoURL, "https://git.example.com/gitops.git")
+	assert.Equal(t, u.cfgs[0].GitConf.Branch, "main")
+	assert.DeepEqual(t, u.cfgs[0].UpdateApps, []updater.ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}})
+	status := s.policy(policy.ID()).Status
+	assert.Equal(t, status.ObservedGeneration, int64(1))
+	assert.Equal(t, status.LastSeenVersion, "1.1.0")
+	assert.Equal(t, status.LastAppliedVersion, "1.1.0")
+	assert.Equal(t, status.LastCommit, "commit-1.1.0")
+	assert.Assert(t, status.LastCheckTime != nil && status.LastUpdateTime != nil)
+	assert.Equal(t, status.Error, "")
+
+	// the policy is not checked again until its interval has elapsed
+	tags = append(tags, "1.2.0")
+	assert.NilError(t, c.ReconcileAll(context.Background()))
+	assert.Equal(t, s.patches, 1)
+
+	// the policy changed is checked right away, writing back to another branch of another repository
+	s.mu.Lock()
+	s.policies[policy.ID()].Metadata.Generation = 2
+	s.policies[policy.ID()].Spec.RepoURL = "https://git.example.com/other.git"
+	s.policies[policy.ID()].Spec.Branch = "develop"
+	s.policies[policy.ID()].Spec.WriteBack = WriteBack{Method: WriteBackBranch, Branch: "release"}
+	s.mu.Unlock()
+	assert.NilError(t, c.ReconcileAll(context.Background()))
+	assert.Equal(t, len(u.cfgs), 2)
+	assert.Equal(t, u.cfgs[1].GitConf.RepoURL, "https://git.example.com/other.git")
+	assert.Equal(t, u.cfgs[1].GitConf.Branch, "develop")
+	assert.Equal(t, u.cfgs[1].GitConf.PushBranch, "release")
+	assert.Equal(t, s.policy(policy.ID()).Status.LastCommit, "commit-1.2.0")
+	// the configuration of the controller is not modified
+	assert.Equal(t, c.cfg.Base.GitConf.RepoURL, "https://git.example.com/gitops.git")
+}
+
+func TestControllerReconcileNothingToUpdate(t *testing.T) {
+	policy := newTestPolicy("team-a", "example-app")
+	policy.Status = PolicyStatus{LastCommit: "commit-1.0.0"}
+	s, client := newTestAPIServer(t, policy)
+	u := &fakeUpdater{values: map[string]string{"https://git.example.com/gitops.git:example-app/values.yaml:.image.tag": "1.1.0"}}
+	tags := []string{"1.1.0"}
+	c := newTestController(t, client, u, &tags)
+
+	assert.NilError(t, c.ReconcileAll(context.Background()))
+	status := s.policy(policy.ID()).Status
+	assert.Equal(t, status.LastAppliedVersion, "1.1.0")
+	assert.Equal(t, status.LastCommit, "commit-1.0.0")
+	assert.Assert(t, status.LastUpdateTime == nil)
+}
+
+func TestControllerReconcileErrors(t *testing.T) {
+	tests := map[string]struct {
+		spec  func(spec *PolicySpec)
+		err   error
+		error string
+	}{
+		"repository not allowed": {
+			spec:  func(spec *PolicySpec) { spec.RepoURL = "https://attacker.example.com/gitops.git" },
+			error: "invalid spec: repository https://attacker.example.com/gitops.git is not allowed",
+		},
+		"invalid write-back method": {
+			spec:  func(spec *PolicySpec) { spec.WriteBack.Method = "pull-request" },
+			error: "invalid spec: invalid write-back method pull-request, it must be one of commit|branch",
+		},
+		"missing write-back branch": {
+			spec:  func(spec *PolicySpec) { spec.WriteBack.Method = WriteBackBranch },
+			error: "invalid spec: the write-back branch is required by the branch method",
+		},
+		"expression key": {
+			spec: func(spec *PolicySpec) {
+				spec.Key = `.x = load("/var/run/secrets/kubernetes.io/serviceaccount/token") | .image.tag`
+			},
+			error: "invalid spec: key .x = load",
+		},
+		"invalid interval": {
+			spec:  func(spec *PolicySpec) { spec.Interval = "often" },
+			error: "invalid spec: invalid interval often",
+		},
+		"invalid version": {
+			spec:  func(spec *PolicySpec) { spec.Version = "latest" },
+			error: "invalid spec: invalid version constraint latest",
+		},
+		"no eligible version": {
+			spec:  func(spec *PolicySpec) { spec.Version = ">=3.0.0" },
+			error: "no eligible version of image ghcr.io/docplanner/example-app found",
+		},
+		"update failed": {
+			spec:  func(spec *PolicySpec) {},
+			err:   errors.New("could not push changes"),
+			error: "could not push changes",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			policy := newTestPolicy("team-a", "example-app")
+			test.spec(&policy.Spec)
+			s, client := newTestAPIServer(t, policy)
+			u := &fakeUpdater{values: map[string]string{}, err: test.err}
+			tags := []string{"1.0.0"}
+			c := newTestController(t, client, u, &tags)
+
+			assert.NilError(t, c.ReconcileAll(context.Background()))
+			status := s.policy(policy.ID()).Status
+			assert.Assert(t, strings.Contains(status.Error, test.error), status.Error)
+			assert.Equal(t, status.LastAppliedVersion, "")
+			assert.Assert(t, status.LastCheckTime != nil)
+		})
+	}
+}
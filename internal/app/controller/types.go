@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/watch"
+)
+
+const (
+	// Group is the API group of the custom resources of the controller
+	Group = "helm-repo-updater.docplanner.com"
+	// Version is the API version of the custom resources of the controller
+	Version = "v1alpha1"
+	// Kind is the kind of the custom resource with the update policies
+	Kind = "ImageUpdatePolicy"
+	// Plural is the plural name of the custom resource with the update policies used in the API paths
+	Plural = "imageupdatepolicies"
+
+	// WriteBackCommit pushes the commit with the update to the branch of the policy
+	WriteBackCommit = "commit"
+	// WriteBackBranch pushes the commit with the update to the write-back branch, eg. to open a pull request from it
+	WriteBackBranch = "branch"
+)
+
+// ObjectMeta is the metadata of a resource used by the controller
+type ObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Generation      int64  `json:"generation,omitempty"`
+}
+
+// ImageUpdatePolicy is the custom resource setting the newest version of an image or a Helm chart
+// in a key of a values file of a git repository
+type ImageUpdatePolicy struct {
+	APIVersion string       `json:"apiVersion,omitempty"`
+	Kind       string       `json:"kind,omitempty"`
+	Metadata   ObjectMeta   `json:"metadata"`
+	Spec       PolicySpec   `json:"spec"`
+	Status     PolicyStatus `json:"status,omitempty"`
+}
+
+// PolicySpec is what the policy updates and with which versions
+type PolicySpec struct {
+	// RepoURL is the git repository updated, the repository of the controller is used if empty
+	RepoURL string `json:"repoURL,omitempty"`
+	// Branch is the branch of the git repository updated, the branch of the controller is used if empty
+	Branch string `json:"branch,omitempty"`
+	// File is the location of the values file in the git repository
+	File string `json:"file"`
+	// Key is the key of the values file updated, eg. .image.tag
+	Key string `json:"key"`
+	// Image is the repository of the image whose tags are polled, eg. ghcr.io/docplanner/example-app
+	Image string `json:"image,omitempty"`
+	// Chart is the name of the Helm chart whose versions are polled from the index of ChartRepository
+	Chart string `json:"chart,omitempty"`
+	// ChartRepository is the url of the Helm chart repository, eg. https://charts.example.com
+	ChartRepository string `json:"chartRepository,omitempty"`
+	// Tag is a regular expression the versions must match to be eligible, every version matches if empty
+	Tag string `json:"tag,omitempty"`
+	// Version is a constraint the semantic versions must satisfy to be eligible, eg. ^1.2
+	Version string `json:"version,omitempty"`
+	// Prerelease makes the semantic versions with a prerelease eligible, eg. 1.2.0-rc.1
+	Prerelease bool `json:"prerelease,omitempty"`
+	// Interval is the time between the polls of the versions, eg. 5m. The interval of the controller is used if empty
+	Interval string `json:"interval,omitempty"`
+	// WriteBack is how the update is written to the git repository
+	WriteBack WriteBack `json:"writeBack,omitempty"`
+}
+
+// WriteBack is how the update of a policy is written to the git repository
+type WriteBack struct {
+	// Method is one of commit|branch (default commit)
+	Method string `json:"method,omitempty"`
+	// Branch is the branch where the commit is pushed by the branch method
+	Branch string `json:"branch,omitempty"`
+}
+
+// PolicyStatus is the status of the policy recorded by the controller
+type PolicyStatus struct {
+	// ObservedGeneration is the generation of the policy checked last time
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSeenVersion is the newest eligible version found last time
+	LastSeenVersion string `json:"lastSeenVersion,omitempty"`
+	// LastAppliedVersion is the newest version known to be set in the key
+	LastAppliedVersion string `json:"lastAppliedVersion,omitempty"`
+	// LastCommit is the hash of the last commit made by the controller
+	LastCommit string `json:"lastCommit,omitempty"`
+	// LastCheckTime is the last time the versions were polled
+	LastCheckTime *time.Time `json:"lastCheckTime,omitempty"`
+	// LastUpdateTime is the last time the key was updated
+	LastUpdateTime *time.Time `json:"lastUpdateTime,omitempty"`
+	// Error is the error of the last check, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// policyList is the list of policies returned by the API
+type policyList struct {
+	Items []ImageUpdatePolicy `json:"items"`
+}
+
+// ID identifies the policy in the cluster
+func (p *ImageUpdatePolicy) ID() string {
+	return p.Metadata.Namespace + "/" + p.Metadata.Name
+}
+
+// source returns the source of the versions of the policy
+func (p *ImageUpdatePolicy) source(defaultInterval time.Duration) (*watch.Source, error) {
+	interval := defaultInterval
+	if p.Spec.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(p.Spec.Interval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %s", p.Spec.Interval)
+		}
+	}
+	source := &watch.Source{
+		Image:           p.Spec.Image,
+		Chart:           p.Spec.Chart,
+		ChartRepository: p.Spec.ChartRepository,
+		Tag:             p.Spec.Tag,
+		Version:         p.Spec.Version,
+		Prerelease:      p.Spec.Prerelease,
+		Interval:        interval,
+		App:             p.Metadata.Name,
+		File:            p.Spec.File,
+		Key:             p.Spec.Key,
+	}
+	if err := source.Compile(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
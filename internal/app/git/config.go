@@ -1,6 +1,11 @@
 package git
 
-import "text/template"
+import (
+	"text/template"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
 
 // DefaultGitCommitMessage is the default commit message build with the changes detected in the app
 const DefaultGitCommitMessage = `🚀 automatic update of {{ .AppName }}
@@ -9,10 +14,79 @@ updates key {{ .Key }} value from '{{ .OldValue }}' to '{{ .NewValue }}'
 {{ end -}}
 `
 
+// DefaultGitBatchCommitMessage is the default commit message build with the changes detected in several apps
+// updated in the same commit
+const DefaultGitBatchCommitMessage = `🚀 automatic update of {{ len .Apps }} applications
+{{ range .Apps -}}
+{{ .AppName }}:
+{{ range .KeyChanges }}  updates key {{ .Key }} value from '{{ .OldValue }}' to '{{ .NewValue }}'
+{{ end -}}
+{{ end -}}
+`
+
 // Conf is the configuration for the git client
 type Conf struct {
 	RepoURL string
 	Branch  string
 	File    string
 	Message *template.Template
+	// Author is the author of the commit, the committer is the author too if not set
+	Author Identity
+	// CommitDate is the date of the commit and the tag, the current time is used if zero
+	CommitDate time.Time
+	// Trailers are added to the trailer block of the commit message
+	Trailers []Trailer
+	// CreateBranch creates the branch from BaseRef when it doesn't exist in the remote repository
+	CreateBranch bool
+	// BaseRef is the branch, tag or commit SHA used to create the branch, the default branch if empty
+	BaseRef string
+	// ShallowClone clones only the latest commit of the branch to be updated
+	ShallowClone bool
+	// SparsePaths limits the files written in the working tree to the ones inside these paths
+	SparsePaths []string
+	// InMemory clones the repository in memory instead of in a temporal directory
+	InMemory bool
+	// CacheDir is the directory keeping mirrors of the repositories between runs, not used if empty
+	CacheDir string
+	// LocalRepo is the location of an existing checkout of the repository used instead of cloning it
+	LocalRepo string
+	// PushBranch is the branch where the changes are pushed, overwritten if it was not updated by others
+	// since it was read. Branch is used if empty
+	PushBranch string
+	// PushRepoURL is the repository where the changes are pushed, eg. a fork. RepoURL is used if empty
+	PushRepoURL string
+	// SkipPush commits the changes without pushing them to the remote repository
+	SkipPush bool
+	// Tag is the configuration of the tag created on the commit with the changes
+	Tag TagConf
+	// Timeouts are the maximum durations of the operations with the remote repository
+	Timeouts Timeouts
+}
+
+// PushURL returns the url of the repository where the changes are pushed, which is PushRepoURL
+// if it's set or RepoURL otherwise
+func (c Conf) PushURL() string {
+	if c.PushRepoURL != "" {
+		return c.PushRepoURL
+	}
+	return c.RepoURL
+}
+
+// TagConf is the configuration of the tag created on the commit with the changes and pushed with it
+type TagConf struct {
+	// NameTemplate renders the name of the tag with the same data as the commit message, no tag is created if nil
+	NameTemplate *template.Template
+	// Annotated creates an annotated tag with the commit message instead of a lightweight one
+	Annotated bool
+	// SignKey is the OpenPGP key used to sign the tag, which implies an annotated tag. The tag is not signed if nil
+	SignKey *openpgp.Entity
+}
+
+// Timeouts are the maximum durations of the operations with the remote git repository,
+// a zero value doesn't limit the duration of the operation
+type Timeouts struct {
+	Clone time.Duration
+	Fetch time.Duration
+	Pull  time.Duration
+	Push  time.Duration
 }
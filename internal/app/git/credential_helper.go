@@ -0,0 +1,85 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// credentialHelperCommand builds the command used to invoke a git credential helper
+// following the same rules as git: a helper starting with '!' is run as a shell
+// command, an absolute path is executed directly and any other value is run as
+// `git credential-<helper>`
+func credentialHelperCommand(helper string, action string) *exec.Cmd {
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		return exec.Command("sh", "-c", helper[1:]+" \"$@\"", helper[1:], action)
+	case filepath.IsAbs(helper):
+		return exec.Command(helper, action)
+	default:
+		return exec.Command("git", "credential-"+helper, action)
+	}
+}
+
+// credentialHelperInput generates the input expected by a git credential helper
+// for the provided repository url
+func credentialHelperInput(repoURL *url.URL) []byte {
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\n", repoURL.Scheme)
+	fmt.Fprintf(&input, "host=%s\n", repoURL.Host)
+	if repoPath := strings.TrimPrefix(repoURL.Path, "/"); repoPath != "" {
+		fmt.Fprintf(&input, "path=%s\n", repoPath)
+	}
+	if repoURL.User != nil && repoURL.User.Username() != "" {
+		fmt.Fprintf(&input, "username=%s\n", repoURL.User.Username())
+	}
+	input.WriteString("\n")
+	return input.Bytes()
+}
+
+// parseCredentialHelperOutput parses the key=value lines returned by a git credential helper
+func parseCredentialHelperOutput(output []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		keyValue := strings.SplitN(line, "=", 2)
+		if len(keyValue) != 2 {
+			continue
+		}
+		values[keyValue[0]] = keyValue[1]
+	}
+	return values
+}
+
+// runCredentialHelper obtains the username and password for the repository url
+// using the git credential helper protocol
+func runCredentialHelper(helper string, repoURL string) (string, string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	cmd := credentialHelperCommand(helper, "get")
+	cmd.Stdin = bytes.NewReader(credentialHelperInput(u))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("credential helper %s failed: %v: %s", helper, err, strings.TrimSpace(stderr.String()))
+	}
+
+	values := parseCredentialHelperOutput(output)
+	if values["username"] == "" || values["password"] == "" {
+		return "", "", fmt.Errorf("credential helper %s returned no credentials for host %s", helper, u.Host)
+	}
+
+	return values["username"], values["password"], nil
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"regexp"
 
@@ -24,6 +25,13 @@ type Credentials struct {
 	Email                string
 	SSHPrivKey           string
 	SSHPrivKeyFileInline bool
+	// CredentialHelper is the git credential helper used to resolve HTTPS credentials
+	// when no username and password are provided, e.g. "store" or "!my-helper"
+	CredentialHelper string
+	// UseNetrc enables the lookup of HTTPS credentials in the .netrc file
+	UseNetrc bool
+	// NetrcFile overrides the location of the .netrc file
+	NetrcFile string
 }
 
 // NewGitCreds returns credentials for use with go-git library
@@ -104,15 +112,60 @@ func generatAuthFor(username string, password string) *http.BasicAuth {
 }
 
 // from generate a valid credentials for go-git library using
-// username and passowrd
+// username and passowrd, resolving them with the credential helper or
+// the .netrc file when they are not provided
 func (c Credentials) from(repoURL string) (*http.BasicAuth, error) {
 	if c.allowsAuth() {
 		return generatAuthFor(c.Username, c.Password), nil
 	}
 
+	if c.CredentialHelper != "" {
+		username, password, err := runCredentialHelper(c.CredentialHelper, repoURL)
+		if err != nil {
+			return nil, err
+		}
+		// the password resolved is redacted from the logs like the one of the flags
+		log.AddSecret(password)
+		log.Debugf("Obtained credentials for repository %s using credential helper %s", repoURL, c.CredentialHelper)
+		return generatAuthFor(username, password), nil
+	}
+
+	if c.UseNetrc {
+		machine, err := c.fromNetrc(repoURL)
+		if err != nil {
+			return nil, err
+		}
+		return generatAuthFor(machine.Login, machine.Password), nil
+	}
+
 	return nil, UserAndPasswordNotProvided(repoURL)
 }
 
+// fromNetrc obtains the .netrc entry for the host of the repository url
+func (c Credentials) fromNetrc(repoURL string) (*netrcMachine, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	netrcFile := c.NetrcFile
+	if netrcFile == "" {
+		netrcFile, err = netrcFilePath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	machine, err := lookupNetrc(netrcFile, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if machine.Login == "" || machine.Password == "" {
+		return nil, UserAndPasswordNotProvided(repoURL)
+	}
+	log.AddSecret(machine.Password)
+	log.Debugf("Obtained credentials for repository %s from %s", repoURL, netrcFile)
+	return machine, nil
+}
+
 // allowSshAuth check if necessary attributes for generate an SSH
 // credentials are provided
 func (c Credentials) allowsSSHAuth() bool {
@@ -3,8 +3,11 @@ package git
 import (
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"testing"
 
+	app_log "github.com/docplanner/helm-repo-updater/internal/app/log"
 	app_utils "github.com/docplanner/helm-repo-updater/internal/app/utils"
 	"gotest.tools/assert"
 )
@@ -186,3 +189,87 @@ func TestNewCredsInvalidURL(t *testing.T) {
 
 	assert.Error(t, err, expectedErrorMessage)
 }
+
+func TestNewCredsHTTPSURLCredentialHelper(t *testing.T) {
+	defer app_log.ResetSecrets()
+
+	g := Credentials{
+		Email:            validGitCredentialsEmail,
+		CredentialHelper: fmt.Sprintf("!f() { echo username=%s; echo password=%s; }; f", validGitCredentialsUsername, validGitCredentialsPassword),
+	}
+
+	creds, err := g.NewGitCreds(validGitRepoHTTPSURL, g.Password)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	expectedCredsString := fmt.Sprintf("http-basic-auth - %s:*******", validGitCredentialsUsername)
+	assert.DeepEqual(t, creds.String(), expectedCredsString)
+	assert.Assert(t, !strings.Contains(app_log.Redact("password "+validGitCredentialsPassword), validGitCredentialsPassword))
+}
+
+func TestNewCredsHTTPSURLCredentialHelperWithoutCredentials(t *testing.T) {
+
+	g := Credentials{
+		Email:            validGitCredentialsEmail,
+		CredentialHelper: "!true",
+	}
+
+	_, err := g.NewGitCreds(validGitRepoHTTPSURL, g.Password)
+
+	expectedErrorMessage := "credential helper !true returned no credentials for host github.com"
+
+	assert.Error(t, err, expectedErrorMessage)
+}
+
+func TestNewCredsHTTPSURLNetrc(t *testing.T) {
+	defer app_log.ResetSecrets()
+
+	netrcFile, err := app_utils.CreateAndWriteContentInTempFile("netrc", fmt.Sprintf(
+		"machine gitlab.com login other-user password other-password\nmachine github.com\n\tlogin %s\n\tpassword %s\n",
+		validGitCredentialsUsername,
+		validGitCredentialsPassword,
+	))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(netrcFile.Name())
+
+	g := Credentials{
+		Email:     validGitCredentialsEmail,
+		UseNetrc:  true,
+		NetrcFile: netrcFile.Name(),
+	}
+
+	creds, err := g.NewGitCreds(validGitRepoHTTPSURL, g.Password)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	expectedCredsString := fmt.Sprintf("http-basic-auth - %s:*******", validGitCredentialsUsername)
+	assert.DeepEqual(t, creds.String(), expectedCredsString)
+	assert.Assert(t, !strings.Contains(app_log.Redact("password "+validGitCredentialsPassword), validGitCredentialsPassword))
+}
+
+func TestNewCredsHTTPSURLNetrcWithoutHost(t *testing.T) {
+
+	netrcFile, err := app_utils.CreateAndWriteContentInTempFile("netrc", "machine gitlab.com login other-user password other-password\n")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(netrcFile.Name())
+
+	g := Credentials{
+		Email:     validGitCredentialsEmail,
+		UseNetrc:  true,
+		NetrcFile: netrcFile.Name(),
+	}
+
+	_, err = g.NewGitCreds(validGitRepoHTTPSURL, g.Password)
+
+	expectedErrorMessage := fmt.Sprintf("no entry found for host github.com in %s", netrcFile.Name())
+
+	assert.Error(t, err, expectedErrorMessage)
+}
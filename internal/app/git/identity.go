@@ -0,0 +1,68 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Identity is the name and email identifying a person in the commits
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// IsZero checks if the identity is not set
+func (i Identity) IsZero() bool {
+	return i.Name == "" && i.Email == ""
+}
+
+// AuthorFromEnv returns the identity of the user who triggered the CI pipeline, obtained with getenv from the
+// variables set by git itself, GitLab CI, GitHub Actions or the Jenkins build user vars plugin, in this order.
+// It returns false if none of them is found
+func AuthorFromEnv(getenv func(string) string) (Identity, bool) {
+	candidates := []Identity{
+		{Name: getenv("GIT_AUTHOR_NAME"), Email: getenv("GIT_AUTHOR_EMAIL")},
+		{Name: getenv("GITLAB_USER_NAME"), Email: getenv("GITLAB_USER_EMAIL")},
+		githubActor(getenv),
+		{Name: getenv("BUILD_USER"), Email: getenv("BUILD_USER_EMAIL")},
+	}
+	for _, candidate := range candidates {
+		if candidate.Name != "" && candidate.Email != "" {
+			return candidate, true
+		}
+	}
+	return Identity{}, false
+}
+
+// githubActor returns the identity of the user who triggered the GitHub Actions workflow,
+// using the noreply email address assigned by GitHub to the user
+func githubActor(getenv func(string) string) Identity {
+	actor := getenv("GITHUB_ACTOR")
+	if actor == "" {
+		return Identity{}
+	}
+	email := actor + "@users.noreply.github.com"
+	if actorID := getenv("GITHUB_ACTOR_ID"); actorID != "" {
+		email = actorID + "+" + email
+	}
+	return Identity{Name: actor, Email: email}
+}
+
+// ParseCommitDate parses the date of a commit, which can be a RFC3339 date or a unix timestamp
+// prefixed by @ as in git, eg. @1700000000
+func ParseCommitDate(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "@") {
+		seconds, err := strconv.ParseInt(s[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid commit date %s, the unix timestamp must be a number of seconds", s)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	date, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid commit date %s, it must be a RFC3339 date or a unix timestamp prefixed by @", s)
+	}
+	return date, nil
+}
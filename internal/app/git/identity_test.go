@@ -0,0 +1,103 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestAuthorFromEnv(t *testing.T) {
+	tests := []struct {
+		name             string
+		env              map[string]string
+		expectedIdentity Identity
+		expectedFound    bool
+	}{
+		{
+			name: "git",
+			env: map[string]string{
+				"GIT_AUTHOR_NAME":   "git-user",
+				"GIT_AUTHOR_EMAIL":  "git-user@example.com",
+				"GITLAB_USER_NAME":  "gitlab-user",
+				"GITLAB_USER_EMAIL": "gitlab-user@example.com",
+			},
+			expectedIdentity: Identity{Name: "git-user", Email: "git-user@example.com"},
+			expectedFound:    true,
+		},
+		{
+			name: "gitlab",
+			env: map[string]string{
+				"GIT_AUTHOR_NAME":   "git-user",
+				"GITLAB_USER_NAME":  "gitlab-user",
+				"GITLAB_USER_EMAIL": "gitlab-user@example.com",
+			},
+			expectedIdentity: Identity{Name: "gitlab-user", Email: "gitlab-user@example.com"},
+			expectedFound:    true,
+		},
+		{
+			name: "github",
+			env: map[string]string{
+				"GITHUB_ACTOR":    "github-user",
+				"GITHUB_ACTOR_ID": "1234",
+			},
+			expectedIdentity: Identity{Name: "github-user", Email: "1234+github-user@users.noreply.github.com"},
+			expectedFound:    true,
+		},
+		{
+			name: "github without actor id",
+			env: map[string]string{
+				"GITHUB_ACTOR": "github-user",
+			},
+			expectedIdentity: Identity{Name: "github-user", Email: "github-user@users.noreply.github.com"},
+			expectedFound:    true,
+		},
+		{
+			name: "jenkins",
+			env: map[string]string{
+				"BUILD_USER":       "jenkins-user",
+				"BUILD_USER_EMAIL": "jenkins-user@example.com",
+			},
+			expectedIdentity: Identity{Name: "jenkins-user", Email: "jenkins-user@example.com"},
+			expectedFound:    true,
+		},
+		{
+			name: "not found",
+			env: map[string]string{
+				"BUILD_USER": "jenkins-user",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, found := AuthorFromEnv(func(key string) string { return tt.env[key] })
+			assert.Equal(t, found, tt.expectedFound)
+			assert.DeepEqual(t, identity, tt.expectedIdentity)
+		})
+	}
+}
+
+func TestParseCommitDate(t *testing.T) {
+	tests := []struct {
+		name          string
+		date          string
+		expectedDate  time.Time
+		expectedError string
+	}{
+		{name: "unix timestamp", date: "@1700000000", expectedDate: time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)},
+		{name: "RFC3339 date", date: "2023-11-14T23:13:20+01:00", expectedDate: time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)},
+		{name: "invalid unix timestamp", date: "@yesterday", expectedError: "invalid commit date @yesterday, the unix timestamp must be a number of seconds"},
+		{name: "invalid date", date: "2023-11-14", expectedError: "invalid commit date 2023-11-14, it must be a RFC3339 date or a unix timestamp prefixed by @"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, err := ParseCommitDate(tt.date)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, date.Equal(tt.expectedDate))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// netrcMachine represents a machine entry of a .netrc file
+type netrcMachine struct {
+	Name     string
+	Login    string
+	Password string
+}
+
+// netrcFilePath returns the location of the .netrc file, honoring the NETRC
+// environment variable like git and curl do
+func netrcFilePath() (string, error) {
+	if netrcEnv := os.Getenv("NETRC"); netrcEnv != "" {
+		return netrcEnv, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	netrcName := ".netrc"
+	if runtime.GOOS == "windows" {
+		netrcName = "_netrc"
+	}
+	return filepath.Join(home, netrcName), nil
+}
+
+// parseNetrc parses the content of a .netrc file, macdef definitions are skipped
+func parseNetrc(r io.Reader) ([]netrcMachine, error) {
+	var machines []netrcMachine
+	current := -1
+
+	scanner := bufio.NewScanner(r)
+	inMacdef := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacdef {
+			// a macro definition ends with an empty line
+			if line == "" {
+				inMacdef = false
+			}
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		for i := 0; i < len(tokens); i++ {
+			switch tokens[i] {
+			case "machine":
+				if i+1 >= len(tokens) {
+					return nil, fmt.Errorf("netrc: machine without name")
+				}
+				machines = append(machines, netrcMachine{Name: tokens[i+1]})
+				current = len(machines) - 1
+				i++
+			case "default":
+				machines = append(machines, netrcMachine{})
+				current = len(machines) - 1
+			case "login", "password", "account":
+				if i+1 >= len(tokens) {
+					return nil, fmt.Errorf("netrc: %s without value", tokens[i])
+				}
+				if current < 0 {
+					return nil, fmt.Errorf("netrc: %s found before machine", tokens[i])
+				}
+				if tokens[i] == "login" {
+					machines[current].Login = tokens[i+1]
+				} else if tokens[i] == "password" {
+					machines[current].Password = tokens[i+1]
+				}
+				i++
+			case "macdef":
+				inMacdef = true
+				i = len(tokens)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return machines, nil
+}
+
+// lookupNetrc returns the login and password configured for host in the
+// given .netrc file, falling back to the default entry if present
+func lookupNetrc(netrcFile string, host string) (*netrcMachine, error) {
+	f, err := os.Open(netrcFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	machines, err := parseNetrc(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultMachine *netrcMachine
+	for i := range machines {
+		if machines[i].Name == host {
+			return &machines[i], nil
+		}
+		if machines[i].Name == "" && defaultMachine == nil {
+			defaultMachine = &machines[i]
+		}
+	}
+	if defaultMachine != nil {
+		return defaultMachine, nil
+	}
+
+	return nil, fmt.Errorf("no entry found for host %s in %s", host, netrcFile)
+}
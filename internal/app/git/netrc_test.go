@@ -0,0 +1,32 @@
+package git
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseNetrc(t *testing.T) {
+	content := `machine github.com login test-user password test-password
+macdef init
+cd /pub
+login fake
+
+default login anonymous password guest
+`
+	machines, err := parseNetrc(strings.NewReader(content))
+	assert.NilError(t, err)
+
+	expectedMachines := []netrcMachine{
+		{Name: "github.com", Login: "test-user", Password: "test-password"},
+		{Name: "", Login: "anonymous", Password: "guest"},
+	}
+	assert.DeepEqual(t, machines, expectedMachines)
+}
+
+func TestParseNetrcLoginBeforeMachine(t *testing.T) {
+	_, err := parseNetrc(strings.NewReader("login test-user"))
+
+	assert.Error(t, err, "netrc: login found before machine")
+}
@@ -0,0 +1,45 @@
+package git
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// LoadSignKey reads the first OpenPGP private key of the armored key ring located in keyFile,
+// decrypting it with passphrase when it's protected by one
+func LoadSignKey(keyFile string, passphrase string) (*openpgp.Entity, error) {
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read sign key: %v", err)
+	}
+	defer f.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse sign key %s: %v", keyFile, err)
+	}
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("sign key %s doesn't contain a private key", keyFile)
+	}
+
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("sign key %s is protected by a passphrase", keyFile)
+		}
+		if err = entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("could not decrypt sign key %s: %v", keyFile, err)
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err = subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("could not decrypt sign key %s: %v", keyFile, err)
+			}
+		}
+	}
+
+	return entity, nil
+}
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"gotest.tools/assert"
+)
+
+// writeSignKey writes an armored private key protected by passphrase, if not empty, and returns its location
+func writeSignKey(t *testing.T, passphrase string) (string, *openpgp.Entity) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("test-user", "", "test-user@example.com", nil)
+	assert.NilError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "key.asc")
+	f, err := os.Create(keyFile)
+	assert.NilError(t, err)
+	defer f.Close()
+	w, err := armor.Encode(f, openpgp.PrivateKeyType, nil)
+	assert.NilError(t, err)
+	// the identities are signed before encrypting the keys
+	assert.NilError(t, entity.SerializePrivate(w, nil))
+	assert.NilError(t, w.Close())
+
+	if passphrase != "" {
+		_, err = f.Seek(0, 0)
+		assert.NilError(t, err)
+		entities, err := openpgp.ReadArmoredKeyRing(f)
+		assert.NilError(t, err)
+		encrypted := entities[0]
+		assert.NilError(t, encrypted.PrivateKey.Encrypt([]byte(passphrase)))
+		for _, subkey := range encrypted.Subkeys {
+			assert.NilError(t, subkey.PrivateKey.Encrypt([]byte(passphrase)))
+		}
+		assert.NilError(t, f.Truncate(0))
+		_, err = f.Seek(0, 0)
+		assert.NilError(t, err)
+		w, err = armor.Encode(f, openpgp.PrivateKeyType, nil)
+		assert.NilError(t, err)
+		assert.NilError(t, encrypted.SerializePrivateWithoutSigning(w, nil))
+		assert.NilError(t, w.Close())
+	}
+
+	return keyFile, entity
+}
+
+func TestLoadSignKey(t *testing.T) {
+	keyFile, entity := writeSignKey(t, "")
+
+	key, err := LoadSignKey(keyFile, "")
+	assert.NilError(t, err)
+	assert.Equal(t, key.PrimaryKey.KeyId, entity.PrimaryKey.KeyId)
+	assert.Assert(t, !key.PrivateKey.Encrypted)
+}
+
+func TestLoadSignKeyWithPassphrase(t *testing.T) {
+	keyFile, entity := writeSignKey(t, "test-passphrase")
+
+	key, err := LoadSignKey(keyFile, "test-passphrase")
+	assert.NilError(t, err)
+	assert.Equal(t, key.PrimaryKey.KeyId, entity.PrimaryKey.KeyId)
+	assert.Assert(t, !key.PrivateKey.Encrypted)
+
+	_, err = LoadSignKey(keyFile, "")
+	assert.Error(t, err, "sign key "+keyFile+" is protected by a passphrase")
+
+	_, err = LoadSignKey(keyFile, "invalid-passphrase")
+	assert.ErrorContains(t, err, "could not decrypt sign key")
+}
+
+func TestLoadSignKeyInvalid(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.asc")
+	assert.NilError(t, os.WriteFile(keyFile, []byte("invalid key"), 0600))
+
+	_, err := LoadSignKey(keyFile, "")
+	assert.ErrorContains(t, err, "could not parse sign key")
+
+	_, err = LoadSignKey(filepath.Join(t.TempDir(), "missing.asc"), "")
+	assert.ErrorContains(t, err, "could not read sign key")
+}
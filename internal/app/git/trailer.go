@@ -0,0 +1,84 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// trailerKey matches the keys accepted by git interpret-trailers
+var trailerKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// Trailer is a key-value pair in the trailer block at the end of a commit message,
+// eg. Co-authored-by: name <email>
+type Trailer struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// String returns the trailer as it's written in the commit message
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// ParseTrailer parses a trailer with the format key=value
+func ParseTrailer(s string) (Trailer, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return Trailer{}, fmt.Errorf("invalid trailer %s, it must have the format key=value", s)
+	}
+	t := Trailer{Key: strings.TrimSpace(kv[0]), Value: strings.TrimSpace(kv[1])}
+	if !trailerKey.MatchString(t.Key) {
+		return Trailer{}, fmt.Errorf("invalid trailer key '%s', only alphanumeric characters and dashes are allowed", t.Key)
+	}
+	if t.Value == "" || strings.ContainsAny(t.Value, "\r\n") {
+		return Trailer{}, fmt.Errorf("invalid value for trailer %s, it must be a non empty single line", t.Key)
+	}
+	return t, nil
+}
+
+// AppendTrailers adds the trailers to the trailer block of the commit message, which is
+// created as the last paragraph of the message if it doesn't have one yet
+func AppendTrailers(message string, trailers []Trailer) string {
+	if len(trailers) == 0 {
+		return message
+	}
+
+	message = strings.TrimRight(message, "\n")
+	if len(ParseTrailers(message)) > 0 {
+		message += "\n"
+	} else {
+		message += "\n\n"
+	}
+	for _, t := range trailers {
+		message += t.String() + "\n"
+	}
+	return message
+}
+
+// ParseTrailers returns the trailers of the commit message. As in git, the trailer block is the last
+// paragraph of the message, other than the subject, when all its lines are trailers or continuations
+// of the value of the previous trailer
+func ParseTrailers(message string) []Trailer {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(message, "\r\n", "\n")), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+
+	var trailers []Trailer
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if len(trailers) == 0 {
+				return nil
+			}
+			trailers[len(trailers)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || !trailerKey.MatchString(strings.TrimSpace(kv[0])) {
+			return nil
+		}
+		trailers = append(trailers, Trailer{Key: strings.TrimSpace(kv[0]), Value: strings.TrimSpace(kv[1])})
+	}
+	return trailers
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"testing"
+
+	"gotest.tools/assert"
+)
+
+func TestParseTrailer(t *testing.T) {
+	tests := []struct {
+		name            string
+		trailer         string
+		expectedTrailer Trailer
+		expectedError   string
+	}{
+		{name: "valid trailer", trailer: "Pipeline-URL=https://ci.example.com/pipelines/1", expectedTrailer: Trailer{Key: "Pipeline-URL", Value: "https://ci.example.com/pipelines/1"}},
+		{name: "value with equal sign", trailer: "Source-Commit=a=b", expectedTrailer: Trailer{Key: "Source-Commit", Value: "a=b"}},
+		{name: "spaces trimmed", trailer: " Co-authored-by = test-user <test-user@example.com> ", expectedTrailer: Trailer{Key: "Co-authored-by", Value: "test-user <test-user@example.com>"}},
+		{name: "missing value", trailer: "Change-Id", expectedError: "invalid trailer Change-Id, it must have the format key=value"},
+		{name: "empty value", trailer: "Change-Id=", expectedError: "invalid value for trailer Change-Id, it must be a non empty single line"},
+		{name: "multiline value", trailer: "Change-Id=a\nb", expectedError: "invalid value for trailer Change-Id, it must be a non empty single line"},
+		{name: "invalid key", trailer: "Change Id=1", expectedError: "invalid trailer key 'Change Id', only alphanumeric characters and dashes are allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trailer, err := ParseTrailer(tt.trailer)
+			if tt.expectedError != "" {
+				assert.Error(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, trailer, tt.expectedTrailer)
+		})
+	}
+}
+
+func TestAppendTrailers(t *testing.T) {
+	trailers := []Trailer{
+		{Key: "Change-Id", Value: "run-1"},
+		{Key: "Co-authored-by", Value: "test-user <test-user@example.com>"},
+	}
+
+	tests := []struct {
+		name            string
+		message         string
+		trailers        []Trailer
+		expectedMessage string
+	}{
+		{
+			name:            "no trailers",
+			message:         "update\n",
+			expectedMessage: "update\n",
+		},
+		{
+			name:            "subject only",
+			message:         "update\n",
+			trailers:        trailers,
+			expectedMessage: "update\n\nChange-Id: run-1\nCo-authored-by: test-user <test-user@example.com>\n",
+		},
+		{
+			name:            "subject with body lines",
+			message:         "update\nupdates key .image.tag value from '1.0.0' to '1.1.0'\n",
+			trailers:        trailers,
+			expectedMessage: "update\nupdates key .image.tag value from '1.0.0' to '1.1.0'\n\nChange-Id: run-1\nCo-authored-by: test-user <test-user@example.com>\n",
+		},
+		{
+			name:            "existing trailer block",
+			message:         "update\n\nbody\n\nSigned-off-by: test-user <test-user@example.com>\n",
+			trailers:        trailers[:1],
+			expectedMessage: "update\n\nbody\n\nSigned-off-by: test-user <test-user@example.com>\nChange-Id: run-1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, AppendTrailers(tt.message, tt.trailers), tt.expectedMessage)
+		})
+	}
+}
+
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		name             string
+		message          string
+		expectedTrailers []Trailer
+	}{
+		{name: "subject only", message: "Change-Id: run-1\n"},
+		{name: "no trailer block", message: "update\n\nthe image: 1.1.0 has been released\n"},
+		{
+			name:    "trailer block",
+			message: "update\n\nbody\n\nChange-Id: run-1\nPipeline-URL: https://ci.example.com/pipelines/1\n",
+			expectedTrailers: []Trailer{
+				{Key: "Change-Id", Value: "run-1"},
+				{Key: "Pipeline-URL", Value: "https://ci.example.com/pipelines/1"},
+			},
+		},
+		{
+			name:             "continuation lines",
+			message:          "update\n\nSource-Commit: first\n  second\n",
+			expectedTrailers: []Trailer{{Key: "Source-Commit", Value: "first second"}},
+		},
+		{name: "mixed block", message: "update\n\nChange-Id: run-1\nnot a trailer\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.DeepEqual(t, ParseTrailers(tt.message), tt.expectedTrailers)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package git
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TransportConf contains the configuration of the HTTP transport used to
+// communicate with git servers using HTTP(S) urls
+type TransportConf struct {
+	// CAFile is the location of a PEM bundle with additional CAs trusted for TLS connections
+	CAFile string
+	// InsecureSkipTLSVerify disables the verification of the TLS certificate of the git server
+	InsecureSkipTLSVerify bool
+	// ClientCertFile is the location of the PEM client certificate used for mTLS
+	ClientCertFile string
+	// ClientKeyFile is the location of the PEM private key of the client certificate used for mTLS
+	ClientKeyFile string
+}
+
+// tlsConfig generates the TLS configuration for the transport
+func (t TransportConf) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		// #nosec G402 -- explicitly requested by the user
+		InsecureSkipVerify: t.InsecureSkipTLSVerify,
+	}
+
+	if t.CAFile != "" {
+		caBundle, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %v", err)
+		}
+		certPool, err := x509.SystemCertPool()
+		if err != nil || certPool == nil {
+			certPool = x509.NewCertPool()
+		}
+		if !certPool.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no valid certificates found in CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = certPool
+	}
+
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		if t.ClientCertFile == "" || t.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both client certificate and client key must be provided for mTLS")
+		}
+		clientCert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewHTTPClient returns an HTTP client configured with the TLS settings of the transport
+// which honors the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables
+func (t TransportConf) NewHTTPClient() (*http.Client, error) {
+	tlsConfig, err := t.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxyFunc := httpproxy.FromEnvironment().ProxyFunc()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// Install registers the configured HTTP client as the one used by go-git
+// for the http and https protocols. The protocols are registered globally, so
+// it must be installed once at startup instead of for each operation
+func (t TransportConf) Install() error {
+	httpClient, err := t.NewHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	if t.InsecureSkipTLSVerify {
+		log.Warnf("TLS certificate verification of git server is disabled")
+	}
+
+	gitClient := githttp.NewClient(httpClient)
+	client.InstallProtocol("https", gitClient)
+	client.InstallProtocol("http", gitClient)
+
+	return nil
+}
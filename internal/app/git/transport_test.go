@@ -0,0 +1,207 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gotest.tools/assert"
+)
+
+const testRepositoryName = "test-repo.git"
+
+// newTestGitHTTPServer creates a bare repository with a single commit and returns
+// an unstarted server exposing it with the git smart HTTP protocol
+func newTestGitHTTPServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git binary is required to run the git HTTP server stand-in")
+	}
+
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	for _, args := range [][]string{
+		{"init", "-q", src},
+		{"-C", src, "-c", "user.name=test-user", "-c", "user.email=test-user@docplanner.com", "commit", "-q", "--allow-empty", "-m", "initial commit"},
+		{"clone", "-q", "--bare", src, filepath.Join(root, testRepositoryName)},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+
+	return httptest.NewUnstartedServer(&cgi.Handler{
+		Path: gitBin,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	})
+}
+
+// writePEMFile writes a PEM block in a file inside dir and returns its location
+func writePEMFile(t *testing.T, dir string, name string, blockType string, content []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content}), 0600)
+	assert.NilError(t, err)
+	return file
+}
+
+// generateClientCertificate generates a self signed client certificate, returning
+// the certificate and the location of the certificate and key files
+func generateClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: validGitCredentialsUsername},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+
+	dir := t.TempDir()
+	return cert, writePEMFile(t, dir, "client.crt", "CERTIFICATE", der), writePEMFile(t, dir, "client.key", "EC PRIVATE KEY", keyDer)
+}
+
+// cloneWithTransport installs the transport and clones the test repository served by server
+func cloneWithTransport(t *testing.T, transportConf TransportConf, server *httptest.Server) error {
+	t.Helper()
+	t.Cleanup(func() {
+		client.InstallProtocol("https", githttp.DefaultClient)
+		client.InstallProtocol("http", githttp.DefaultClient)
+	})
+	if err := transportConf.Install(); err != nil {
+		return err
+	}
+	_, err := gogit.PlainClone(t.TempDir(), false, &gogit.CloneOptions{
+		URL: server.URL + "/" + testRepositoryName,
+	})
+	return err
+}
+
+func TestTransportCloneWithCAFile(t *testing.T) {
+	server := newTestGitHTTPServer(t)
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writePEMFile(t, t.TempDir(), "ca.crt", "CERTIFICATE", server.Certificate().Raw)
+
+	err := cloneWithTransport(t, TransportConf{CAFile: caFile}, server)
+
+	assert.NilError(t, err)
+}
+
+func TestTransportCloneWithoutCAFile(t *testing.T) {
+	server := newTestGitHTTPServer(t)
+	server.StartTLS()
+	defer server.Close()
+
+	err := cloneWithTransport(t, TransportConf{}, server)
+
+	assert.ErrorContains(t, err, "x509")
+}
+
+func TestTransportCloneInsecureSkipTLSVerify(t *testing.T) {
+	server := newTestGitHTTPServer(t)
+	server.StartTLS()
+	defer server.Close()
+
+	err := cloneWithTransport(t, TransportConf{InsecureSkipTLSVerify: true}, server)
+
+	assert.NilError(t, err)
+}
+
+func TestTransportCloneWithClientCertificate(t *testing.T) {
+	clientCert, clientCertFile, clientKeyFile := generateClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := newTestGitHTTPServer(t)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writePEMFile(t, t.TempDir(), "ca.crt", "CERTIFICATE", server.Certificate().Raw)
+
+	err := cloneWithTransport(t, TransportConf{CAFile: caFile}, server)
+	assert.Assert(t, err != nil)
+
+	err = cloneWithTransport(t, TransportConf{
+		CAFile:         caFile,
+		ClientCertFile: clientCertFile,
+		ClientKeyFile:  clientKeyFile,
+	}, server)
+	assert.NilError(t, err)
+}
+
+func TestTransportClientCertificateWithoutKey(t *testing.T) {
+	_, clientCertFile, _ := generateClientCertificate(t)
+
+	_, err := TransportConf{ClientCertFile: clientCertFile}.NewHTTPClient()
+
+	assert.Error(t, err, "both client certificate and client key must be provided for mTLS")
+}
+
+func TestTransportInvalidCAFile(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	assert.NilError(t, os.WriteFile(caFile, []byte("invalid"), 0600))
+
+	_, err := TransportConf{CAFile: caFile}.NewHTTPClient()
+
+	assert.Error(t, err, "no valid certificates found in CA file "+caFile)
+}
+
+func TestTransportProxyFromEnvironment(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.docplanner.com:3128")
+	t.Setenv("NO_PROXY", "internal.docplanner.com")
+
+	httpClient, err := TransportConf{}.NewHTTPClient()
+	assert.NilError(t, err)
+	proxy := httpClient.Transport.(*http.Transport).Proxy
+
+	req, err := http.NewRequest(http.MethodGet, validGitRepoHTTPSURL, nil)
+	assert.NilError(t, err)
+	proxyURL, err := proxy(req)
+	assert.NilError(t, err)
+	assert.Equal(t, proxyURL.String(), "http://proxy.docplanner.com:3128")
+
+	req, err = http.NewRequest(http.MethodGet, "https://internal.docplanner.com/repo.git", nil)
+	assert.NilError(t, err)
+	proxyURL, err = proxy(req)
+	assert.NilError(t, err)
+	assert.Assert(t, proxyURL == nil)
+}
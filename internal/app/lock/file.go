@@ -0,0 +1,68 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/gofrs/flock"
+)
+
+// defaultRetryDelay is the time waited between attempts to acquire a lock held by other process
+const defaultRetryDelay = time.Second
+
+// FileBackend stores the locks as files of a directory shared by the processes,
+// it is only valid for processes running in the same machine
+type FileBackend struct {
+	Dir        string
+	RetryDelay time.Duration
+}
+
+// fileLock is a lock acquired from the FileBackend
+type fileLock struct {
+	flock *flock.Flock
+}
+
+var _ Backend = &FileBackend{}
+
+// NewFileBackend returns a backend storing the locks in dir, creating the directory if it doesn't exist
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create lock directory: %v", err)
+	}
+	return &FileBackend{Dir: dir, RetryDelay: defaultRetryDelay}, nil
+}
+
+// LockPath returns the location of the lock file of repoURL
+func (b *FileBackend) LockPath(repoURL string) string {
+	sum := sha256.Sum256([]byte(repoURL))
+	return filepath.Join(b.Dir, hex.EncodeToString(sum[:16])+".lock")
+}
+
+// Acquire takes an exclusive lock over the lock file of the repository
+func (b *FileBackend) Acquire(ctx context.Context, repoURL string, _ transport.AuthMethod) (Lock, error) {
+	lockPath := b.LockPath(repoURL)
+	log.FromContext(ctx).AddField(log.FieldRepo, log.RedactURL(repoURL)).Debugf("Acquiring lock file %s", lockPath)
+
+	fl := flock.New(lockPath)
+	if _, err := fl.TryLockContext(ctx, b.RetryDelay); err != nil {
+		return nil, fmt.Errorf("could not acquire lock file %s: %v", lockPath, err)
+	}
+	return &fileLock{flock: fl}, nil
+}
+
+// Release unlocks the lock file
+func (l *fileLock) Release(_ context.Context) error {
+	return l.flock.Unlock()
+}
+
+// Lost returns a nil channel, as the lock file is held until it's released or the process exits
+func (l *fileLock) Lost() <-chan struct{} {
+	return nil
+}
@@ -0,0 +1,35 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const testRepoURL = "https://github.com/docplanner/helm-repo-updater.git"
+
+func TestFileBackend(t *testing.T) {
+	backend, err := NewFileBackend(t.TempDir())
+	assert.NilError(t, err)
+	backend.RetryDelay = 10 * time.Millisecond
+
+	l, err := backend.Acquire(context.Background(), testRepoURL, nil)
+	assert.NilError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = backend.Acquire(ctx, testRepoURL, nil)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+
+	// the locks of other repositories are independent
+	other, err := backend.Acquire(context.Background(), "https://github.com/docplanner/other.git", nil)
+	assert.NilError(t, err)
+	assert.NilError(t, other.Release(context.Background()))
+
+	assert.NilError(t, l.Release(context.Background()))
+	l, err = backend.Acquire(context.Background(), testRepoURL, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, l.Release(context.Background()))
+}
@@ -0,0 +1,369 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+const (
+	// DefaultLockRef is the reference of the git repository used as lock by default
+	DefaultLockRef = "refs/locks/helm-repo-updater"
+	// DefaultTTL is the time after which a lock not released is considered abandoned by default
+	DefaultTTL = 10 * time.Minute
+
+	lockRemoteName    = "origin"
+	lockOwnerTrailer  = "Owner: "
+	lockExpiryTrailer = "Expires: "
+)
+
+// GitRefBackend stores the locks as a reference of the git repository itself, created and removed
+// with pushes which only succeed if the reference has not been changed by other process in the meantime,
+// so it is valid for processes running in different machines. A lock not released after its TTL is
+// considered abandoned and can be taken over by other process, so the locks held are renewed every
+// RenewInterval until they are released
+type GitRefBackend struct {
+	Ref           plumbing.ReferenceName
+	TTL           time.Duration
+	Owner         string
+	RetryDelay    time.Duration
+	RenewInterval time.Duration
+}
+
+// gitRefLock is a lock acquired from the GitRefBackend
+type gitRefLock struct {
+	backend *GitRefBackend
+	repo    *git.Repository
+	auth    transport.AuthMethod
+	// hash and expires are the lock commit and its expiry time, updated by the renewals
+	hash    plumbing.Hash
+	expires time.Time
+	// stop stops the renewals, done is closed once they are stopped and lost if the lock is lost
+	stop chan struct{}
+	done chan struct{}
+	lost chan struct{}
+}
+
+var _ Backend = &GitRefBackend{}
+
+// NewGitRefBackend returns a backend using ref as lock, held at most during ttl
+func NewGitRefBackend(ref string, ttl time.Duration) (*GitRefBackend, error) {
+	refName := plumbing.ReferenceName(ref)
+	if !strings.HasPrefix(ref, "refs/") || refName.IsBranch() || refName.IsTag() {
+		return nil, fmt.Errorf("invalid lock ref %s, it must be inside refs/ and outside branches and tags", ref)
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lock ttl %s, it must be positive", ttl)
+	}
+	return &GitRefBackend{
+		Ref:        refName,
+		TTL:        ttl,
+		Owner:      defaultOwner(),
+		RetryDelay: defaultRetryDelay,
+		// the lock can't be renewed twice before it's lost
+		RenewInterval: ttl / 3,
+	}, nil
+}
+
+// Acquire pushes the lock reference to the repository, waiting until it is released
+// or expires when it is held by other process
+func (b *GitRefBackend) Acquire(ctx context.Context, repoURL string, auth transport.AuthMethod) (Lock, error) {
+	ctx = log.ContextWithField(ctx, log.FieldRepo, log.RedactURL(repoURL))
+	logCtx := log.FromContext(ctx)
+
+	// the lock commits are built in memory, the lock reference is the only object pushed
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = repo.CreateRemote(&config.RemoteConfig{Name: lockRemoteName, URLs: []string{repoURL}}); err != nil {
+		return nil, err
+	}
+
+	for {
+		hash, expires, err := b.tryAcquire(ctx, repo, auth)
+		if err != nil {
+			return nil, fmt.Errorf("could not acquire lock %s: %v", b.Ref, err)
+		}
+		if hash != nil {
+			logCtx.Debugf("Acquired lock %s as %s", b.Ref, b.Owner)
+			l := &gitRefLock{
+				backend: b,
+				repo:    repo,
+				auth:    auth,
+				hash:    *hash,
+				expires: expires,
+				stop:    make(chan struct{}),
+				done:    make(chan struct{}),
+				lost:    make(chan struct{}),
+			}
+			if b.RenewInterval > 0 {
+				go l.renew(ctx)
+			} else {
+				close(l.done)
+			}
+			return l, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("could not acquire lock %s: %v", b.Ref, ctx.Err())
+		case <-time.After(b.RetryDelay):
+		}
+	}
+}
+
+// tryAcquire pushes a new lock commit if the lock reference doesn't exist or is expired,
+// returning its hash and expiry time or nil if the lock is held by other process
+func (b *GitRefBackend) tryAcquire(ctx context.Context, repo *git.Repository, auth transport.AuthMethod) (*plumbing.Hash, time.Time, error) {
+	logCtx := log.FromContext(ctx).AddField("lock", b.Ref.String())
+
+	current, err := remoteLockRef(ctx, repo, b.Ref, auth)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	pushOptions := &git.PushOptions{
+		RemoteName: lockRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", b.Ref, b.Ref))},
+		Auth:       auth,
+	}
+	if current != nil {
+		owner, expires, err := readLockCommit(ctx, repo, b.Ref, auth)
+		if err != nil {
+			// the lock can be released by its owner before it is read
+			if lockChanged(ctx, repo, b.Ref, auth, current) {
+				return nil, time.Time{}, nil
+			}
+			return nil, time.Time{}, err
+		}
+		if time.Now().Before(expires) {
+			logCtx.Infof("Lock is held by %s until %s, waiting", owner, expires.Format(time.RFC3339))
+			return nil, time.Time{}, nil
+		}
+		logCtx.Warnf("Lock held by %s expired at %s, taking it over", owner, expires.Format(time.RFC3339))
+		// the takeover only succeeds if nobody has taken over the expired lock before
+		pushOptions.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", b.Ref, b.Ref))}
+		pushOptions.RequireRemoteRefs = []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", current.Hash(), b.Ref))}
+	}
+
+	expires := time.Now().Add(b.TTL)
+	hash, err := storeLockCommit(repo, b.Owner, expires)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if err = repo.Storer.SetReference(plumbing.NewHashReference(b.Ref, hash)); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if err = repo.PushContext(ctx, pushOptions); err != nil {
+		// the push is rejected if other process has changed the lock in the meantime
+		if isPushRejected(err, b.Ref) || lockChanged(ctx, repo, b.Ref, auth, current) {
+			logCtx.Debugf("Lock was changed by other process, retrying: %v", err)
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	return &hash, expires, nil
+}
+
+// renew renews the lock every RenewInterval until it's released, pushing a lock commit with a later expiry
+// time. The lock is lost if it's taken over by other process, or if it couldn't be renewed and it would
+// expire before the next renewal. Only the log fields of ctx are used, the renewals outlive its cancellation
+func (l *gitRefLock) renew(ctx context.Context) {
+	defer close(l.done)
+	logCtx := log.FromContext(ctx).AddField("lock", l.backend.Ref.String())
+
+	ticker := time.NewTicker(l.backend.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		err := l.renewOnce()
+		switch {
+		case err == nil:
+			continue
+		case isPushRejected(err, l.backend.Ref):
+			logCtx.Errorf("Lock was taken over by other process: %v", err)
+		case time.Until(l.expires) > l.backend.RenewInterval:
+			logCtx.Warnf("Could not renew lock, retrying: %v", err)
+			continue
+		default:
+			logCtx.Errorf("Could not renew lock before it expires at %s: %v", l.expires.Format(time.RFC3339), err)
+		}
+		close(l.lost)
+		return
+	}
+}
+
+// renewOnce replaces the lock commit by other with a later expiry time, if the lock has not been taken over
+func (l *gitRefLock) renewOnce() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.backend.RenewInterval)
+	defer cancel()
+
+	expires := time.Now().Add(l.backend.TTL)
+	hash, err := storeLockCommit(l.repo, l.backend.Owner, expires)
+	if err != nil {
+		return err
+	}
+	if err = l.repo.Storer.SetReference(plumbing.NewHashReference(l.backend.Ref, hash)); err != nil {
+		return err
+	}
+	err = l.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName:        lockRemoteName,
+		RefSpecs:          []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", l.backend.Ref, l.backend.Ref))},
+		RequireRemoteRefs: []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", l.hash, l.backend.Ref))},
+		Auth:              l.auth,
+	})
+	// the lock commit is the same if it's renewed in the same second
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	l.hash, l.expires = hash, expires
+	return nil
+}
+
+// Lost returns a channel closed when the lock is lost because it could not be renewed
+func (l *gitRefLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops the renewals of the lock and removes the lock reference if it has not been taken over
+// by other process
+func (l *gitRefLock) Release(ctx context.Context) error {
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	<-l.done
+
+	err := l.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName:        lockRemoteName,
+		RefSpecs:          []config.RefSpec{config.RefSpec(":" + l.backend.Ref.String())},
+		RequireRemoteRefs: []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", l.hash, l.backend.Ref))},
+		Auth:              l.auth,
+	})
+	if err != nil {
+		return fmt.Errorf("could not release lock %s: %v", l.backend.Ref, err)
+	}
+	return nil
+}
+
+// remoteLockRef returns the lock reference of the remote repository or nil if it doesn't exist
+func remoteLockRef(ctx context.Context, repo *git.Repository, ref plumbing.ReferenceName, auth transport.AuthMethod) (*plumbing.Reference, error) {
+	remote, err := repo.Remote(lockRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, err
+	}
+	for _, r := range refs {
+		if r.Name() == ref {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// isPushRejected returns true if the push failed because the lock reference of the remote repository
+// was not the expected one, either when checked by the client or when updated by the server
+func isPushRejected(err error, ref plumbing.ReferenceName) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "non-fast-forward update: "+ref.String()) ||
+		strings.HasPrefix(msg, "command error on "+ref.String()) ||
+		strings.HasPrefix(msg, "remote ref "+ref.String()+" required to be")
+}
+
+// lockChanged returns true if the lock reference of the remote repository doesn't point to
+// the same lock commit as previous anymore, being nil previous if the lock reference didn't exist
+func lockChanged(ctx context.Context, repo *git.Repository, ref plumbing.ReferenceName, auth transport.AuthMethod, previous *plumbing.Reference) bool {
+	latest, err := remoteLockRef(ctx, repo, ref, auth)
+	if err != nil {
+		return false
+	}
+	if previous == nil || latest == nil {
+		return previous != latest
+	}
+	return previous.Hash() != latest.Hash()
+}
+
+// storeLockCommit stores a commit with an empty tree and the owner and expiry time of the lock as trailers
+func storeLockCommit(repo *git.Repository, owner string, expires time.Time) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	treeObj := repo.Storer.NewEncodedObject()
+	if err := tree.Encode(treeObj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	treeHash, err := repo.Storer.SetEncodedObject(treeObj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	signature := object.Signature{Name: owner, Email: "helm-repo-updater", When: time.Now()}
+	commit := &object.Commit{
+		Author:    signature,
+		Committer: signature,
+		Message:   fmt.Sprintf("helm-repo-updater lock\n\n%s%s\n%s%s\n", lockOwnerTrailer, owner, lockExpiryTrailer, expires.UTC().Format(time.RFC3339)),
+		TreeHash:  treeHash,
+	}
+	commitObj := repo.Storer.NewEncodedObject()
+	if err = commit.Encode(commitObj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(commitObj)
+}
+
+// readLockCommit fetches the lock commit of the remote repository and returns its owner and expiry time
+func readLockCommit(ctx context.Context, repo *git.Repository, ref plumbing.ReferenceName, auth transport.AuthMethod) (string, time.Time, error) {
+	err := repo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: lockRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", ref, ref))},
+		Auth:       auth,
+		Force:      true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", time.Time{}, err
+	}
+	lockRef, err := repo.Reference(ref, false)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	commit, err := repo.CommitObject(lockRef.Hash())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var owner string
+	var expires time.Time
+	for _, line := range strings.Split(commit.Message, "\n") {
+		switch {
+		case strings.HasPrefix(line, lockOwnerTrailer):
+			owner = strings.TrimPrefix(line, lockOwnerTrailer)
+		case strings.HasPrefix(line, lockExpiryTrailer):
+			if expires, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, lockExpiryTrailer)); err != nil {
+				return "", time.Time{}, fmt.Errorf("invalid expiry time of lock %s: %v", ref, err)
+			}
+		}
+	}
+	if expires.IsZero() {
+		return "", time.Time{}, fmt.Errorf("lock %s doesn't have an expiry time", ref)
+	}
+	return owner, expires, nil
+}
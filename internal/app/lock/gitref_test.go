@@ -0,0 +1,208 @@
+package lock
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"gotest.tools/v3/assert"
+)
+
+// newBareRepository creates an empty bare repository and returns its location
+func newBareRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary is required to create the repository")
+	}
+	repo := filepath.Join(t.TempDir(), "repo.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %v: %s", err, out)
+	}
+	return repo
+}
+
+// lockRefHash returns the hash of the lock reference of the repository or an empty string if it doesn't exist
+func lockRefHash(t *testing.T, repo string) string {
+	t.Helper()
+	out, _ := exec.Command("git", "-C", repo, "rev-parse", "--verify", "-q", DefaultLockRef).Output()
+	return strings.TrimSpace(string(out))
+}
+
+// newTestGitRefBackend returns a git ref backend with a short retry delay
+func newTestGitRefBackend(t *testing.T, owner string, ttl time.Duration) *GitRefBackend {
+	t.Helper()
+	backend, err := NewGitRefBackend(DefaultLockRef, ttl)
+	assert.NilError(t, err)
+	backend.Owner = owner
+	backend.RetryDelay = 10 * time.Millisecond
+	return backend
+}
+
+func TestNewGitRefBackendInvalid(t *testing.T) {
+	_, err := NewGitRefBackend("refs/heads/lock", DefaultTTL)
+	assert.Error(t, err, "invalid lock ref refs/heads/lock, it must be inside refs/ and outside branches and tags")
+
+	_, err = NewGitRefBackend(DefaultLockRef, 0)
+	assert.Error(t, err, "invalid lock ttl 0s, it must be positive")
+}
+
+func TestGitRefBackend(t *testing.T) {
+	repo := newBareRepository(t)
+	backend := newTestGitRefBackend(t, "first", DefaultTTL)
+
+	l, err := backend.Acquire(context.Background(), repo, nil)
+	assert.NilError(t, err)
+	assert.Assert(t, lockRefHash(t, repo) != "")
+	out, err := exec.Command("git", "-C", repo, "log", "-1", "--format=%B", DefaultLockRef).Output()
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(out), "Owner: first\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = newTestGitRefBackend(t, "second", DefaultTTL).Acquire(ctx, repo, nil)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+
+	assert.NilError(t, l.Release(context.Background()))
+	assert.Equal(t, lockRefHash(t, repo), "")
+
+	l, err = newTestGitRefBackend(t, "second", DefaultTTL).Acquire(context.Background(), repo, nil)
+	assert.NilError(t, err)
+	assert.NilError(t, l.Release(context.Background()))
+}
+
+func TestGitRefBackendExpiredLock(t *testing.T) {
+	repo := newBareRepository(t)
+
+	// the lock is not renewed, as if its owner had been killed
+	abandoned := newTestGitRefBackend(t, "first", time.Millisecond)
+	abandoned.RenewInterval = 0
+	expired, err := abandoned.Acquire(context.Background(), repo, nil)
+	assert.NilError(t, err)
+	time.Sleep(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	l, err := newTestGitRefBackend(t, "second", DefaultTTL).Acquire(ctx, repo, nil)
+	assert.NilError(t, err)
+
+	// the owner of the expired lock can't release the lock taken over
+	err = expired.Release(context.Background())
+	assert.ErrorContains(t, err, "could not release lock "+DefaultLockRef)
+	assert.Assert(t, lockRefHash(t, repo) != "")
+
+	assert.NilError(t, l.Release(context.Background()))
+	assert.Equal(t, lockRefHash(t, repo), "")
+}
+
+func TestGitRefBackendRenew(t *testing.T) {
+	repo := newBareRepository(t)
+	backend := newTestGitRefBackend(t, "first", 2*time.Second)
+	backend.RenewInterval = 200 * time.Millisecond
+
+	l, err := backend.Acquire(context.Background(), repo, nil)
+	assert.NilError(t, err)
+	time.Sleep(3 * time.Second)
+
+	// the lock is held after its ttl because it's renewed
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = newTestGitRefBackend(t, "second", DefaultTTL).Acquire(ctx, repo, nil)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+
+	select {
+	case <-l.Lost():
+		t.Fatal("lock renewed was lost")
+	default:
+	}
+	assert.NilError(t, l.Release(context.Background()))
+	assert.Equal(t, lockRefHash(t, repo), "")
+}
+
+func TestGitRefBackendLost(t *testing.T) {
+	repo := newBareRepository(t)
+	backend := newTestGitRefBackend(t, "first", DefaultTTL)
+	backend.RenewInterval = 50 * time.Millisecond
+
+	l, err := backend.Acquire(context.Background(), repo, nil)
+	assert.NilError(t, err)
+	// the lock is removed by other process, so it can't be renewed
+	if out, err := exec.Command("git", "-C", repo, "update-ref", "-d", DefaultLockRef).CombinedOutput(); err != nil {
+		t.Fatalf("git update-ref failed: %v: %s", err, out)
+	}
+
+	select {
+	case <-l.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock taken over was not lost")
+	}
+	assert.ErrorContains(t, l.Release(context.Background()), "could not release lock "+DefaultLockRef)
+}
+
+func TestGitRefBackendConcurrentAcquire(t *testing.T) {
+	repo := newBareRepository(t)
+
+	var holders, maxHolders int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			l, err := newTestGitRefBackend(t, owner, DefaultTTL).Acquire(ctx, repo, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			current := atomic.AddInt32(&holders, 1)
+			for {
+				max := atomic.LoadInt32(&maxHolders)
+				if current <= max || atomic.CompareAndSwapInt32(&maxHolders, max, current) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			if err = l.Release(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}(string(rune('a' + i)))
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxHolders, int32(1))
+	assert.Equal(t, lockRefHash(t, repo), "")
+}
+
+func TestGitRefBackendLostLogFields(t *testing.T) {
+	repo := newBareRepository(t)
+	backend := newTestGitRefBackend(t, "first", DefaultTTL)
+	backend.RenewInterval = 50 * time.Millisecond
+
+	// the renewals are logged with the fields of the run which acquired the lock, even once it's cancelled
+	ctx, cancel := context.WithCancel(log.ContextWithRunID(context.Background(), "test-run"))
+	l, err := backend.Acquire(ctx, repo, nil)
+	assert.NilError(t, err)
+	cancel()
+	out, captureErr := utils.CaptureStderr(func() {
+		if out, err := exec.Command("git", "-C", repo, "update-ref", "-d", DefaultLockRef).CombinedOutput(); err != nil {
+			t.Fatalf("git update-ref failed: %v: %s", err, out)
+		}
+		select {
+		case <-l.Lost():
+		case <-time.After(5 * time.Second):
+			t.Fatal("lock taken over was not lost")
+		}
+	})
+	assert.NilError(t, captureErr)
+	assert.Assert(t, strings.Contains(out, "Lock was taken over by other process"), out)
+	assert.Assert(t, strings.Contains(out, "run_id=test-run"), out)
+	assert.Assert(t, strings.Contains(out, "lock="+DefaultLockRef), out)
+}
@@ -0,0 +1,36 @@
+// Package lock coordinates the updates of the same git repository done by different
+// processes, which can be running in the same machine or in different ones.
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Backend acquires the locks of the git repositories
+type Backend interface {
+	// Acquire blocks until the lock of the repository is acquired or ctx is done,
+	// auth is used by the backends storing the lock in the repository itself
+	Acquire(ctx context.Context, repoURL string, auth transport.AuthMethod) (Lock, error)
+}
+
+// Lock is a lock of a git repository acquired from a backend
+type Lock interface {
+	// Release releases the lock so other processes can acquire it
+	Release(ctx context.Context) error
+	// Lost returns a channel closed when the lock is lost before being released, eg. because it
+	// expired without being renewed, so the work it protects must be stopped
+	Lost() <-chan struct{}
+}
+
+// defaultOwner identifies the current process as the owner of the locks
+func defaultOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
@@ -0,0 +1,70 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// The names of the fields of the logs, which are kept stable so the logs can be parsed by log pipelines
+const (
+	// FieldApplication is the name of the application updated
+	FieldApplication = "application"
+	// FieldRepo is the URL of the git repository updated
+	FieldRepo = "repo"
+	// FieldBranch is the branch of the git repository updated
+	FieldBranch = "branch"
+	// FieldKey is the key of the values file updated
+	FieldKey = "key"
+	// FieldCommit is the hash of the commit of the changes
+	FieldCommit = "commit"
+	// FieldRunID is the id correlating all the logs of a run
+	FieldRunID = "run_id"
+)
+
+type fieldsKey struct{}
+
+// NewRunID returns a random id to correlate the logs of a run
+func NewRunID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// ContextWithField returns a copy of ctx whose log contexts have the field, see FromContext
+func ContextWithField(ctx context.Context, key string, value interface{}) context.Context {
+	parent, _ := ctx.Value(fieldsKey{}).(logger.Fields)
+	fields := make(logger.Fields, len(parent)+1)
+	for k, v := range parent {
+		fields[k] = v
+	}
+	fields[key] = value
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// ContextWithRunID returns a copy of ctx whose log contexts have the run id, ctx is returned
+// unchanged if it already has one so the logs of a run keep the id of the run that started it
+func ContextWithRunID(ctx context.Context, runID string) context.Context {
+	if RunIDFromContext(ctx) != "" {
+		return ctx
+	}
+	return ContextWithField(ctx, FieldRunID, runID)
+}
+
+// RunIDFromContext returns the run id of ctx, which is empty if there is none
+func RunIDFromContext(ctx context.Context) string {
+	fields, _ := ctx.Value(fieldsKey{}).(logger.Fields)
+	runID, _ := fields[FieldRunID].(string)
+	return runID
+}
+
+// FromContext returns a Context with default settings and the fields of ctx, eg. the run id
+func FromContext(ctx context.Context) *Context {
+	logctx := NewContext()
+	if fields, ok := ctx.Value(fieldsKey{}).(logger.Fields); ok {
+		logctx.entry = logctx.entry.WithFields(fields)
+	}
+	return logctx
+}
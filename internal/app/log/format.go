@@ -0,0 +1,53 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// Formats lists the formats of the logs supported by SetLogFormat
+var Formats = []string{"text", "json", "logfmt"}
+
+// formatter is the *redactFormatter of the logs of all the contexts
+var formatter atomic.Value
+
+// currentFormatter returns the formatter of the logs
+func currentFormatter() *redactFormatter {
+	return formatter.Load().(*redactFormatter)
+}
+
+// SetLogFormat sets the format of the logs, text for humans, or json and logfmt for log pipelines
+func SetLogFormat(format string) error {
+	var f logger.Formatter
+	switch strings.ToLower(format) {
+	case "text":
+		f = &logger.TextFormatter{
+			// the contexts don't log to their logrus output, so it can't be checked if it's a terminal
+			ForceColors:   isTerminal(os.Stdout),
+			DisableColors: disableLogColors(),
+			FullTimestamp: true,
+		}
+	case "json":
+		f = &logger.JSONFormatter{}
+	case "logfmt":
+		f = &logger.TextFormatter{
+			DisableColors:    true,
+			FullTimestamp:    true,
+			QuoteEmptyFields: true,
+		}
+	default:
+		return fmt.Errorf("invalid log format: %s", format)
+	}
+	formatter.Store(&redactFormatter{formatter: f})
+	return nil
+}
+
+// isTerminal checks if the file is a terminal
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,48 @@
+package log
+
+import (
+	"io"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// writeMutex serializes the writes of the entries, so the lines of concurrent entries are not interleaved
+var writeMutex sync.Mutex
+
+// levelRouter is a logrus hook writing the entries of the error levels to the error output
+// and the rest of entries to the normal output, formatted with the current format
+type levelRouter struct {
+	normalOut io.Writer
+	errorOut  io.Writer
+}
+
+// Levels returns all the levels, as every entry is written by the hook
+func (h *levelRouter) Levels() []logger.Level {
+	return logger.AllLevels
+}
+
+// Fire writes the entry to the output of its level
+func (h *levelRouter) Fire(entry *logger.Entry) error {
+	line, err := currentFormatter().Format(entry)
+	if err != nil {
+		return err
+	}
+	out := h.normalOut
+	if entry.Level <= logger.ErrorLevel {
+		out = h.errorOut
+	}
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	_, err = out.Write(line)
+	return err
+}
+
+// discardFormatter is the formatter of the loggers of the contexts, whose entries are discarded
+// after being written by the levelRouter hook, so they don't need to be formatted again
+type discardFormatter struct{}
+
+// Format returns no output
+func (discardFormatter) Format(*logger.Entry) ([]byte, error) {
+	return nil, nil
+}
@@ -3,8 +3,10 @@ package log
 // Wrapper package around logrus whose main purpose is to support having
 // different output streams for error and non-error messages.
 //
-// Does not wrap every method of logrus package. If you need direct access,
-// use log.Log() to get the actual logrus logger object.
+// Every Context has its own logrus logger, whose entries are written by a
+// hook routing them to the output stream of their level, so the contexts
+// can log concurrently without sharing any mutable logrus state. The level
+// and the format of the logs are shared by all the contexts.
 //
 // It might seem redundant, but we really want the different output streams.
 
@@ -14,46 +16,63 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	logger "github.com/sirupsen/logrus"
 )
 
 // Context contains a structured context for logging
 type Context struct {
-	fields    logger.Fields
-	normalOut io.Writer
-	errorOut  io.Writer
-	mutex     sync.RWMutex
+	entry *logger.Entry
+	mutex sync.RWMutex
 }
 
+// level is the level of the logs of all the contexts
+var level = uint32(logger.DebugLevel)
+
 // NewContext returns a Context with default settings
 func NewContext() *Context {
-	var logctx Context
-	logctx.fields = make(logger.Fields)
-	logctx.normalOut = os.Stdout
-	logctx.errorOut = os.Stderr
-	return &logctx
+	return newContext(os.Stdout, os.Stderr)
+}
+
+// newContext returns a Context logging the errors to errorOut and the rest of messages to normalOut
+func newContext(normalOut io.Writer, errorOut io.Writer) *Context {
+	l := logger.New()
+	// the entries are written by the hook, the logger only discards them
+	l.SetOutput(io.Discard)
+	l.SetFormatter(discardFormatter{})
+	// the level of the contexts is checked before logging, so it can be changed after they are created
+	l.SetLevel(logger.TraceLevel)
+	l.AddHook(&levelRouter{normalOut: normalOut, errorOut: errorOut})
+	return &Context{entry: logger.NewEntry(l)}
 }
 
 // SetLogLevel sets the log level to use for the logger
 func SetLogLevel(logLevel string) error {
+	var l logger.Level
 	switch strings.ToLower(logLevel) {
 	case "trace":
-		logger.SetLevel(logger.TraceLevel)
+		l = logger.TraceLevel
 	case "debug":
-		logger.SetLevel(logger.DebugLevel)
+		l = logger.DebugLevel
 	case "info":
-		logger.SetLevel(logger.InfoLevel)
+		l = logger.InfoLevel
 	case "warn":
-		logger.SetLevel(logger.WarnLevel)
+		l = logger.WarnLevel
 	case "error":
-		logger.SetLevel(logger.ErrorLevel)
+		l = logger.ErrorLevel
 	default:
 		return fmt.Errorf("invalid loglevel: %s", logLevel)
 	}
+	atomic.StoreUint32(&level, uint32(l))
 	return nil
 }
 
+// isLevelEnabled checks if the messages of the level are logged
+func isLevelEnabled(l logger.Level) bool {
+	return logger.Level(atomic.LoadUint32(&level)) >= l
+}
+
 // WithContext is an alias for NewContext
 func WithContext() *Context {
 	return NewContext()
@@ -62,69 +81,58 @@ func WithContext() *Context {
 // AddField adds a structured field to logctx
 func (logctx *Context) AddField(key string, value interface{}) *Context {
 	logctx.mutex.Lock()
-	logctx.fields[key] = value
+	logctx.entry = logctx.entry.WithField(key, value)
 	logctx.mutex.Unlock()
 	return logctx
 }
 
+// WithField returns a copy of logctx with the structured field, leaving logctx unchanged
+func (logctx *Context) WithField(key string, value interface{}) *Context {
+	return &Context{entry: logctx.currentEntry().WithField(key, value)}
+}
+
+// currentEntry returns the entry with the fields of logctx
+func (logctx *Context) currentEntry() *logger.Entry {
+	logctx.mutex.RLock()
+	defer logctx.mutex.RUnlock()
+	return logctx.entry
+}
+
+// logf logs a message of the level for logctx if the level is enabled
+func (logctx *Context) logf(l logger.Level, format string, args ...interface{}) {
+	if isLevelEnabled(l) {
+		logctx.currentEntry().Logf(l, format, args...)
+	}
+}
+
 // Tracef logs a debug message for logctx to stdout
 func (logctx *Context) Tracef(format string, args ...interface{}) {
-	logger.SetOutput(logctx.normalOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Tracef(format, args...)
-	} else {
-		logger.Tracef(format, args...)
-	}
+	logctx.logf(logger.TraceLevel, format, args...)
 }
 
 // Debugf logs a debug message for logctx to stdout
 func (logctx *Context) Debugf(format string, args ...interface{}) {
-	logger.SetOutput(logctx.normalOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Debugf(format, args...)
-	} else {
-		logger.Debugf(format, args...)
-	}
+	logctx.logf(logger.DebugLevel, format, args...)
 }
 
 // Infof logs an informational message for logctx to stdout
 func (logctx *Context) Infof(format string, args ...interface{}) {
-	logger.SetOutput(logctx.normalOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Infof(format, args...)
-	} else {
-		logger.Infof(format, args...)
-	}
+	logctx.logf(logger.InfoLevel, format, args...)
 }
 
 // Warnf logs a warning message for logctx to stdout
 func (logctx *Context) Warnf(format string, args ...interface{}) {
-	logger.SetOutput(logctx.normalOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Warnf(format, args...)
-	} else {
-		logger.Warnf(format, args...)
-	}
+	logctx.logf(logger.WarnLevel, format, args...)
 }
 
-// Errorf logs a non-fatal error message for logctx to stdout
+// Errorf logs a non-fatal error message for logctx to stderr
 func (logctx *Context) Errorf(format string, args ...interface{}) {
-	logger.SetOutput(logctx.errorOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Errorf(format, args...)
-	} else {
-		logger.Errorf(format, args...)
-	}
+	logctx.logf(logger.ErrorLevel, format, args...)
 }
 
-// Fatalf logs a fatal error message for logctx to stdout
+// Fatalf logs a fatal error message for logctx to stderr and exits
 func (logctx *Context) Fatalf(format string, args ...interface{}) {
-	logger.SetOutput(logctx.errorOut)
-	if logctx.fields != nil && len(logctx.fields) > 0 {
-		logger.WithFields(logctx.fields).Fatalf(format, args...)
-	} else {
-		logger.Fatalf(format, args...)
-	}
+	logctx.currentEntry().Fatalf(format, args...)
 }
 
 // Tracef logs a trace message without context to stdout
@@ -169,9 +177,5 @@ func disableLogColors() bool {
 
 // Initializes the logging subsystem with default values
 func init() {
-	logger.SetFormatter(&logger.TextFormatter{
-		DisableColors: disableLogColors(),
-		FullTimestamp: true,
-	})
-	logger.SetLevel(logger.DebugLevel)
+	_ = SetLogFormat("text")
 }
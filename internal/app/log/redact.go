@@ -0,0 +1,111 @@
+package log
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	logger "github.com/sirupsen/logrus"
+)
+
+// redactedValue is the replacement written in the logs instead of a secret value
+const redactedValue = "*****"
+
+// minRedactedLineLength is the minimum length of the individual lines of a
+// multiline secret that are going to be redacted on their own
+const minRedactedLineLength = 8
+
+var (
+	secrets      []string
+	secretsMutex sync.RWMutex
+)
+
+// AddSecret registers a secret value that will be redacted from all log output
+func AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+
+	secrets = appendSecret(secrets, secret)
+	// the lines of multiline secrets, like SSH private keys, are redacted also
+	// on their own because the logged value could be only a part of the secret
+	if strings.Contains(secret, "\n") {
+		for _, line := range strings.Split(secret, "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) >= minRedactedLineLength {
+				secrets = appendSecret(secrets, line)
+			}
+		}
+	}
+}
+
+// appendSecret appends secret to the list if it is not already present, the list
+// is kept sorted from the longest secret to the shortest one so a secret containing
+// another secret is redacted completely
+func appendSecret(list []string, secret string) []string {
+	for _, s := range list {
+		if s == secret {
+			return list
+		}
+	}
+	list = append(list, secret)
+	for i := len(list) - 1; i > 0 && len(list[i]) > len(list[i-1]); i-- {
+		list[i], list[i-1] = list[i-1], list[i]
+	}
+	return list
+}
+
+// ResetSecrets removes all registered secrets
+func ResetSecrets() {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	secrets = nil
+}
+
+// Redact returns the message with all registered secrets replaced
+func Redact(message string) string {
+	secretsMutex.RLock()
+	defer secretsMutex.RUnlock()
+	for _, secret := range secrets {
+		message = strings.ReplaceAll(message, secret, redactedValue)
+	}
+	return message
+}
+
+// RedactURL returns the url without its user information, eg. the token of a git repository url, so it
+// can be logged. The url is returned as is when it can't be parsed
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return strings.Replace(u.String(), "//", "//"+redactedValue+"@", 1)
+}
+
+// redactFormatter is a logrus formatter that removes the registered secrets
+// from the message and fields of the entries before formatting them with the
+// wrapped formatter
+type redactFormatter struct {
+	formatter logger.Formatter
+}
+
+// Format redacts the entry and formats it using the wrapped formatter
+func (f *redactFormatter) Format(entry *logger.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = Redact(entry.Message)
+	redacted.Data = make(logger.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			redacted.Data[key] = Redact(v)
+		case error:
+			redacted.Data[key] = Redact(v.Error())
+		default:
+			redacted.Data[key] = value
+		}
+	}
+	return f.formatter.Format(&redacted)
+}
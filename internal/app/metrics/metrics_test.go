@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"gotest.tools/v3/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	QueueDepth.Set(3)
+	RegistryRequestDuration.WithLabelValues("image").Observe(0.75)
+	httpServer := httptest.NewServer(promhttp.Handler())
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	for _, line := range []string{
+		"# TYPE helm_repo_updater_updates_attempted_total counter\n",
+		"helm_repo_updater_queue_depth 3\n",
+		`helm_repo_updater_registry_request_duration_seconds_bucket{type="image",le="1"} 1` + "\n",
+	} {
+		assert.Assert(t, strings.Contains(string(body), line), "missing %q in:\n%s", line, body)
+	}
+}
+
+func TestMetricsPush(t *testing.T) {
+	QueueDepth.Set(3)
+
+	var method, path string
+	var body []byte
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		method, path = req.Method, req.URL.EscapedPath()
+		body, _ = io.ReadAll(req.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer pushgateway.Close()
+
+	err := push.New(pushgateway.URL, "helm-repo-updater").Gatherer(prometheus.DefaultGatherer).Push()
+	assert.NilError(t, err)
+	assert.Equal(t, method, http.MethodPut)
+	assert.Equal(t, path, "/metrics/job/helm-repo-updater")
+	assert.Assert(t, strings.Contains(string(body), "helm_repo_updater_queue_depth"))
+}
@@ -0,0 +1,66 @@
+// Package metrics defines the Prometheus metrics of the updates, registered in the default
+// registry of client_golang so they are exposed with promhttp.Handler and pushed with Push
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "helm_repo_updater"
+
+// DefaultBuckets are the upper bounds in seconds of the buckets of the histograms of durations
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+var (
+	// UpdatesAttempted counts the updates of the values of the applications attempted
+	UpdatesAttempted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: namespace + "_updates_attempted_total",
+		Help: "Number of updates of the values of the applications attempted.",
+	})
+	// UpdatesSucceeded counts the updates committed and pushed
+	UpdatesSucceeded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: namespace + "_updates_succeeded_total",
+		Help: "Number of updates of the values of the applications committed.",
+	})
+	// UpdatesFailed counts the updates failed by the reason of the failure
+	UpdatesFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: namespace + "_updates_failed_total",
+		Help: "Number of updates of the values of the applications failed, by reason.",
+	}, []string{"reason"})
+	// UpdatesSkipped counts the updates skipped because the values were already set
+	UpdatesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: namespace + "_updates_skipped_total",
+		Help: "Number of updates skipped because there was nothing to update.",
+	})
+	// GitCloneDuration observes the durations of the clones of the git repositories
+	GitCloneDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    namespace + "_git_clone_duration_seconds",
+		Help:    "Duration of the clones of the git repositories in seconds.",
+		Buckets: DefaultBuckets,
+	})
+	// GitPushDuration observes the durations of the pushes to the git repositories
+	GitPushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    namespace + "_git_push_duration_seconds",
+		Help:    "Duration of the pushes to the git repositories in seconds.",
+		Buckets: DefaultBuckets,
+	})
+	// QueueDepth is the number of update jobs waiting in the queue of the server
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: namespace + "_queue_depth",
+		Help: "Number of update jobs waiting to be processed.",
+	})
+	// RegistryRequestDuration observes the durations of the lookups of the versions by type of source, image or chart
+	RegistryRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    namespace + "_registry_request_duration_seconds",
+		Help:    "Duration of the lookups of the versions in the registries and chart repositories in seconds, by type.",
+		Buckets: DefaultBuckets,
+	}, []string{"type"})
+)
+
+// Since returns the seconds elapsed since start, to be observed by the histograms of durations
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+)
+
+// defaultSMTPPort is the submission port of the SMTP servers
+const defaultSMTPPort = 587
+
+// SMTPConfig configures the SMTP server sending the notifications by email
+type SMTPConfig struct {
+	// Host is the host of the SMTP server
+	Host string `yaml:"host"`
+	// Port is the port of the SMTP server, 587 if zero
+	Port int `yaml:"port"`
+	// Username is the user authenticated with the SMTP server, no authentication is used if empty
+	Username string `yaml:"username"`
+	// PasswordFromEnv is the name of the environment variable with the password of Username
+	PasswordFromEnv string `yaml:"passwordFromEnv"`
+	// From is the sender of the emails
+	From string `yaml:"from"`
+	// To are the recipients of the emails
+	To []string `yaml:"to"`
+}
+
+// EmailNotifier sends the notifications by email through an SMTP server. The connection is upgraded
+// with STARTTLS when the server supports it
+type EmailNotifier struct {
+	address string
+	auth    smtp.Auth
+	from    string
+	to      []string
+}
+
+// NewEmailNotifier returns a notifier sending emails with the SMTP server configured
+func NewEmailNotifier(cfg SMTPConfig) (*EmailNotifier, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("smtp host, from and to are required")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	n := &EmailNotifier{
+		address: net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		from:    cfg.From,
+		to:      cfg.To,
+	}
+	if cfg.Username != "" {
+		password := os.Getenv(cfg.PasswordFromEnv)
+		if cfg.PasswordFromEnv == "" || password == "" {
+			return nil, fmt.Errorf("the password of smtp user %s is required in passwordFromEnv", cfg.Username)
+		}
+		log.AddSecret(password)
+		// the credentials are only sent through TLS connections, or to localhost
+		n.auth = smtp.PlainAuth("", cfg.Username, password, cfg.Host)
+	}
+	return n, nil
+}
+
+// Notify sends the notification as a plain text email with the list of changes and the link to the commit.
+// The connection to the SMTP server is closed when the context is done or the request times out
+func (n *EmailNotifier) Notify(ctx context.Context, notification Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", n.address)
+	if err != nil {
+		return fmt.Errorf("could not connect to smtp server %s: %v", n.address, err)
+	}
+	// the session is interrupted closing the connection when the context is done
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	if err := n.send(conn, n.message(notification, time.Now())); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("could not send email through %s: %w", n.address, ctx.Err())
+		}
+		return fmt.Errorf("could not send email through %s: %v", n.address, err)
+	}
+	return nil
+}
+
+// send sends the message in an SMTP session on the connection, which is closed once it ends
+func (n *EmailNotifier) send(conn net.Conn, msg []byte) error {
+	host, _, _ := net.SplitHostPort(n.address)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := client.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(n.from); err != nil {
+		return err
+	}
+	for _, to := range n.to {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message returns the email of the notification with its headers
+func (n *EmailNotifier) message(notification Notification, date time.Time) []byte {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Summary()))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", notification.Summary())
+	for _, change := range notification.Changes {
+		fmt.Fprintf(&msg, "- %s in %s: %s -> %s\r\n", change.Key, change.File, change.OldValue, change.NewValue)
+	}
+	fmt.Fprintf(&msg, "\r\nCommit %s of %s\r\n", notification.Commit, notification.Repo)
+	if notification.CommitURL != "" {
+		fmt.Fprintf(&msg, "%s\r\n", notification.CommitURL)
+	}
+	return []byte(msg.String())
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// smtpMessage is a message received by the SMTP stand-in
+type smtpMessage struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn is a local stand-in of an SMTP server recording the messages received, which
+// supports the plain authentication without TLS
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []smtpMessage
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	s := &smtpStandIn{listener: listener}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// port returns the port where the stand-in listens
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// received returns the messages received
+func (s *smtpStandIn) received() []smtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpMessage(nil), s.messages...)
+}
+
+// serve runs an SMTP session with the client
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	var message smtpMessage
+	_ = text.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			_ = text.PrintfLine("250-localhost")
+			_ = text.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			credentials, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			message.auth = string(credentials)
+			_ = text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			_ = text.PrintfLine("250 ok")
+		case "RCPT":
+			message.to = append(message.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			_ = text.PrintfLine("250 ok")
+		case "DATA":
+			_ = text.PrintfLine("354 send the data")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			message.data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = smtpMessage{}
+			_ = text.PrintfLine("250 queued")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	standIn := newSMTPStandIn(t)
+	t.Setenv("TEST_SMTP_PASSWORD", "smtp-password")
+
+	notifier, err := NewEmailNotifier(SMTPConfig{
+		Host:            "127.0.0.1",
+		Port:            standIn.port(),
+		Username:        "updater",
+		PasswordFromEnv: "TEST_SMTP_PASSWORD",
+		From:            "updater@example.com",
+		To:              []string{"team@example.com", "oncall@example.com"},
+	})
+	assert.NilError(t, err)
+	notification := testNotification
+	notification.CommitURL = "https://github.com/docplanner/helm-charts/commit/0123456"
+	assert.NilError(t, notifier.Notify(context.Background(), notification))
+
+	messages := standIn.received()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].auth, "\x00updater\x00smtp-password")
+	assert.Equal(t, messages[0].from, "updater@example.com")
+	assert.DeepEqual(t, messages[0].to, []string{"team@example.com", "oncall@example.com"})
+
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(messages[0].data))).ReadMIMEHeader()
+	assert.NilError(t, err)
+	assert.Equal(t, msg.Get("From"), "updater@example.com")
+	assert.Equal(t, msg.Get("To"), "team@example.com, oncall@example.com")
+	assert.Equal(t, msg.Get("Subject"), "Updated 2 values of example-app in branch main")
+	assert.Assert(t, strings.HasSuffix(messages[0].data, "Updated 2 values of example-app in branch main\n\n"+
+		"- .image.tag in example-app/values.yaml: 1.0.0 -> 1.1.0\n"+
+		"- .sidecar.tag in example-app/values.yaml: 2.0.0 -> 2.1.0\n\n"+
+		"Commit "+testNotification.Commit+" of https://github.com/docplanner/helm-charts.git\n"+
+		"https://github.com/docplanner/helm-charts/commit/0123456\n"), messages[0].data)
+}
+
+func TestEmailNotifierMessage(t *testing.T) {
+	notifier, err := NewEmailNotifier(SMTPConfig{Host: "localhost", From: "updater@example.com", To: []string{"team@example.com"}})
+	assert.NilError(t, err)
+	assert.Equal(t, notifier.address, "localhost:"+strconv.Itoa(defaultSMTPPort))
+
+	notification := testNotification
+	notification.App = "café"
+	message := string(notifier.message(notification, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Assert(t, strings.Contains(message, "Subject: =?utf-8?q?Updated_2_values_of_caf=C3=A9_in_branch_main?=\r\n"), message)
+	assert.Assert(t, strings.Contains(message, "Date: Sun, 02 Jan 2022 03:04:05 +0000\r\n"), message)
+}
+
+func TestEmailNotifierFailed(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.NilError(t, listener.Close())
+
+	notifier, err := NewEmailNotifier(SMTPConfig{Host: "127.0.0.1", Port: port, From: "updater@example.com", To: []string{"team@example.com"}})
+	assert.NilError(t, err)
+	assert.ErrorContains(t, notifier.Notify(context.Background(), testNotification), "connection refused")
+
+	_, err = NewEmailNotifier(SMTPConfig{Host: "localhost", Username: "updater", From: "updater@example.com", To: []string{"team@example.com"}})
+	assert.Error(t, err, "the password of smtp user updater is required in passwordFromEnv")
+}
+
+func TestEmailNotifierCanceled(t *testing.T) {
+	// the server accepts the connections but never greets the client
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	notifier, err := NewEmailNotifier(SMTPConfig{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port,
+		From: "updater@example.com", To: []string{"team@example.com"}})
+	assert.NilError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = notifier.Notify(ctx, testNotification)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.Assert(t, time.Since(start) < requestTimeout)
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// requestTimeout is the maximum duration of a request sending a notification
+const requestTimeout = 10 * time.Second
+
+// postJSON posts the JSON encoding of payload to the url with the headers
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the error of the client includes the url, which is a secret of the incoming webhooks
+		return fmt.Errorf("request failed: %v", unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// unwrapURLError returns the cause of a *url.Error, without the url
+func unwrapURLError(err error) error {
+	if cause, ok := err.(interface{ Unwrap() error }); ok && cause.Unwrap() != nil {
+		return cause.Unwrap()
+	}
+	return err
+}
+
+// SlackNotifier posts the notifications to a Slack incoming webhook
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier returns a notifier posting to the Slack incoming webhook url, eg. https://hooks.slack.com/services/...
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{url: url, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// slackMessage is the payload of a Slack incoming webhook
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// Notify posts the notification as a message with the list of changes and the link to the commit
+func (n *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s*\n", escapeSlack(notification.Summary()))
+	for _, change := range notification.Changes {
+		fmt.Fprintf(&text, "• `%s` in `%s`: `%s` → `%s`\n", escapeSlack(change.Key), escapeSlack(change.File),
+			escapeSlack(change.OldValue), escapeSlack(change.NewValue))
+	}
+	if notification.CommitURL != "" {
+		fmt.Fprintf(&text, "<%s|Commit %s>", notification.CommitURL, notification.shortCommit())
+	} else {
+		fmt.Fprintf(&text, "Commit %s", notification.shortCommit())
+	}
+	return postJSON(ctx, n.client, n.url, nil, slackMessage{Text: text.String()})
+}
+
+// escapeSlack escapes the control characters of the Slack message formatting
+func escapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// TeamsNotifier posts the notifications to a Microsoft Teams incoming webhook
+type TeamsNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewTeamsNotifier returns a notifier posting to the Microsoft Teams incoming webhook url
+func NewTeamsNotifier(url string) *TeamsNotifier {
+	return &TeamsNotifier{url: url, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// The message card payload of a Microsoft Teams incoming webhook
+type (
+	teamsMessageCard struct {
+		Type            string         `json:"@type"`
+		Context         string         `json:"@context"`
+		Summary         string         `json:"summary"`
+		Title           string         `json:"title"`
+		Sections        []teamsSection `json:"sections"`
+		PotentialAction []teamsAction  `json:"potentialAction,omitempty"`
+	}
+	teamsSection struct {
+		ActivityTitle string      `json:"activityTitle"`
+		Facts         []teamsFact `json:"facts"`
+	}
+	teamsFact struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	teamsAction struct {
+		Type    string        `json:"@type"`
+		Name    string        `json:"name"`
+		Targets []teamsTarget `json:"targets"`
+	}
+	teamsTarget struct {
+		OS  string `json:"os"`
+		URI string `json:"uri"`
+	}
+)
+
+// Notify posts the notification as a message card with a fact per change and a button opening the commit
+func (n *TeamsNotifier) Notify(ctx context.Context, notification Notification) error {
+	card := teamsMessageCard{
+		Type:    "MessageCard",
+		Context: "https://schema.org/extensions",
+		Summary: notification.Summary(),
+		Title:   notification.Summary(),
+		Sections: []teamsSection{{
+			ActivityTitle: fmt.Sprintf("Commit %s of %s", notification.shortCommit(), notification.Repo),
+			Facts:         make([]teamsFact, 0, len(notification.Changes)),
+		}},
+	}
+	for _, change := range notification.Changes {
+		card.Sections[0].Facts = append(card.Sections[0].Facts, teamsFact{
+			Name:  change.Key,
+			Value: fmt.Sprintf("%s → %s", change.OldValue, change.NewValue),
+		})
+	}
+	if notification.CommitURL != "" {
+		card.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "View commit",
+			Targets: []teamsTarget{{OS: "default", URI: notification.CommitURL}},
+		}}
+	}
+	return postJSON(ctx, n.client, n.url, nil, card)
+}
+
+// WebhookNotifier posts the notifications to a webhook as JSON
+type WebhookNotifier struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+// NewWebhookNotifier returns a notifier posting the JSON encoding of the notifications to the url with the headers
+func NewWebhookNotifier(url string, headers map[string]string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, headers: headers, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Notify posts the JSON encoding of the notification
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	return postJSON(ctx, n.client, n.url, n.headers, notification)
+}
@@ -0,0 +1,259 @@
+// Package notify sends notifications of the updates pushed to the git repository, eg. to a Slack
+// channel, so the teams owning the applications know when their values change.
+//
+// The notifiers are configured in a YAML file, each of them notifying the updates of the
+// applications matching its patterns.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"gopkg.in/yaml.v3"
+)
+
+// Change is a value changed by an update
+type Change struct {
+	File     string `json:"file"`
+	Key      string `json:"key"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// Notification describes the changes of an application pushed to the git repository
+type Notification struct {
+	App       string   `json:"app"`
+	Repo      string   `json:"repo"`
+	Branch    string   `json:"branch"`
+	Commit    string   `json:"commit"`
+	CommitURL string   `json:"commit_url,omitempty"`
+	Changes   []Change `json:"changes"`
+}
+
+// Summary returns a line describing the notification, eg. Updated 1 value of example-app in branch main
+func (n Notification) Summary() string {
+	values := "values"
+	if len(n.Changes) == 1 {
+		values = "value"
+	}
+	summary := fmt.Sprintf("Updated %d %s of %s", len(n.Changes), values, n.App)
+	if n.Branch != "" {
+		summary += " in branch " + n.Branch
+	}
+	return summary
+}
+
+// shortCommit returns the abbreviated hash of the commit
+func (n Notification) shortCommit() string {
+	if len(n.Commit) > 7 {
+		return n.Commit[:7]
+	}
+	return n.Commit
+}
+
+// Notifier sends the notifications of the updates
+type Notifier interface {
+	// Notify sends the notification, failing if it could not be delivered
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// Config is the content of the file configuring the notifications
+type Config struct {
+	// CommitURL is the template of the link to the commit, rendered with the notification, eg.
+	// https://gitlab.example.com/group/repo/-/commit/{{ .Commit }}. It's derived from the repository if empty
+	CommitURL string `yaml:"commitURL"`
+	// Notifiers are the notifiers of the updates
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+}
+
+// NotifierConfig configures a notifier of the updates
+type NotifierConfig struct {
+	// Name identifies the notifier in the logs, its type is used if empty
+	Name string `yaml:"name"`
+	// Type is the kind of notifier, one of slack|teams|webhook|email
+	Type string `yaml:"type"`
+	// Apps are the patterns of the applications notified, eg. payments-*, all of them are notified if empty
+	Apps []string `yaml:"apps"`
+	// URL is the url of the Slack or Teams incoming webhook, or of the generic webhook
+	URL string `yaml:"url"`
+	// URLFromEnv is the name of the environment variable with the url, as incoming webhook urls are secrets
+	URLFromEnv string `yaml:"urlFromEnv"`
+	// Headers are sent in each request of the generic webhook, eg. to authenticate it
+	Headers map[string]string `yaml:"headers"`
+	// SMTP configures the email notifier
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+// route is a notifier and the patterns of the applications it notifies
+type route struct {
+	name     string
+	apps     []string
+	notifier Notifier
+}
+
+// matches checks if the notifier of the route notifies the application
+func (r *route) matches(app string) bool {
+	if len(r.apps) == 0 {
+		return true
+	}
+	for _, pattern := range r.apps {
+		if matched, _ := path.Match(pattern, app); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatcher sends each notification to the notifiers of its application
+type Dispatcher struct {
+	commitURL *template.Template
+	routes    []route
+}
+
+// LoadConfig reads the configuration of the notifications from a YAML file
+func LoadConfig(file string) (*Dispatcher, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read notifications config from file %s: %v", file, err)
+	}
+	var cfg Config
+	if err = yaml.Unmarshal(content, &cfg); err != nil {
+		return nil, fmt.Errorf("could not parse notifications config from file %s: %v", file, err)
+	}
+	dispatcher, err := NewDispatcher(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notifications config in file %s: %v", file, err)
+	}
+	return dispatcher, nil
+}
+
+// NewDispatcher returns a dispatcher of the notifications to the notifiers configured
+func NewDispatcher(cfg Config) (*Dispatcher, error) {
+	d := &Dispatcher{}
+	if cfg.CommitURL != "" {
+		tpl, err := template.New("commitURL").Parse(cfg.CommitURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit url template: %v", err)
+		}
+		d.commitURL = tpl
+	}
+	for i, notifierCfg := range cfg.Notifiers {
+		name := notifierCfg.Name
+		if name == "" {
+			name = notifierCfg.Type
+		}
+		for _, pattern := range notifierCfg.Apps {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("notifier %d: invalid app pattern %s", i+1, pattern)
+			}
+		}
+		notifier, err := newNotifier(notifierCfg)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %d: %v", i+1, err)
+		}
+		d.routes = append(d.routes, route{name: name, apps: notifierCfg.Apps, notifier: notifier})
+	}
+	return d, nil
+}
+
+// newNotifier returns the notifier configured
+func newNotifier(cfg NotifierConfig) (Notifier, error) {
+	if cfg.Type == "email" {
+		return NewEmailNotifier(cfg.SMTP)
+	}
+	webhookURL := cfg.URL
+	if cfg.URLFromEnv != "" {
+		webhookURL = os.Getenv(cfg.URLFromEnv)
+		if webhookURL == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", cfg.URLFromEnv)
+		}
+	}
+	if webhookURL == "" {
+		return nil, fmt.Errorf("url or urlFromEnv is required")
+	}
+	if _, err := url.ParseRequestURI(webhookURL); err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	// the urls of the incoming webhooks authenticate the messages
+	log.AddSecret(webhookURL)
+	for _, value := range cfg.Headers {
+		log.AddSecret(value)
+	}
+	switch cfg.Type {
+	case "slack":
+		return NewSlackNotifier(webhookURL), nil
+	case "teams":
+		return NewTeamsNotifier(webhookURL), nil
+	case "webhook":
+		return NewWebhookNotifier(webhookURL, cfg.Headers), nil
+	}
+	return nil, fmt.Errorf("unknown type %s, it must be one of slack|teams|webhook|email", cfg.Type)
+}
+
+// Notify sends the notification to the notifiers of its application, setting the link to its commit.
+// All the notifiers are tried, the errors of the ones failing are returned together
+func (d *Dispatcher) Notify(ctx context.Context, notification Notification) error {
+	if notification.CommitURL == "" {
+		notification.CommitURL = d.CommitURL(notification)
+	}
+	var errs []string
+	for i := range d.routes {
+		r := &d.routes[i]
+		if !r.matches(notification.App) {
+			continue
+		}
+		log.FromContext(ctx).AddField(log.FieldApplication, notification.App).
+			Debugf("Sending notification of commit %s with notifier %s", notification.Commit, r.name)
+		if err := r.notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("could not send notification: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// CommitURL returns the link to the commit of the notification, rendered from the template configured or
+// derived from the url of its repository, eg. https://github.com/org/repo/commit/<hash>. It's empty if the
+// link can't be derived
+func (d *Dispatcher) CommitURL(notification Notification) string {
+	if d.commitURL != nil {
+		var buf bytes.Buffer
+		if err := d.commitURL.Execute(&buf, notification); err != nil {
+			log.Errorf("could not execute template for commit url: %v", err)
+			return ""
+		}
+		return buf.String()
+	}
+	return commitURL(notification.Repo, notification.Commit)
+}
+
+// commitURL returns the web link to the commit of the git repository, which is reached through http
+// or ssh, eg. git@github.com:org/repo.git. It's empty if the url of the repository can't be parsed
+func commitURL(repoURL string, commit string) string {
+	var host, repoPath string
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		host, repoPath = u.Hostname(), u.Path
+	} else if at := strings.Index(repoURL, "@"); at >= 0 && strings.Contains(repoURL[at:], ":") {
+		// scp-like syntax of ssh, eg. git@github.com:org/repo.git
+		hostPath := strings.SplitN(repoURL[at+1:], ":", 2)
+		host, repoPath = hostPath[0], hostPath[1]
+	}
+	repoPath = strings.Trim(strings.TrimSuffix(repoPath, ".git"), "/")
+	if host == "" || repoPath == "" || commit == "" {
+		return ""
+	}
+	commitPath := "commit"
+	if host == "bitbucket.org" {
+		commitPath = "commits"
+	}
+	return fmt.Sprintf("https://%s/%s/%s/%s", host, repoPath, commitPath, commit)
+}
@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Queue sends the notifications in the background with a single worker, so the updates don't wait for
+// the notifiers. Up to size notifications wait to be sent, the ones notified when it's full are dropped
+type Queue struct {
+	notifier Notifier
+	pending  chan queuedNotification
+	done     chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// queuedNotification is a notification waiting to be sent with the context it was notified with
+type queuedNotification struct {
+	ctx          context.Context
+	notification Notification
+}
+
+// NewQueue returns a queue sending the notifications with the notifier, started until it's closed
+func NewQueue(notifier Notifier, size int) *Queue {
+	q := &Queue{
+		notifier: notifier,
+		pending:  make(chan queuedNotification, size),
+		done:     make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// Notify queues the notification to be sent, failing if the queue is full or closed. The notification
+// is sent with the values of the context, eg. the trace and the log fields, but not with its cancellation
+// as it's sent once the update has finished
+func (q *Queue) Notify(ctx context.Context, notification Notification) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("notifications queue is closed")
+	}
+	select {
+	case q.pending <- queuedNotification{ctx: utils.WithoutCancel(ctx), notification: notification}:
+		return nil
+	default:
+		return fmt.Errorf("notifications queue is full, %d notifications are waiting to be sent", cap(q.pending))
+	}
+}
+
+// Close stops queueing notifications and waits until the queued ones are sent or the context is done
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not send %d queued notifications: %v", len(q.pending), ctx.Err())
+	}
+}
+
+// run sends the queued notifications until the queue is closed
+func (q *Queue) run() {
+	defer close(q.done)
+	for queued := range q.pending {
+		q.send(queued.ctx, queued.notification)
+	}
+}
+
+// send sends the notification, logging the error if it could not be delivered
+func (q *Queue) send(ctx context.Context, notification Notification) {
+	ctx, span := tracing.Start(ctx, "notify", attribute.String("application", notification.App),
+		attribute.Int("changes", len(notification.Changes)))
+	defer span.End()
+	if err := q.notifier.Notify(ctx, notification); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.FromContext(ctx).AddField(log.FieldApplication, notification.App).AddField(log.FieldCommit, notification.Commit).
+			Errorf("could not notify changes: %v", err)
+	}
+}
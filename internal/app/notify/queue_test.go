@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// blockingNotifier records the notifications sent, waiting until it's released to send each of them
+type blockingNotifier struct {
+	release chan struct{}
+	mu      sync.Mutex
+	sent    []Notification
+	errs    []error
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, notification Notification) error {
+	<-n.release
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, notification)
+	n.errs = append(n.errs, ctx.Err())
+	return nil
+}
+
+func TestQueue(t *testing.T) {
+	notifier := &blockingNotifier{release: make(chan struct{})}
+	queue := NewQueue(notifier, 1)
+
+	// the context of the update is canceled once it finishes, before the notification is sent
+	ctx, cancel := context.WithCancel(context.Background())
+	first := testNotification
+	first.App = "first-app"
+	assert.NilError(t, queue.Notify(ctx, first))
+	cancel()
+
+	// the notifications wait for the worker, which is sending the first one or about to take it
+	second := testNotification
+	second.App = "second-app"
+	deadline := time.Now().Add(5 * time.Second)
+	for queue.Notify(context.Background(), second) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.ErrorContains(t, queue.Notify(context.Background(), testNotification), "notifications queue is full")
+
+	close(notifier.release)
+	assert.NilError(t, queue.Close(context.Background()))
+	assert.ErrorContains(t, queue.Notify(context.Background(), testNotification), "notifications queue is closed")
+
+	assert.Equal(t, len(notifier.sent), 2)
+	assert.Equal(t, notifier.sent[0].App, "first-app")
+	assert.Equal(t, notifier.sent[1].App, "second-app")
+	assert.NilError(t, notifier.errs[0])
+}
+
+func TestQueueCloseTimeout(t *testing.T) {
+	notifier := &blockingNotifier{release: make(chan struct{})}
+	defer close(notifier.release)
+	queue := NewQueue(notifier, 1)
+	assert.NilError(t, queue.Notify(context.Background(), testNotification))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorContains(t, queue.Close(ctx), "context deadline exceeded")
+}
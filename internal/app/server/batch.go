@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// collectBatch returns the jobs queued during the batch window started by the first one
+func (s *Server) collectBatch(ctx context.Context, first *Job) []*Job {
+	jobs := []*Job{first}
+	timer := time.NewTimer(s.cfg.BatchWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return jobs
+		case <-timer.C:
+			return jobs
+		case job := <-s.queue:
+			jobs = append(jobs, job)
+		}
+	}
+}
+
+// processBatch runs the updates of the jobs coalesced in a single commit, the dry run
+// jobs are processed in their own batch so their changes are not committed
+func (s *Server) processBatch(ctx context.Context, jobs []*Job) {
+	var jobsDryRun, jobsCommitted []*Job
+	for _, job := range jobs {
+		if job.Request.DryRun {
+			jobsDryRun = append(jobsDryRun, job)
+		} else {
+			jobsCommitted = append(jobsCommitted, job)
+		}
+	}
+	s.start(jobs...)
+
+	if s.cfg.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.JobTimeout)
+		defer cancel()
+	}
+	for _, batch := range [][]*Job{jobsCommitted, jobsDryRun} {
+		if len(batch) > 0 {
+			s.runBatch(ctx, batch)
+		}
+	}
+}
+
+// runBatch runs the updates of the jobs in a single commit
+func (s *Server) runBatch(ctx context.Context, jobs []*Job) {
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	ctx = log.ContextWithRunID(ctx, strings.Join(ids, ","))
+	logCtx := log.FromContext(ctx).AddField("job", strings.Join(ids, ","))
+	logCtx.Infof("Processing batch of %d jobs", len(jobs))
+	// the batch continues the trace of its first job, the rest of jobs are recorded in the span
+	ctx, span := tracing.Start(trace.ContextWithSpanContext(ctx, jobs[0].spanContext), "batch",
+		attribute.String("job", strings.Join(ids, ",")), attribute.Int("jobs", len(jobs)))
+	defer span.End()
+
+	updates, indexes := s.mergeRequests(jobs)
+	cfg := s.cfg.Base
+	cfg.DryRun = cfg.DryRun || jobs[0].Request.DryRun
+	results, err := s.updateBatch(ctx, cfg, updates, s.state)
+
+	for i, job := range jobs {
+		switch {
+		case err != nil && (!errors.Is(err, updater.ErrNothingToUpdate) || results == nil):
+			s.finish(job, nil, err)
+		case results[indexes[i]].Err != nil:
+			s.finish(job, nil, results[indexes[i]].Err)
+		default:
+			changes := jobChanges(job, results[indexes[i]].Changes)
+			if len(changes) == 0 {
+				s.finish(job, nil, updater.ErrNothingToUpdate)
+			} else {
+				s.finish(job, &changes, nil)
+			}
+		}
+	}
+	logCtx.Infof("Batch of %d jobs finished", len(jobs))
+}
+
+// mergeRequests merges the requests of the jobs updating the same file of an application, resolving the
+// updates of the same key with the batch strategy. It returns the index of the update of each job
+func (s *Server) mergeRequests(jobs []*Job) ([]updater.ApplicationUpdate, []int) {
+	var updates []updater.ApplicationUpdate
+	var values []map[string]string
+	indexes := make([]int, len(jobs))
+	updateIndex := make(map[string]int)
+	for i, job := range jobs {
+		file := path.Join(s.cfg.Dir, job.Request.App, job.Request.File)
+		id := job.Request.App + "\x00" + file
+		index, found := updateIndex[id]
+		if !found {
+			index = len(updates)
+			updateIndex[id] = index
+			updates = append(updates, updater.ApplicationUpdate{AppName: job.Request.App, File: file})
+			values = append(values, make(map[string]string))
+		}
+		indexes[i] = index
+
+		for key, value := range job.Request.Values {
+			if current, found := values[index][key]; found && !s.replaces(current, value) {
+				continue
+			}
+			values[index][key] = value
+		}
+	}
+
+	for i := range updates {
+		request := UpdateRequest{Values: values[i]}
+		updates[i].UpdateApps = request.changeEntries()
+	}
+	return updates, indexes
+}
+
+// replaces checks if the value of a later job replaces the current one of the same key
+func (s *Server) replaces(current, value string) bool {
+	if s.cfg.BatchStrategy == SemverMax {
+		if result, ok := utils.CompareSemver(value, current); ok {
+			return result > 0
+		}
+	}
+	return true
+}
+
+// jobChanges returns the changes of the keys requested by the job
+func jobChanges(job *Job, changes []updater.ChangeEntry) []updater.ChangeEntry {
+	var requested []updater.ChangeEntry
+	for _, change := range changes {
+		if _, found := job.Request.Values[change.Key]; found {
+			requested = append(requested, change)
+		}
+	}
+	return requested
+}
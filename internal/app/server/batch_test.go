@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"gotest.tools/v3/assert"
+)
+
+// fakeBatchUpdater records the batches updated, returning the changes requested as made with
+// the old values set to 1.0.0, unless the file doesn't exist
+type fakeBatchUpdater struct {
+	mu      sync.Mutex
+	batches [][]updater.ApplicationUpdate
+	dryRuns []bool
+}
+
+func (u *fakeBatchUpdater) update(ctx context.Context, cfg updater.HelmUpdaterConfig, updates []updater.ApplicationUpdate, state *updater.SyncIterationState) ([]updater.ApplicationResult, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.batches = append(u.batches, updates)
+	u.dryRuns = append(u.dryRuns, cfg.DryRun)
+
+	results := make([]updater.ApplicationResult, len(updates))
+	for i, update := range updates {
+		if update.File == "gitops/missing-app/values.yaml" {
+			results[i].Err = fmt.Errorf("open %s: no such file or directory", update.File)
+			continue
+		}
+		for _, change := range update.UpdateApps {
+			change.OldValue = "1.0.0"
+			change.App = update.AppName
+			change.File = update.File
+			results[i].Changes = append(results[i].Changes, change)
+		}
+	}
+	return results, nil
+}
+
+// postJobs queues the requests in the server, returning the identifiers of the jobs
+func postJobs(t *testing.T, url string, bodies ...string) []string {
+	t.Helper()
+	var ids []string
+	for _, body := range bodies {
+		var job Job
+		resp := doRequest(t, http.MethodPost, url+updatesPath, body, &job)
+		assert.Equal(t, resp.StatusCode, http.StatusAccepted)
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+func TestServerBatch(t *testing.T) {
+	batchUpdater := &fakeBatchUpdater{}
+	s, url := newTestServer(t, Config{BatchWindow: 200 * time.Millisecond, BatchStrategy: SemverMax}, fakeUpdate)
+	s.updateBatch = batchUpdater.update
+
+	ids := postJobs(t, url,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.2.0"}}`,
+		`{"app": "other-app", "file": "values.yaml", "values": {".image.tag": "2.0.0"}}`,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0", ".image.repository": "example"}}`,
+		`{"app": "missing-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`,
+	)
+	jobs := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		jobs = append(jobs, waitJob(t, url, id))
+	}
+
+	// all the jobs are coalesced in a single commit, keeping the highest version of the same key
+	assert.Equal(t, len(batchUpdater.batches), 1)
+	assert.DeepEqual(t, batchUpdater.batches[0], []updater.ApplicationUpdate{
+		{AppName: "example-app", File: "gitops/example-app/values.yaml", UpdateApps: []updater.ChangeEntry{
+			{Key: ".image.repository", NewValue: "example"},
+			{Key: ".image.tag", NewValue: "1.2.0"},
+		}},
+		{AppName: "other-app", File: "gitops/other-app/values.yaml", UpdateApps: []updater.ChangeEntry{
+			{Key: ".image.tag", NewValue: "2.0.0"},
+		}},
+		{AppName: "missing-app", File: "gitops/missing-app/values.yaml", UpdateApps: []updater.ChangeEntry{
+			{Key: ".image.tag", NewValue: "1.1.0"},
+		}},
+	})
+
+	assert.Equal(t, jobs[0].Status, JobSucceeded)
+	assert.DeepEqual(t, jobs[0].Changes, []JobChange{{Key: ".image.tag", OldValue: "1.0.0", NewValue: "1.2.0"}})
+	assert.Equal(t, jobs[1].Status, JobSucceeded)
+	assert.DeepEqual(t, jobs[1].Changes, []JobChange{{Key: ".image.tag", OldValue: "1.0.0", NewValue: "2.0.0"}})
+	// the job whose version is lower reports the version set by the other job
+	assert.Equal(t, jobs[2].Status, JobSucceeded)
+	assert.DeepEqual(t, jobs[2].Changes, []JobChange{
+		{Key: ".image.repository", OldValue: "1.0.0", NewValue: "example"},
+		{Key: ".image.tag", OldValue: "1.0.0", NewValue: "1.2.0"},
+	})
+	assert.Equal(t, jobs[3].Status, JobFailed)
+	assert.Equal(t, jobs[3].Error, "open gitops/missing-app/values.yaml: no such file or directory")
+}
+
+func TestServerBatchLatestWins(t *testing.T) {
+	batchUpdater := &fakeBatchUpdater{}
+	s, url := newTestServer(t, Config{BatchWindow: 200 * time.Millisecond, BatchStrategy: LatestWins}, fakeUpdate)
+	s.updateBatch = batchUpdater.update
+
+	ids := postJobs(t, url,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.2.0"}}`,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.3.0"}, "dry_run": true}`,
+	)
+	for _, id := range ids {
+		waitJob(t, url, id)
+	}
+
+	// the dry run jobs are processed in their own batch
+	assert.Equal(t, len(batchUpdater.batches), 2)
+	assert.DeepEqual(t, batchUpdater.dryRuns, []bool{false, true})
+	assert.DeepEqual(t, batchUpdater.batches[0][0].UpdateApps, []updater.ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}})
+	assert.DeepEqual(t, batchUpdater.batches[1][0].UpdateApps, []updater.ChangeEntry{{Key: ".image.tag", NewValue: "1.3.0"}})
+}
+
+func TestServerBatchFailed(t *testing.T) {
+	s, url := newTestServer(t, Config{BatchWindow: 100 * time.Millisecond}, fakeUpdate)
+	s.updateBatch = func(ctx context.Context, cfg updater.HelmUpdaterConfig, updates []updater.ApplicationUpdate, state *updater.SyncIterationState) ([]updater.ApplicationResult, error) {
+		return nil, fmt.Errorf("could not push changes")
+	}
+
+	ids := postJobs(t, url,
+		`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.2.0"}}`,
+		`{"app": "other-app", "file": "values.yaml", "values": {".image.tag": "2.0.0"}}`,
+	)
+	for _, id := range ids {
+		job := waitJob(t, url, id)
+		assert.Equal(t, job.Status, JobFailed)
+		assert.Equal(t, job.Error, "could not push changes")
+	}
+}
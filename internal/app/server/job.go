@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/yq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// JobStatus is the state of an update job
+type JobStatus string
+
+const (
+	// JobQueued is the status of the jobs waiting for a worker
+	JobQueued JobStatus = "queued"
+	// JobRunning is the status of the jobs being processed
+	JobRunning JobStatus = "running"
+	// JobSucceeded is the status of the jobs which updated the values or found them already updated
+	JobSucceeded JobStatus = "succeeded"
+	// JobFailed is the status of the jobs which could not update the values
+	JobFailed JobStatus = "failed"
+)
+
+// UpdateRequest is the body of the requests creating update jobs
+type UpdateRequest struct {
+	// App is the name of the application, which is the directory containing the file
+	App string `json:"app"`
+	// File is the location of the values file inside the directory of the application
+	File string `json:"file"`
+	// Values are the new values of the keys of the file, eg. .image.tag: 1.1.0
+	Values map[string]string `json:"values"`
+	// DryRun checks the changes without committing them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// validate checks the request can be processed, the files outside the git repository can't be updated
+func (r UpdateRequest) validate() error {
+	if r.App == "" || r.File == "" {
+		return fmt.Errorf("app and file are required")
+	}
+	for _, p := range []string{r.App, r.File} {
+		if path.IsAbs(p) || strings.HasPrefix(path.Clean(p), "..") {
+			return fmt.Errorf("invalid path %s, it must be relative to the git repo directory", p)
+		}
+	}
+	if strings.Contains(r.App, "/") {
+		return fmt.Errorf("invalid app %s", r.App)
+	}
+	if len(r.Values) == 0 {
+		return fmt.Errorf("at least one value is required")
+	}
+	for key := range r.Values {
+		if key == "" {
+			return fmt.Errorf("empty keys are not allowed")
+		}
+		if err := yq.ValidateKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changeEntries returns the changes requested, sorted by key so jobs are processed deterministically
+func (r UpdateRequest) changeEntries() []updater.ChangeEntry {
+	keys := make([]string, 0, len(r.Values))
+	for key := range r.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make([]updater.ChangeEntry, 0, len(keys))
+	for _, key := range keys {
+		changes = append(changes, updater.ChangeEntry{
+			Key:      key,
+			NewValue: r.Values[key],
+		})
+	}
+	return changes
+}
+
+// JobChange is a change of a key made by a job
+type JobChange struct {
+	Key      string `json:"key"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// Job is an update requested to the server
+type Job struct {
+	ID         string        `json:"id"`
+	Status     JobStatus     `json:"status"`
+	Request    UpdateRequest `json:"request"`
+	Changes    []JobChange   `json:"changes,omitempty"`
+	Message    string        `json:"message,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	// TraceID identifies the trace of the job, when it's traced
+	TraceID string `json:"trace_id,omitempty"`
+
+	// spanContext is the span of the request of the job, the parent of the span of its processing
+	spanContext trace.SpanContext
+}
+
+// finished checks if the job has been processed
+func (j *Job) finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// newJobID returns a random identifier for a job
+func newJobID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
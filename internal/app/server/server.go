@@ -0,0 +1,398 @@
+// Package server exposes the updates of the values of the applications through a REST API,
+// so the clients don't need the credentials of the git repository.
+//
+// The updates requested are queued as jobs, which are processed by a pool of workers and kept
+// in memory, so the clients can poll their status until they finish.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// updatesPath is the path of the updates API
+	updatesPath = "/v1/updates"
+	// maxRequestSize is the maximum size of the body of the requests
+	maxRequestSize = 1 << 20
+)
+
+// ErrQueueFull is returned when a job can't be queued because there are too many jobs waiting
+var ErrQueueFull = errors.New("too many jobs queued")
+
+const (
+	// LatestWins resolves the updates of the same key coalesced in a batch with the value of the latest one
+	LatestWins = "latest-wins"
+	// SemverMax resolves the updates of the same key coalesced in a batch with the highest semantic version,
+	// or with the latest value when any of them is not a semantic version
+	SemverMax = "semver-max"
+)
+
+// updateFunc updates the values of an application
+type updateFunc func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error)
+
+// batchUpdateFunc updates the values of several applications in a single commit
+type batchUpdateFunc func(ctx context.Context, cfg updater.HelmUpdaterConfig, updates []updater.ApplicationUpdate, state *updater.SyncIterationState) ([]updater.ApplicationResult, error)
+
+// Config is the configuration of the server
+type Config struct {
+	// Base is the configuration shared by the updates, which set the application, file and changes
+	Base updater.HelmUpdaterConfig
+	// Dir is the directory of the git repository containing the applications
+	Dir string
+	// Tokens are the bearer tokens accepted to authenticate the requests
+	Tokens []string
+	// Workers is the number of jobs processed at the same time
+	Workers int
+	// QueueSize is the maximum number of jobs waiting to be processed
+	QueueSize int
+	// MaxJobs is the maximum number of finished jobs whose status is kept
+	MaxJobs int
+	// JobTimeout is the maximum duration of a job, zero doesn't limit it
+	JobTimeout time.Duration
+	// BatchWindow is the time the jobs queued are waited for since a worker takes the first one, so all of them
+	// are coalesced in a single commit. Zero processes each job in its own commit
+	BatchWindow time.Duration
+	// BatchStrategy resolves the updates of the same key coalesced in a batch, one of LatestWins or SemverMax
+	BatchStrategy string
+}
+
+// Server processes the update jobs requested through the REST API
+type Server struct {
+	cfg         Config
+	state       *updater.SyncIterationState
+	update      updateFunc
+	updateBatch batchUpdateFunc
+	queue       chan *Job
+	wg          sync.WaitGroup
+
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	// order keeps the identifiers of the jobs sorted by creation
+	order []string
+}
+
+// New returns a server processing the jobs with the configuration
+func New(cfg Config) *Server {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1
+	}
+	return &Server{
+		cfg:         cfg,
+		state:       updater.NewSyncIterationState(),
+		update:      updater.UpdateApplication,
+		updateBatch: updater.UpdateApplications,
+		queue:       make(chan *Job, cfg.QueueSize),
+		jobs:        make(map[string]*Job),
+	}
+}
+
+// Start launches the workers processing the jobs until ctx is done. The jobs being processed
+// are cancelled with ctx, while the queued ones are failed
+func (s *Server) Start(ctx context.Context) {
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.queue:
+					if s.cfg.BatchWindow > 0 {
+						s.processBatch(ctx, s.collectBatch(ctx, job))
+					} else {
+						s.process(ctx, job)
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		s.wg.Wait()
+		for {
+			select {
+			case job := <-s.queue:
+				metrics.QueueDepth.Set(float64(len(s.queue)))
+				s.finish(job, nil, fmt.Errorf("server shutting down"))
+			default:
+				return
+			}
+		}
+	}()
+}
+
+// Wait blocks until the workers have finished after the context of Start is done
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// start records the jobs are being processed
+func (s *Server) start(jobs ...*Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metrics.QueueDepth.Set(float64(len(s.queue)))
+	now := time.Now()
+	for _, job := range jobs {
+		job.Status = JobRunning
+		job.StartedAt = &now
+	}
+}
+
+// process runs the update of the job, continuing the trace of its request
+func (s *Server) process(ctx context.Context, job *Job) {
+	// the logs of the update are correlated by the id of the job
+	ctx = log.ContextWithRunID(ctx, job.ID)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, job.Request.App).AddField("job", job.ID)
+	ctx, span := tracing.Start(trace.ContextWithSpanContext(ctx, job.spanContext), "job",
+		attribute.String("job", job.ID), attribute.String("application", job.Request.App))
+	defer span.End()
+
+	s.start(job)
+	logCtx.Infof("Processing job")
+
+	cfg := s.cfg.Base
+	cfg.AppName = job.Request.App
+	cfg.File = path.Join(s.cfg.Dir, job.Request.App, job.Request.File)
+	cfg.UpdateApps = job.Request.changeEntries()
+	cfg.DryRun = cfg.DryRun || job.Request.DryRun
+
+	if s.cfg.JobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.JobTimeout)
+		defer cancel()
+	}
+	changes, err := s.update(ctx, cfg, s.state)
+	s.finish(job, changes, err)
+	logCtx.Infof("Job finished with status %s", job.Status)
+}
+
+// finish records the result of the job
+func (s *Server) finish(job *Job, changes *[]updater.ChangeEntry, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job.FinishedAt = &now
+	switch {
+	case errors.Is(err, updater.ErrNothingToUpdate):
+		job.Status = JobSucceeded
+		job.Message = err.Error()
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobSucceeded
+		if changes != nil {
+			for _, change := range *changes {
+				job.Changes = append(job.Changes, JobChange{Key: change.Key, OldValue: change.OldValue, NewValue: change.NewValue})
+			}
+		}
+	}
+	s.pruneJobs()
+}
+
+// pruneJobs forgets the oldest finished jobs when there are more than the maximum allowed,
+// it must be called holding the lock of the jobs
+func (s *Server) pruneJobs() {
+	if s.cfg.MaxJobs <= 0 {
+		return
+	}
+	finished := 0
+	for _, id := range s.order {
+		if s.jobs[id].finished() {
+			finished++
+		}
+	}
+	order := s.order[:0]
+	for _, id := range s.order {
+		if finished > s.cfg.MaxJobs && s.jobs[id].finished() {
+			delete(s.jobs, id)
+			finished--
+			continue
+		}
+		order = append(order, id)
+	}
+	s.order = order
+}
+
+// Handler returns the handler of the REST API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(updatesPath, s.authenticate(http.HandlerFunc(s.handleUpdates)))
+	mux.Handle(updatesPath+"/", s.authenticate(http.HandlerFunc(s.handleUpdate)))
+	return mux
+}
+
+// authenticate rejects the requests without a valid bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(header, "Bearer ")
+		for _, valid := range s.cfg.Tokens {
+			if token != header && valid != "" && subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="helm-repo-updater"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+	})
+}
+
+// handleUpdates creates a job or lists the jobs
+func (s *Server) handleUpdates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.createJob(w, r)
+	case http.MethodGet:
+		s.listJobs(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleUpdate returns the status of a job
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, updatesPath+"/")
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, found := s.jobs[id]
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// Enqueue queues a job processing the update requested, returning a copy of the job queued or
+// ErrQueueFull when there are too many jobs waiting to be processed. The processing of the job
+// continues the trace of ctx
+func (s *Server) Enqueue(ctx context.Context, request UpdateRequest) (Job, error) {
+	if err := request.validate(); err != nil {
+		return Job{}, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, fmt.Errorf("could not create job: %v", err)
+	}
+	job := &Job{
+		ID:        id,
+		Status:    JobQueued,
+		Request:   request,
+		CreatedAt: time.Now(),
+
+		spanContext: trace.SpanContextFromContext(ctx),
+	}
+	if job.spanContext.IsValid() {
+		job.TraceID = job.spanContext.TraceID().String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- job:
+	default:
+		return Job{}, ErrQueueFull
+	}
+	s.jobs[id] = job
+	s.order = append(s.order, id)
+	metrics.QueueDepth.Set(float64(len(s.queue)))
+
+	log.WithContext().AddField(log.FieldApplication, request.App).AddField("job", id).Infof("Queued job")
+	return *job, nil
+}
+
+// createJob queues the update requested
+func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
+	var request UpdateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+	if err := request.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+
+	ctx, span := tracing.StartWithKind(propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)), "POST "+updatesPath, trace.SpanKindServer,
+		attribute.String("application", request.App))
+	defer span.End()
+	job, err := s.Enqueue(ctx, request)
+	if err == ErrQueueFull {
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", updatesPath+"/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// listJobs returns the jobs known by the server, the latest first, optionally filtered by status
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	status := JobStatus(r.URL.Query().Get("status"))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]*Job, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		job := s.jobs[s.order[i]]
+		if status == "" || job.Status == status {
+			jobs = append(jobs, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// writeJSON writes the value as the JSON body of the response
+func writeJSON(w http.ResponseWriter, statusCode int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Errorf("could not write response: %v", err)
+	}
+}
+
+// writeError writes the error message as the JSON body of the response
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]string{"error": message})
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"github.com/docplanner/helm-repo-updater/internal/app/yq"
+	"go.opentelemetry.io/otel/trace"
+	"gotest.tools/v3/assert"
+)
+
+const validToken = "test-token"
+
+// newTestServer returns a server whose updates are made by update, and the url of its API
+func newTestServer(t *testing.T, cfg Config, update updateFunc) (*Server, string) {
+	t.Helper()
+	cfg.Dir = "gitops"
+	cfg.Tokens = []string{validToken}
+	s := New(cfg)
+	s.update = update
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	httpServer := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		httpServer.Close()
+		cancel()
+		s.Wait()
+	})
+	return s, httpServer.URL
+}
+
+// doRequest makes an authenticated request to the API, decoding the body of the response into out
+func doRequest(t *testing.T, method, url, body string, out interface{}) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	if out != nil {
+		assert.NilError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp
+}
+
+// waitJob polls the job until it's finished
+func waitJob(t *testing.T, url, id string) Job {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		var job Job
+		doRequest(t, http.MethodGet, url+updatesPath+"/"+id, "", &job)
+		if job.finished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return Job{}
+}
+
+// fakeUpdate returns the changes requested as made, setting the old values to 1.0.0
+func fakeUpdate(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+	changes := make([]updater.ChangeEntry, 0, len(cfg.UpdateApps))
+	for _, change := range cfg.UpdateApps {
+		change.OldValue = "1.0.0"
+		change.File = cfg.File
+		changes = append(changes, change)
+	}
+	return &changes, nil
+}
+
+func TestServerUpdate(t *testing.T) {
+	var cfgs []updater.HelmUpdaterConfig
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		cfgs = append(cfgs, cfg)
+		return fakeUpdate(ctx, cfg, state)
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	var job Job
+	resp := doRequest(t, http.MethodPost, url+updatesPath, `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0", ".image.repository": "example"}}`, &job)
+	assert.Equal(t, resp.StatusCode, http.StatusAccepted)
+	assert.Equal(t, resp.Header.Get("Location"), updatesPath+"/"+job.ID)
+	assert.Equal(t, job.Status, JobQueued)
+
+	job = waitJob(t, url, job.ID)
+	assert.Equal(t, job.Status, JobSucceeded)
+	assert.DeepEqual(t, job.Changes, []JobChange{
+		{Key: ".image.repository", OldValue: "1.0.0", NewValue: "example"},
+		{Key: ".image.tag", OldValue: "1.0.0", NewValue: "1.1.0"},
+	})
+	assert.Assert(t, job.StartedAt != nil && job.FinishedAt != nil)
+
+	assert.Equal(t, len(cfgs), 1)
+	assert.Equal(t, cfgs[0].AppName, "example-app")
+	assert.Equal(t, cfgs[0].File, "gitops/example-app/values.yaml")
+	assert.Equal(t, cfgs[0].DryRun, false)
+}
+
+func TestServerUpdateTraceparent(t *testing.T) {
+	traces := make(chan trace.TraceID, 1)
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		traces <- trace.SpanContextFromContext(ctx).TraceID()
+		return fakeUpdate(ctx, cfg, state)
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	req, err := http.NewRequest(http.MethodPost, url+updatesPath, strings.NewReader(`{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`))
+	assert.NilError(t, err)
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	var job Job
+	assert.NilError(t, json.NewDecoder(resp.Body).Decode(&job))
+	assert.Equal(t, job.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	// the processing of the job continues the trace of its request
+	assert.Equal(t, (<-traces).String(), job.TraceID)
+	job = waitJob(t, url, job.ID)
+	assert.Equal(t, job.Status, JobSucceeded)
+}
+
+func TestServerUpdateFailed(t *testing.T) {
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		return nil, fmt.Errorf("could not clone repository")
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	var job Job
+	doRequest(t, http.MethodPost, url+updatesPath, `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`, &job)
+	job = waitJob(t, url, job.ID)
+	assert.Equal(t, job.Status, JobFailed)
+	assert.Equal(t, job.Error, "could not clone repository")
+}
+
+func TestServerUpdateNothingToUpdate(t *testing.T) {
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		return nil, fmt.Errorf("values of file values.yaml already set: %w", updater.ErrNothingToUpdate)
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	var job Job
+	doRequest(t, http.MethodPost, url+updatesPath, `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}, "dry_run": true}`, &job)
+	job = waitJob(t, url, job.ID)
+	assert.Equal(t, job.Status, JobSucceeded)
+	assert.Equal(t, job.Message, "values of file values.yaml already set: nothing to update, skipping commit")
+	assert.Equal(t, len(job.Changes), 0)
+}
+
+func TestServerUpdateDryRun(t *testing.T) {
+	dryRun := make(chan bool, 1)
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		dryRun <- cfg.DryRun
+		return fakeUpdate(ctx, cfg, state)
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	doRequest(t, http.MethodPost, url+updatesPath, `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}, "dry_run": true}`, nil)
+	assert.Equal(t, <-dryRun, true)
+}
+
+func TestServerUnauthorized(t *testing.T) {
+	_, url := newTestServer(t, Config{}, fakeUpdate)
+
+	for _, header := range []string{"", "Bearer invalid-token", validToken} {
+		req, err := http.NewRequest(http.MethodGet, url+updatesPath, nil)
+		assert.NilError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NilError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, resp.StatusCode, http.StatusUnauthorized, header)
+	}
+
+	// the health check doesn't need authentication
+	resp, err := http.Get(url + "/healthz")
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+}
+
+func TestServerInvalidRequest(t *testing.T) {
+	_, url := newTestServer(t, Config{}, fakeUpdate)
+
+	tests := map[string]struct {
+		body  string
+		error string
+	}{
+		"invalid json":   {body: `{"app":`, error: "invalid request"},
+		"unknown field":  {body: `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}, "branch": "main"}`, error: "unknown field"},
+		"missing app":    {body: `{"file": "values.yaml", "values": {".image.tag": "1.1.0"}}`, error: "app and file are required"},
+		"missing values": {body: `{"app": "example-app", "file": "values.yaml"}`, error: "at least one value is required"},
+		"absolute file":  {body: `{"app": "example-app", "file": "/etc/passwd", "values": {".image.tag": "1.1.0"}}`, error: "invalid path /etc/passwd"},
+		"parent file":    {body: `{"app": "example-app", "file": "../../values.yaml", "values": {".image.tag": "1.1.0"}}`, error: "invalid path ../../values.yaml"},
+		"nested app":     {body: `{"app": "example/app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`, error: "invalid app example/app"},
+		"expression key": {body: `{"app": "example-app", "file": "values.yaml", "values": {".x = load(\"/etc/passwd\") | .image.tag": "1.1.0"}}`, error: "must be a path of keys and indexes"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var body map[string]string
+			resp := doRequest(t, http.MethodPost, url+updatesPath, test.body, &body)
+			assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+			assert.Assert(t, strings.Contains(body["error"], test.error), body["error"])
+		})
+	}
+}
+
+func TestServerUpdateValueNotEvaluated(t *testing.T) {
+	// the values are written as they are, without being evaluated as part of the yq expressions
+	contents := make(chan string, 1)
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		content, err := yq.Apply(cfg.UpdateApps[0].Key, cfg.UpdateApps[0].NewValue, []byte("image:\n  tag: 1.0.0\n"))
+		if err != nil {
+			return nil, err
+		}
+		contents <- string(content)
+		return fakeUpdate(ctx, cfg, state)
+	}
+	_, url := newTestServer(t, Config{}, update)
+
+	value := `1.0" | .image.tag = load("/etc/passwd") | .x = "`
+	body, err := json.Marshal(UpdateRequest{App: "example-app", File: "values.yaml", Values: map[string]string{".image.tag": value}})
+	assert.NilError(t, err)
+	var job Job
+	resp := doRequest(t, http.MethodPost, url+updatesPath, string(body), &job)
+	assert.Equal(t, resp.StatusCode, http.StatusAccepted)
+	job = waitJob(t, url, job.ID)
+	assert.Equal(t, job.Status, JobSucceeded, job.Error)
+
+	written, err := yq.ReadKeyFromBytes(".image.tag", []byte(<-contents))
+	assert.NilError(t, err)
+	assert.Equal(t, *written, value)
+}
+
+func TestServerJobNotFound(t *testing.T) {
+	_, url := newTestServer(t, Config{}, fakeUpdate)
+
+	var body map[string]string
+	resp := doRequest(t, http.MethodGet, url+updatesPath+"/unknown", "", &body)
+	assert.Equal(t, resp.StatusCode, http.StatusNotFound)
+	assert.Equal(t, body["error"], "job unknown not found")
+
+	resp = doRequest(t, http.MethodDelete, url+updatesPath, "", nil)
+	assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
+}
+
+func TestServerQueueFull(t *testing.T) {
+	release := make(chan struct{})
+	update := func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		<-release
+		return fakeUpdate(ctx, cfg, state)
+	}
+	_, url := newTestServer(t, Config{Workers: 1, QueueSize: 1}, update)
+	defer close(release)
+
+	body := `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`
+	var running Job
+	doRequest(t, http.MethodPost, url+updatesPath, body, &running)
+	// wait until the worker takes the first job, so the second one fills the queue
+	for i := 0; i < 100; i++ {
+		doRequest(t, http.MethodGet, url+updatesPath+"/"+running.ID, "", &running)
+		if running.Status == JobRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, running.Status, JobRunning)
+
+	resp := doRequest(t, http.MethodPost, url+updatesPath, body, nil)
+	assert.Equal(t, resp.StatusCode, http.StatusAccepted)
+	resp = doRequest(t, http.MethodPost, url+updatesPath, body, nil)
+	assert.Equal(t, resp.StatusCode, http.StatusServiceUnavailable)
+	assert.Equal(t, resp.Header.Get("Retry-After"), "30")
+
+	var queued []Job
+	doRequest(t, http.MethodGet, url+updatesPath+"?status=queued", "", &queued)
+	assert.Equal(t, len(queued), 1)
+
+	// the metrics are served without authentication
+	resp, err := http.Get(url + "/metrics")
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	metricsBody, err := io.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Assert(t, strings.Contains(string(metricsBody), "helm_repo_updater_queue_depth 1\n"))
+}
+
+func TestServerMaxJobs(t *testing.T) {
+	_, url := newTestServer(t, Config{MaxJobs: 2}, fakeUpdate)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		var job Job
+		doRequest(t, http.MethodPost, url+updatesPath, `{"app": "example-app", "file": "values.yaml", "values": {".image.tag": "1.1.0"}}`, &job)
+		waitJob(t, url, job.ID)
+		ids = append(ids, job.ID)
+	}
+
+	// only the latest finished jobs are kept
+	var jobs []Job
+	doRequest(t, http.MethodGet, url+updatesPath, "", &jobs)
+	assert.Equal(t, len(jobs), 2)
+	assert.Equal(t, jobs[0].ID, ids[2])
+	assert.Equal(t, jobs[1].ID, ids[1])
+
+	resp := doRequest(t, http.MethodGet, url+updatesPath+"/"+ids[0], "", nil)
+	assert.Equal(t, resp.StatusCode, http.StatusNotFound)
+}
@@ -0,0 +1,144 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// DefaultServiceName is the name of the service of the spans exported when it's not configured
+	DefaultServiceName = "helm-repo-updater"
+	// tracesPath is the path of the traces of an OTLP/HTTP endpoint
+	tracesPath = "/v1/traces"
+)
+
+// Config is the configuration of the export of the spans, completed by the OTEL_* environment variables
+// of the SDK, eg. OTEL_TRACES_SAMPLER or OTEL_RESOURCE_ATTRIBUTES, and of the OTLP exporter
+type Config struct {
+	// OTLPEndpoint is the url of the OTLP/HTTP endpoint, eg. http://localhost:4318. The one of the
+	// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT environment variables is used if empty
+	OTLPEndpoint string
+	// OTLPHeaders are sent to the OTLP/HTTP endpoint, eg. to authenticate with the backend
+	OTLPHeaders map[string]string
+	// File is where the spans are appended as JSON instead of exporting them to an endpoint
+	File string
+	// ServiceName overrides the name of the service of OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES,
+	// DefaultServiceName is used if none is set
+	ServiceName string
+}
+
+// Enabled checks if the configuration or the environment configure an export of the spans, which is
+// disabled by OTEL_SDK_DISABLED=true or OTEL_TRACES_EXPORTER=none
+func (c Config) Enabled() bool {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") || os.Getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return c.File != "" || c.OTLPEndpoint != "" || os.Getenv("OTEL_TRACES_EXPORTER") == "otlp" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != ""
+}
+
+// Provider is a tracer provider of the SDK which records the spans started and exports them in batches
+type Provider struct {
+	*sdktrace.TracerProvider
+	file *os.File
+}
+
+// NewProvider returns a provider exporting the spans as configured, sampled as OTEL_TRACES_SAMPLER
+// configures and with the attributes of the host and the process detected in its resource
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	res, err := newResource(ctx, cfg.ServiceName)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Provider{}
+	var exporter sdktrace.SpanExporter
+	if cfg.File != "" {
+		p.file, err = os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open traces file %s: %v", cfg.File, err)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(p.file))
+	} else {
+		exporter, err = otlptracehttp.New(ctx, otlpOptions(cfg)...)
+	}
+	if err != nil {
+		p.close()
+		return nil, fmt.Errorf("could not create exporter of spans: %v", err)
+	}
+
+	p.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	return p, nil
+}
+
+// otlpOptions returns the options of the OTLP/HTTP exporter set by the configuration, the rest are
+// read from the environment by the exporter
+func otlpOptions(cfg Config) []otlptracehttp.Option {
+	var options []otlptracehttp.Option
+	if cfg.OTLPEndpoint != "" {
+		endpoint := strings.TrimSuffix(cfg.OTLPEndpoint, "/")
+		if !strings.HasSuffix(endpoint, tracesPath) {
+			endpoint += tracesPath
+		}
+		options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+	}
+	if len(cfg.OTLPHeaders) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(cfg.OTLPHeaders))
+	}
+	return options
+}
+
+// newResource returns the resource of the spans with the attributes of the environment, the host and the
+// process detected, whose service name is serviceName if set
+func newResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	options := []resource.Option{
+		resource.WithAttributes(attribute.String("service.name", DefaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOSType(),
+		resource.WithContainer(),
+		resource.WithProcessPID(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+	}
+	if serviceName != "" {
+		options = append(options, resource.WithAttributes(attribute.String("service.name", serviceName)))
+	}
+	res, err := resource.New(ctx, options...)
+	if errors.Is(err, resource.ErrPartialResource) {
+		log.Warnf("Some attributes of the resource of the spans could not be detected: %v", err)
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not detect resource of the spans: %v", err)
+	}
+	return res, nil
+}
+
+// Shutdown exports the spans ended, stops the exporter and closes the traces file, if any
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if closeErr := p.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// close closes the traces file, if any
+func (p *Provider) close() error {
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Close()
+}
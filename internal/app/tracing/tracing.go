@@ -0,0 +1,30 @@
+// Package tracing records the spans of the update pipeline with OpenTelemetry and exports them with
+// the OpenTelemetry protocol, so the traces can be inspected in any OpenTelemetry compatible backend.
+//
+// The spans are started with the global tracer provider, which doesn't record them until a provider
+// returned by NewProvider is set with otel.SetTracerProvider. The span contexts are propagated even
+// when the spans are not recorded, so the requests keep the trace of their traceparent header.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scopeName is the instrumentation scope of the spans
+const scopeName = "github.com/docplanner/helm-repo-updater"
+
+// Start starts an internal span child of the current span of ctx, returning a copy of ctx
+// whose current span is the new one
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return StartWithKind(ctx, name, trace.SpanKindInternal, attributes...)
+}
+
+// StartWithKind starts a span of the kind child of the current span of ctx, returning a copy of ctx
+// whose current span is the new one
+func StartWithKind(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(scopeName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
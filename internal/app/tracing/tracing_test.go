@@ -0,0 +1,180 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+// exportSpans records a span with attributes and a failed child span with a provider of the configuration
+// set as the global one, returning the span once they are exported
+func exportSpans(t *testing.T, cfg Config) trace.Span {
+	t.Helper()
+	provider, err := NewProvider(context.Background(), cfg)
+	assert.NilError(t, err)
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, root := Start(context.Background(), "update", attribute.String("application", "example-app"), attribute.Int("files", 2))
+	_, child := Start(ctx, "push")
+	child.RecordError(errors.New("push failed"))
+	child.SetStatus(codes.Error, "push failed")
+	child.End()
+	root.End()
+	assert.NilError(t, provider.Shutdown(context.Background()))
+	return root
+}
+
+// resourceAttribute returns the value of the attribute of the resource, empty if not found
+func resourceAttribute(resource *tracepb.ResourceSpans, key string) string {
+	for _, attribute := range resource.GetResource().GetAttributes() {
+		if attribute.GetKey() == key {
+			return attribute.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestStartWithoutProvider(t *testing.T) {
+	ctx, span := Start(context.Background(), "update")
+	assert.Assert(t, !span.IsRecording())
+	assert.Assert(t, !trace.SpanContextFromContext(ctx).IsValid())
+
+	// the trace context of the requests is propagated even if the spans are not recorded
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, span = StartWithKind(propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header)),
+		"POST /v1/updates", trace.SpanKindServer)
+	assert.Assert(t, !span.IsRecording())
+	assert.Equal(t, trace.SpanContextFromContext(ctx).TraceID().String(), "4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	var path, contentType, authorization string
+	var request coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path, contentType, authorization = r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		assert.Check(t, proto.Unmarshal(body, &request))
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=test,service.name=env-service")
+	root := exportSpans(t, Config{
+		OTLPEndpoint: collector.URL,
+		OTLPHeaders:  map[string]string{"Authorization": "Bearer test-token"},
+		ServiceName:  "test-service",
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, path, tracesPath)
+	assert.Equal(t, contentType, "application/x-protobuf")
+	assert.Equal(t, authorization, "Bearer test-token")
+	assert.Equal(t, len(request.ResourceSpans), 1)
+	resource := request.ResourceSpans[0]
+	// the configured service name overrides the one of the environment, whose other attributes are kept
+	assert.Equal(t, resourceAttribute(resource, "service.name"), "test-service")
+	assert.Equal(t, resourceAttribute(resource, "deployment.environment"), "test")
+	assert.Assert(t, resourceAttribute(resource, "host.name") != "")
+
+	spans := resource.ScopeSpans[0].Spans
+	traceID, spanID := root.SpanContext().TraceID(), root.SpanContext().SpanID()
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, resource.ScopeSpans[0].Scope.Name, scopeName)
+	assert.Equal(t, spans[0].Name, "push")
+	assert.DeepEqual(t, spans[0].ParentSpanId, spanID[:])
+	assert.Equal(t, spans[0].Status.Code, tracepb.Status_STATUS_CODE_ERROR)
+	assert.Equal(t, spans[1].Name, "update")
+	assert.DeepEqual(t, spans[1].TraceId, traceID[:])
+	assert.Equal(t, len(spans[1].ParentSpanId), 0)
+	assert.Equal(t, spans[1].Attributes[0].Value.GetStringValue(), "example-app")
+	assert.Equal(t, spans[1].Attributes[1].Value.GetIntValue(), int64(2))
+}
+
+func TestOTLPExporterSampler(t *testing.T) {
+	var exported int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&exported, 1)
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_TRACES_SAMPLER", "always_off")
+	root := exportSpans(t, Config{OTLPEndpoint: collector.URL})
+	assert.Assert(t, !root.SpanContext().IsSampled())
+	assert.Equal(t, atomic.LoadInt32(&exported), int32(0))
+}
+
+// fileSpan is the JSON encoding of the spans written to the traces file
+type fileSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ SpanID string }
+	Resource    []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv("OTEL_SERVICE_NAME", "env-service")
+	root := exportSpans(t, Config{File: file})
+
+	f, err := os.Open(file)
+	assert.NilError(t, err)
+	defer f.Close()
+	var spans []fileSpan
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span fileSpan
+		assert.NilError(t, json.Unmarshal(scanner.Bytes(), &span))
+		spans = append(spans, span)
+	}
+	assert.Equal(t, len(spans), 2)
+	assert.Equal(t, spans[0].Name, "push")
+	assert.Equal(t, spans[0].Parent.SpanID, root.SpanContext().SpanID().String())
+	assert.Equal(t, spans[1].Name, "update")
+	assert.Equal(t, spans[1].SpanContext.TraceID, root.SpanContext().TraceID().String())
+	// the service name of the environment is used when it's not configured
+	serviceName := ""
+	for _, attribute := range spans[1].Resource {
+		if attribute.Key == "service.name" {
+			serviceName, _ = attribute.Value.Value.(string)
+		}
+	}
+	assert.Equal(t, serviceName, "env-service")
+}
+
+func TestConfigEnabled(t *testing.T) {
+	assert.Assert(t, !Config{}.Enabled())
+	assert.Assert(t, Config{File: "traces.jsonl"}.Enabled())
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	assert.Assert(t, Config{}.Enabled())
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	assert.Assert(t, !Config{File: "traces.jsonl"}.Enabled())
+}
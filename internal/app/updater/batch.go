@@ -0,0 +1,99 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+)
+
+// ApplicationUpdate is the update of the values file of an application made in the same commit as other ones
+type ApplicationUpdate struct {
+	AppName    string
+	File       string
+	UpdateApps []ChangeEntry
+}
+
+// ApplicationResult is the result of an application update made in the same commit as other ones
+type ApplicationResult struct {
+	// Changes are the changes made in the values file of the application
+	Changes []ChangeEntry
+	// Err is the error which prevented updating the application, eg. because its file doesn't exist,
+	// which doesn't prevent committing the changes of the rest of applications
+	Err error
+}
+
+// UpdateApplications updates the values of several applications of the same git repository in a single
+// commit, whose message lists the changes of all of them. The application and file of cfg are ignored.
+// The results have the changes of each application when the commit has been pushed, or when there
+// is nothing to update, in which case the error is returned too
+func UpdateApplications(ctx context.Context, cfg HelmUpdaterConfig, updates []ApplicationUpdate, state *SyncIterationState) ([]ApplicationResult, error) {
+	var names []string
+	for _, update := range updates {
+		names = append(names, update.AppName)
+	}
+	cfg.AppName = strings.Join(names, ",")
+	ctx = withLogFields(ctx, cfg)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
+
+	tpl, err := template.New("commitMessage").Parse(git_internal.DefaultGitBatchCommitMessage)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse commit message template: %v", err)
+	}
+	gitConf := *cfg.GitConf
+	gitConf.Message = tpl
+	cfg.GitConf = &gitConf
+
+	results := make([]ApplicationResult, len(updates))
+	write := func(ctx context.Context, cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) ([]ChangeEntry, error) {
+		return writeApplicationsOverrides(ctx, cfg, updates, results, tempRoot, gitW)
+	}
+
+	apps, commit, err := commitChangesLocked(ctx, cfg, state, write)
+	if err != nil {
+		logCtx.Errorf("Could not update applications spec: %v", err)
+		if errors.Is(err, ErrNothingToUpdate) {
+			return results, err
+		}
+		return nil, err
+	}
+
+	logCtx.Infof("Successfully updated the live applications spec")
+	notifyChanges(ctx, cfg, *apps, commit)
+
+	return results, nil
+}
+
+// writeApplicationsOverrides writes the overrides of several applications to the git files of the working
+// tree, recording the result of each of them. It fails only if no application has been changed
+func writeApplicationsOverrides(ctx context.Context, cfg HelmUpdaterConfig, updates []ApplicationUpdate, results []ApplicationResult, tempRoot string, gitW git.Worktree) ([]ChangeEntry, error) {
+	apps := make([]ChangeEntry, 0)
+	for i, update := range updates {
+		appCfg := cfg
+		appCfg.AppName = update.AppName
+		appCfg.File = update.File
+		appCfg.UpdateApps = update.UpdateApps
+
+		changes, err := writeOverrides(ctx, appCfg, tempRoot, gitW)
+		if err != nil {
+			results[i] = ApplicationResult{Err: err}
+			continue
+		}
+		for j := range changes {
+			changes[j].App = update.AppName
+			changes[j].File = update.File
+		}
+		results[i] = ApplicationResult{Changes: changes}
+		apps = append(apps, changes...)
+	}
+
+	if len(apps) == 0 {
+		return apps, fmt.Errorf("values of %d applications already set: %w", len(updates), ErrNothingToUpdate)
+	}
+	return apps, nil
+}
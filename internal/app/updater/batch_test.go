@@ -0,0 +1,72 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	otherHelmAppName         = "other-app"
+	otherHelmAppFileToChange = otherHelmAppName + "/values.yaml"
+)
+
+// pushOtherAppValues adds the values file of another application to the branch
+func pushOtherAppValues(t *testing.T, s *localGitServer, branch string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "push")
+	runGit(t, "clone", "-q", "-b", branch, filepath.Join(s.root, localGitRepoName), dir)
+	assert.NilError(t, os.MkdirAll(filepath.Join(dir, otherHelmAppName), 0755))
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, otherHelmAppFileToChange), []byte(localGitRepoValuesFile), 0600))
+	runGit(t, "-C", dir, "add", ".")
+	runGit(t, "-C", dir, "commit", "-q", "-m", "add "+otherHelmAppName)
+	runGit(t, "-C", dir, "push", "-q", "origin", branch)
+}
+
+func TestUpdateApplicationsLocalServer(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	pushOtherAppValues(t, server, validGitRepoBranch)
+	previousCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, nil)
+	updates := []ApplicationUpdate{
+		{AppName: validHelmAppName, File: validHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}}},
+		{AppName: otherHelmAppName, File: otherHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "2.0.0"}}},
+		{AppName: "missing-app", File: "missing-app/values.yaml", UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "2.0.0"}}},
+	}
+
+	results, err := UpdateApplications(context.Background(), cfg, updates, NewSyncIterationState())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, results[0].Changes, []ChangeEntry{{Key: ".image.tag", OldValue: "1.0.0", NewValue: "1.1.0", File: validHelmAppFileToChange, App: validHelmAppName}})
+	assert.DeepEqual(t, results[1].Changes, []ChangeEntry{{Key: ".image.tag", OldValue: "1.0.0", NewValue: "2.0.0", File: otherHelmAppFileToChange, App: otherHelmAppName}})
+	assert.ErrorContains(t, results[2].Err, "no such file or directory")
+
+	// both applications are updated in a single commit listing all of them
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch+"^"), previousCommit)
+	assert.Equal(t, server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange), "image:\n  tag: 1.1.0\n")
+	assert.Equal(t, server.Git(t, "show", validGitRepoBranch+":"+otherHelmAppFileToChange), "image:\n  tag: 2.0.0\n")
+	message := server.Git(t, "log", "-1", "--format=%B", validGitRepoBranch)
+	assert.Equal(t, strings.TrimSpace(message), "🚀 automatic update of 2 applications\n"+
+		validHelmAppName+":\n  updates key .image.tag value from '1.0.0' to '1.1.0'\n"+
+		otherHelmAppName+":\n  updates key .image.tag value from '1.0.0' to '2.0.0'")
+}
+
+func TestUpdateApplicationsLocalServerNothingToUpdate(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	previousCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, nil)
+	updates := []ApplicationUpdate{
+		{AppName: validHelmAppName, File: validHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "1.0.0"}}},
+	}
+
+	results, err := UpdateApplications(context.Background(), cfg, updates, NewSyncIterationState())
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
+	assert.Assert(t, errors.Is(results[0].Err, ErrNothingToUpdate), results[0].Err)
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), previousCommit)
+}
@@ -0,0 +1,88 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// originRemoteName is the name of the remote of the git repository used to pull and push
+const originRemoteName = "origin"
+
+// resolveBaseRef returns the commit pointed by baseRef, which can be a branch, a tag or a commit SHA.
+// When baseRef is empty the default branch of the remote repository is used
+func resolveBaseRef(gitR *git.Repository, baseRef string) (*plumbing.Hash, error) {
+	if baseRef == "" {
+		if ref, err := gitR.Reference(plumbing.NewRemoteHEADReferenceName(originRemoteName), true); err == nil {
+			return refHash(ref), nil
+		}
+		// a repository just cloned points HEAD to the default branch of the remote repository
+		ref, err := gitR.Head()
+		if err != nil {
+			return nil, fmt.Errorf("could not find default branch: %v", err)
+		}
+		return refHash(ref), nil
+	}
+
+	revisions := []plumbing.Revision{
+		plumbing.Revision(plumbing.NewRemoteReferenceName(originRemoteName, baseRef)),
+		plumbing.Revision(baseRef),
+	}
+	for _, revision := range revisions {
+		if hash, err := gitR.ResolveRevision(revision); err == nil {
+			return hash, nil
+		}
+	}
+	return nil, fmt.Errorf("base ref %s not found", baseRef)
+}
+
+// refHash returns the hash of the commit pointed by a resolved reference
+func refHash(ref *plumbing.Reference) *plumbing.Hash {
+	hash := ref.Hash()
+	return &hash
+}
+
+// createBranch creates the branch pointing to the commit of baseRef if it doesn't exist yet,
+// configured to track the branch with the same name of the remote repository.
+// It returns true if the branch has been created
+func createBranch(ctx context.Context, appName string, gitR *git.Repository, branchName plumbing.ReferenceName, baseRef string) (bool, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	if _, err := gitR.Reference(branchName, false); err == nil {
+		return false, nil
+	}
+	if _, err := gitR.Reference(plumbing.NewRemoteReferenceName(originRemoteName, branchName.Short()), false); err == nil {
+		return false, nil
+	}
+
+	hash, err := resolveBaseRef(gitR, baseRef)
+	if err != nil {
+		return false, err
+	}
+	logCtx.Infof("Creating branch %s from commit %s", branchName.Short(), hash)
+	if err = gitR.Storer.SetReference(plumbing.NewHashReference(branchName, *hash)); err != nil {
+		return false, err
+	}
+	if err = setBranchUpstream(gitR, branchName); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// setBranchUpstream configures the branch to track the branch with the same name of the remote repository
+func setBranchUpstream(gitR *git.Repository, branchName plumbing.ReferenceName) error {
+	err := gitR.CreateBranch(&config.Branch{
+		Name:   branchName.Short(),
+		Remote: originRemoteName,
+		Merge:  branchName,
+	})
+	if err != nil && err != git.ErrBranchExists {
+		return err
+	}
+	return nil
+}
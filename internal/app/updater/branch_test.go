@@ -0,0 +1,171 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const newGitRepoBranch = "release-2"
+
+// pushValuesCommit pushes to the branch of the repository served by s a commit updating the values
+// file of the example app to the image tag, tagged with an annotated tag with the same name
+func pushValuesCommit(t *testing.T, s *localGitServer, branch string, tag string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "push")
+	runGit(t, "clone", "-q", "-b", branch, filepath.Join(s.root, localGitRepoName), dir)
+	err := os.WriteFile(filepath.Join(dir, validHelmAppFileToChange), []byte("image:\n  tag: "+tag+"\n"), 0600)
+	assert.NilError(t, err)
+	runGit(t, "-C", dir, "commit", "-q", "-am", "release "+tag)
+	runGit(t, "-C", dir, "tag", "-a", tag, "-m", "release "+tag)
+	runGit(t, "-C", dir, "push", "-q", "origin", branch, tag)
+	return strings.TrimSpace(s.Git(t, "rev-parse", branch))
+}
+
+func TestUpdateApplicationLocalServerCreateBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	pushValuesCommit(t, server, validGitRepoBranch, "2.0.0")
+	releaseCommit := pushValuesCommit(t, server, validGitRepoBranch, "3.0.0")
+
+	tests := []struct {
+		name          string
+		baseRef       string
+		expectedValue string
+		expectedBase  string
+	}{
+		{name: "default branch", baseRef: "", expectedValue: "1.0.0", expectedBase: "main"},
+		{name: "branch", baseRef: validGitRepoBranch, expectedValue: "3.0.0", expectedBase: validGitRepoBranch},
+		{name: "tag", baseRef: "2.0.0", expectedValue: "2.0.0", expectedBase: "2.0.0^{commit}"},
+		{name: "commit", baseRef: releaseCommit, expectedValue: "3.0.0", expectedBase: releaseCommit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch := newGitRepoBranch + "-" + strings.ReplaceAll(tt.name, " ", "-")
+			cfg := newLocalGitServerConfig(server, []ChangeEntry{
+				{
+					NewValue: "4.0.0",
+					Key:      ".image.tag",
+				},
+			})
+			cfg.GitConf.Branch = branch
+			cfg.GitConf.CreateBranch = true
+			cfg.GitConf.BaseRef = tt.baseRef
+
+			syncState := NewSyncIterationState()
+			apps, err := UpdateApplication(context.Background(), cfg, syncState)
+			assert.NilError(t, err)
+			assert.Equal(t, (*apps)[0].OldValue, tt.expectedValue)
+
+			content := server.Git(t, "show", branch+":"+validHelmAppFileToChange)
+			assert.Equal(t, content, "image:\n  tag: 4.0.0\n")
+			assert.Equal(t, server.Git(t, "rev-parse", branch+"^"), server.Git(t, "rev-parse", tt.expectedBase))
+		})
+	}
+}
+
+func TestUpdateApplicationLocalServerCreateExistingBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.CreateBranch = true
+	cfg.GitConf.BaseRef = "main"
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	// the existing branch is updated without being recreated from the base ref
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch+"^"), developCommit)
+}
+
+func TestUpdateApplicationLocalServerCreateBranchInvalidBaseRef(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Branch = newGitRepoBranch
+	cfg.GitConf.CreateBranch = true
+	cfg.GitConf.BaseRef = "invalid-ref"
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.Error(t, err, "base ref invalid-ref not found")
+}
+
+func TestUpdateApplicationLocalServerCreateBranchShallowClone(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Branch = newGitRepoBranch
+	cfg.GitConf.CreateBranch = true
+	cfg.GitConf.ShallowClone = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.Error(t, err, "the branch creation can't be used with shallow clones")
+}
+
+func TestUpdateApplicationLocalServerCreateBranchSparsePaths(t *testing.T) {
+	server := newLocalGitServer(t, 3)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Branch = newGitRepoBranch
+	cfg.GitConf.CreateBranch = true
+	cfg.GitConf.SparsePaths = []string{validHelmAppName}
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	changes := server.Git(t, "diff", "--name-status", "main", newGitRepoBranch)
+	assert.Equal(t, changes, "M\t"+validHelmAppFileToChange+"\n")
+}
+
+func TestUpdateApplicationLocalRepoCreateBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+	cfg.GitConf.Branch = newGitRepoBranch
+	cfg.GitConf.CreateBranch = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	content := server.Git(t, "show", newGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	assert.Equal(t, server.Git(t, "rev-parse", newGitRepoBranch+"^"), server.Git(t, "rev-parse", "main"))
+	assert.Equal(t, localCheckoutGit(t, checkout, "config", "branch."+newGitRepoBranch+".merge"), "refs/heads/"+newGitRepoBranch+"\n")
+	assert.Equal(t, localCheckoutGit(t, checkout, "config", "branch."+newGitRepoBranch+".remote"), "origin\n")
+}
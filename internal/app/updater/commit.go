@@ -1,66 +1,232 @@
 package updater
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
 	"text/template"
 	"time"
 
+	"github.com/docplanner/helm-repo-updater/internal/app/cache"
 	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/lock"
 	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"github.com/go-git/go-billy/v5/memfs"
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// lockReleaseTimeout is the maximum duration of the release of the repository lock
+const lockReleaseTimeout = 30 * time.Second
+
+// ErrNothingToUpdate is returned, wrapped, by the updates when the values are already set, so there
+// is nothing to commit
+var ErrNothingToUpdate = errors.New("nothing to update, skipping commit")
+
 // UpdateApplication update all values of a single application.
-func UpdateApplication(cfg HelmUpdaterConfig, state *SyncIterationState) (*[]ChangeEntry, error) {
-	logCtx := log.WithContext().AddField("application", cfg.AppName)
-	appsChanges, err := commitChangesLocked(cfg, state)
+func UpdateApplication(ctx context.Context, cfg HelmUpdaterConfig, state *SyncIterationState) (*[]ChangeEntry, error) {
+	appsChanges, _, err := UpdateApplicationCommit(ctx, cfg, state)
+	return appsChanges, err
+}
+
+// UpdateApplicationCommit updates all values of a single application like UpdateApplication, also returning
+// the hash of the commit with the changes, which is empty when the changes are not committed by a dry run
+func UpdateApplicationCommit(ctx context.Context, cfg HelmUpdaterConfig, state *SyncIterationState) (*[]ChangeEntry, string, error) {
+	ctx = withLogFields(ctx, cfg)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
+	appsChanges, commit, err := commitChangesLocked(ctx, cfg, state, writeOverrides)
 	if err != nil {
 		logCtx.Errorf("Could not update application spec: %v", err)
 
-		return nil, err
+		return nil, "", err
 	}
 
 	logCtx.Infof("Successfully updated the live application spec")
+	notifyChanges(ctx, cfg, *appsChanges, commit)
 
-	return appsChanges, nil
+	return appsChanges, commit, nil
 
 }
 
-// commitChangesLocked commits the changes to the git repository.
-func commitChangesLocked(cfg HelmUpdaterConfig, state *SyncIterationState) (*[]ChangeEntry, error) {
-	lock := state.GetRepositoryLock(cfg.GitConf.RepoURL)
+// commitChangesLocked commits the changes written by write to the git repository, holding the lock
+// of the repository of the iteration until they are pushed
+func commitChangesLocked(ctx context.Context, cfg HelmUpdaterConfig, state *SyncIterationState, write changeWriter) (*[]ChangeEntry, string, error) {
+	lock := state.GetRepositoryLock(cfg.GitConf.PushURL())
 	lock.Lock()
 	defer lock.Unlock()
 
-	return commitChangesGit(cfg, writeOverrides)
+	return commitChangesGit(ctx, cfg, write)
+}
+
+// withLogFields returns a copy of ctx whose log contexts have the repository and branch of the update,
+// and the run id correlating its logs, which is generated unless ctx already has one
+func withLogFields(ctx context.Context, cfg HelmUpdaterConfig) context.Context {
+	ctx = log.ContextWithRunID(ctx, log.NewRunID())
+	ctx = log.ContextWithField(ctx, log.FieldRepo, log.RedactURL(cfg.GitConf.RepoURL))
+	if cfg.GitConf.Branch != "" {
+		ctx = log.ContextWithField(ctx, log.FieldBranch, cfg.GitConf.Branch)
+	}
+	return ctx
+}
+
+// releaseRepositoryLock releases the lock of the repository acquired from the lock backend,
+// even if the context of the update has been cancelled, keeping its values for the logs
+func releaseRepositoryLock(ctx context.Context, appName string, repoLock lock.Lock) {
+	ctx, cancel := context.WithTimeout(utils.WithoutCancel(ctx), lockReleaseTimeout)
+	defer cancel()
+	if err := repoLock.Release(ctx); err != nil {
+		log.FromContext(ctx).AddField(log.FieldApplication, appName).Errorf("could not release repository lock: %v", err)
+	}
+}
+
+// cancelOnLockLost returns a copy of ctx which is cancelled when the lock of the repository is lost,
+// so the update fails instead of going on after other process can take the lock over
+func cancelOnLockLost(ctx context.Context, appName string, repoLock lock.Lock) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-repoLock.Lost():
+			log.FromContext(ctx).AddField(log.FieldApplication, appName).Errorf("Repository lock lost, cancelling the update")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// lockLost returns true if the lock of the repository has been lost
+func lockLost(repoLock lock.Lock) bool {
+	select {
+	case <-repoLock.Lost():
+		return true
+	default:
+		return false
+	}
+}
+
+// withTimeout returns a context for a git operation which is cancelled after timeout,
+// the context is not limited if timeout is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// operationError returns the error of a git operation, indicating the cause when the operation
+// failed because its context was cancelled or its timeout was exceeded
+func operationError(ctx context.Context, operation string, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("git %s cancelled: %v", operation, ctx.Err())
+	}
+	return err
 }
 
 // cloneRepository clones the git repository in a temporal directory.
-func cloneRepository(appName string, repoURL string, authCreds transport.AuthMethod, tempRoot string) (*git.Repository, error) {
-	logCtx := log.WithContext().AddField("application", appName)
-	logCtx.Infof("Cloning git repository %s in temporal folder located in %s", repoURL, tempRoot)
-	r, err := git.PlainClone(tempRoot, false, &git.CloneOptions{
+func cloneRepository(ctx context.Context, appName string, gitConf git_internal.Conf, authCreds transport.AuthMethod, tempRoot string) (r *git.Repository, err error) {
+	ctx, span := tracing.Start(ctx, "clone", attribute.String("repo", log.RedactURL(gitConf.RepoURL)),
+		attribute.Bool("shallow", gitConf.ShallowClone), attribute.Bool("in_memory", gitConf.InMemory))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+	cloneOptions := &git.CloneOptions{
 		Auth:     authCreds,
-		URL:      repoURL,
+		URL:      gitConf.RepoURL,
 		Progress: os.Stdout,
-	})
+	}
+	if gitConf.ShallowClone {
+		logCtx.Debugf("Using a shallow clone of a single branch")
+		cloneOptions.Depth = 1
+		cloneOptions.SingleBranch = true
+		if gitConf.Branch != "" && gitConf.Branch != "HEAD" {
+			cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(gitConf.Branch)
+		}
+	}
+	if len(gitConf.SparsePaths) > 0 {
+		cloneOptions.NoCheckout = true
+	}
+	ctx, cancel := withTimeout(ctx, gitConf.Timeouts.Clone)
+	defer cancel()
+	if gitConf.InMemory {
+		logCtx.Infof("Cloning git repository %s in memory", gitConf.RepoURL)
+		r, err = git.CloneContext(ctx, memory.NewStorage(), memfs.New(), cloneOptions)
+		return r, operationError(ctx, "clone", err)
+	}
+	logCtx.Infof("Cloning git repository %s in temporal folder located in %s", gitConf.RepoURL, tempRoot)
+	r, err = git.PlainCloneContext(ctx, tempRoot, false, cloneOptions)
 	if err != nil {
-		return nil, err
+		return nil, operationError(ctx, "clone", err)
 	}
 	return r, nil
 }
 
+// getCacheMirror returns the mirror of the git repository stored in the cache directory,
+// updated with the latest changes of the remote
+func getCacheMirror(ctx context.Context, appName string, gitConf git_internal.Conf, authCreds transport.AuthMethod) (mirror *cache.Mirror, err error) {
+	ctx, span := tracing.Start(ctx, "fetch", attribute.String("repo", log.RedactURL(gitConf.RepoURL)), attribute.Bool("cache", true))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+	c, err := cache.New(gitConf.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	logCtx.Debugf("Using mirror of git repository %s located in %s", gitConf.RepoURL, c.MirrorPath(gitConf.RepoURL))
+
+	ctx, cancel := withTimeout(ctx, gitConf.Timeouts.Fetch)
+	defer cancel()
+	mirror, err = c.Mirror(ctx, gitConf.RepoURL, authCreds)
+	return mirror, operationError(ctx, "fetch", err)
+}
+
+// cloneRepositoryFromCache creates a working copy of the git repository in a temporal directory
+// sharing the objects of its mirror in the cache
+func cloneRepositoryFromCache(ctx context.Context, appName string, gitConf git_internal.Conf, mirror *cache.Mirror, tempRoot string) (*git.Repository, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+	logCtx.Infof("Creating working copy of git repository %s from cache in temporal folder located in %s", gitConf.RepoURL, tempRoot)
+
+	return mirror.NewWorktree(tempRoot, gitConf.RepoURL)
+}
+
+// commitSignatures returns the author and committer of the commit with the changes. The committer is the
+// user of the git credentials, which is the author too unless another author is configured. Both signatures
+// use the configured commit date, or the current time if it's not set
+func commitSignatures(cfg HelmUpdaterConfig) (author object.Signature, committer object.Signature) {
+	when := cfg.GitConf.CommitDate
+	if when.IsZero() {
+		when = time.Now()
+	}
+	committer = object.Signature{
+		Name:  cfg.GitCredentials.Username,
+		Email: cfg.GitCredentials.Email,
+		When:  when,
+	}
+	author = committer
+	if !cfg.GitConf.Author.IsZero() {
+		author.Name = cfg.GitConf.Author.Name
+		author.Email = cfg.GitConf.Author.Email
+	}
+	return author, committer
+}
+
 // commitGitChanges commit the changes in the necessary file/s to the working copy
 // of git repository
-func commitGitChanges(appName string, gitW git.Worktree, commitMessage string, gitUsername string, gitEmail string) (*plumbing.Hash, error) {
-	logCtx := log.WithContext().AddField("application", appName)
+func commitGitChanges(ctx context.Context, appName string, gitW git.Worktree, commitMessage string, author object.Signature, committer object.Signature) (*plumbing.Hash, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
 	// We can verify the current status of the worktree using the method Status.
 	logCtx.Debugf("Obtaining current status after changes")
 	status, err := gitW.Status()
@@ -71,11 +237,8 @@ func commitGitChanges(appName string, gitW git.Worktree, commitMessage string, g
 
 	logCtx.Infof("It's going to commit changes with message: %s", commitMessage)
 	commit, err := gitW.Commit(commitMessage, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  gitUsername,
-			Email: gitEmail,
-			When:  time.Now(),
-		},
+		Author:    &author,
+		Committer: &committer,
 	})
 	if err != nil {
 		return nil, err
@@ -84,63 +247,118 @@ func commitGitChanges(appName string, gitW git.Worktree, commitMessage string, g
 }
 
 // pushGitChanges push the changes to the remote repository
-func pushGitChanges(appName string, objC object.Commit, gitR *git.Repository, gitAuth transport.AuthMethod) error {
-	logCtx := log.WithContext().AddField("application", appName)
+func pushGitChanges(ctx context.Context, appName string, objC object.Commit, gitR *git.Repository, target *pushTarget, tags []plumbing.ReferenceName, timeout time.Duration) (err error) {
+	ctx, span := tracing.Start(ctx, "push", attribute.String("branch", target.branch.Short()), attribute.String("commit", objC.Hash.String()))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
 	logCtx.Infof("It's going to push commit with hash %s and message %s", objC.Hash, objC.Message)
 
-	logCtx.Infof("Pushing changes")
-	err := gitR.Push(&git.PushOptions{
-		Auth: gitAuth,
-	})
+	head, err := gitR.Head()
 	if err != nil {
 		return err
 	}
 
+	logCtx.Infof("Pushing changes to branch %s of %s", target.branch.Short(), log.RedactURL(target.remote.Config().URLs[0]))
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	err = target.remote.PushContext(ctx, target.pushOptions(head.Name(), tags))
+	metrics.GitPushDuration.Observe(metrics.Since(start))
+	if err != nil {
+		if target.lease != nil && ctx.Err() == nil {
+			return fmt.Errorf("could not push to branch %s leased at commit %s: %v", target.branch.Short(), target.lease, err)
+		}
+		return operationError(ctx, "push", err)
+	}
+
 	logCtx.Infof("Successfully pushed changes")
 
 	return nil
 }
 
-// commitAndPushGitChanges perfoms a git commit for the given pathSpec to the currently checked
-// out branch and after pushes local changes to the remote branch
-func commitAndPushGitChanges(cfg HelmUpdaterConfig, commitMessage string, gitW git.Worktree, tempRoot string, gitAuth transport.AuthMethod) error {
-	logCtx := log.WithContext().AddField("application", cfg.AppName)
-
-	targetFile := path.Join(cfg.GitConf.File, cfg.File)
-	logCtx.Infof("Adding file %s to git for commit changes", targetFile)
-	_, err := gitW.Add(targetFile)
-	if err != nil {
-		return err
+// changedFiles returns the files of the git repository changed, which are the ones of the changes
+// when several applications are updated, or the file of the application otherwise
+func changedFiles(cfg HelmUpdaterConfig, apps []ChangeEntry) []string {
+	var files []string
+	added := make(map[string]bool)
+	for _, app := range apps {
+		if app.File != "" && !added[app.File] {
+			added[app.File] = true
+			files = append(files, path.Join(cfg.GitConf.File, app.File))
+		}
 	}
+	if len(files) == 0 {
+		files = append(files, path.Join(cfg.GitConf.File, cfg.File))
+	}
+	return files
+}
 
-	commit, err := commitGitChanges(cfg.AppName, gitW, commitMessage, cfg.GitCredentials.Username, cfg.GitCredentials.Email)
-	if err != nil {
-		return err
+// commitAndPushGitChanges perfoms a git commit for the given files to the currently checked
+// out branch, tagging it if a tag name is given, and after pushes local changes to the push target
+func commitAndPushGitChanges(ctx context.Context, cfg HelmUpdaterConfig, commitMessage string, tagName string, files []string, gitR *git.Repository, gitW git.Worktree, target *pushTarget) (string, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
+
+	for _, targetFile := range files {
+		logCtx.Infof("Adding file %s to git for commit changes", targetFile)
+		if len(cfg.GitConf.SparsePaths) == 0 {
+			if _, err := gitW.Add(targetFile); err != nil {
+				return "", err
+			}
+		}
 	}
 
-	gitR, err := git.PlainOpen(tempRoot)
+	var commit *plumbing.Hash
+	var err error
+	_, span := tracing.Start(ctx, "commit", attribute.Int("files", len(files)))
+	author, committer := commitSignatures(cfg)
+	if len(cfg.GitConf.SparsePaths) > 0 {
+		commit, err = commitSparseChanges(ctx, cfg.AppName, gitR, gitW.Filesystem, files, commitMessage, author, committer)
+	} else {
+		commit, err = commitGitChanges(ctx, cfg.AppName, gitW, commitMessage, author, committer)
+	}
+	if commit != nil {
+		span.SetAttributes(attribute.String("commit", commit.String()))
+	}
+	endSpan(span, err)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	ctx = log.ContextWithField(ctx, log.FieldCommit, commit.String())
+	logCtx = log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
 	logCtx.Debugf("Obtaining current HEAD to verify added changes")
 	obj, err := gitR.CommitObject(*commit)
 	if err != nil {
-		return err
+		return "", err
 	}
-	err = pushGitChanges(cfg.AppName, *obj, gitR, gitAuth)
+	var tags []plumbing.ReferenceName
+	if tagName != "" {
+		tag, err := createTag(ctx, cfg.AppName, gitR, tagName, obj.Hash, commitMessage, cfg.GitConf.Tag, committer)
+		if err != nil {
+			return "", err
+		}
+		tags = append(tags, tag.Name())
+	}
+	if cfg.GitConf.SkipPush {
+		logCtx.Infof("Skipping push of commit with hash %s", obj.Hash)
+		return obj.Hash.String(), nil
+	}
+	err = pushGitChanges(ctx, cfg.AppName, *obj, gitR, target, tags, cfg.GitConf.Timeouts.Push)
 	if err != nil {
-		return err
+		return "", failed(reasonPush, err)
 	}
 
-	return nil
+	return obj.Hash.String(), nil
 }
 
-// configureCommitMessage configure the git commit message
-func configureCommitMessage(appName string, apps []ChangeEntry, helmUpdaterConfigMessage *template.Template) (*string, error) {
+// configureCommitMessage configure the git commit message, with the trailers at the end
+func configureCommitMessage(ctx context.Context, appName string, apps []ChangeEntry, helmUpdaterConfigMessage *template.Template, trailers []git_internal.Trailer) (*string, error) {
 	var gitCommitMessage string
 
-	logCtx := log.WithContext().AddField("application", appName)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
 
 	if len(apps) > 0 && helmUpdaterConfigMessage != nil {
 		gitCommitMessage = TemplateCommitMessage(helmUpdaterConfigMessage, appName, apps)
@@ -155,31 +373,15 @@ func configureCommitMessage(appName string, apps []ChangeEntry, helmUpdaterConfi
 		gitCommitMessage = TemplateCommitMessage(tpl, appName, apps)
 		logCtx.Debugf("templated commit message successfully with value: %s", gitCommitMessage)
 	}
-	return &gitCommitMessage, nil
-}
 
-// createTempFileInDirectory creates a temporal directory where a copy of
-// the git repository is going to be stored.
-func createTempFileInDirectory(dirName string, applicationName string, repoURL string) (*string, error) {
-	logCtx := log.WithContext().AddField("application", applicationName)
-	tempRoot, err := ioutil.TempDir(os.TempDir(), dirName)
-	if err != nil {
-		return nil, err
-	}
-	logCtx.Debugf("Created temporal directory %s to clone repository %s", tempRoot, repoURL)
-	defer func() {
-		err := os.RemoveAll(tempRoot)
-		if err != nil {
-			logCtx.Errorf("could not remove temp dir: %v", err)
-		}
-	}()
-	return &tempRoot, nil
+	gitCommitMessage = git_internal.AppendTrailers(gitCommitMessage, trailers)
+	return &gitCommitMessage, nil
 }
 
 // getCheckoutBranchName obtain the name of the branch to be used
-func getCheckoutBranchName(gitConfBranch string, applicationName string, gitR git.Repository) (*plumbing.ReferenceName, error) {
+func getCheckoutBranchName(ctx context.Context, gitConfBranch string, applicationName string, gitR git.Repository) (*plumbing.ReferenceName, error) {
 	var checkOutBranch plumbing.ReferenceName
-	logCtx := log.WithContext().AddField("application", applicationName)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, applicationName)
 
 	logCtx.Tracef("targetRevision for update is '%s'", checkOutBranch)
 
@@ -213,113 +415,274 @@ func checkBranchExists(gitW git.Worktree, gitR git.Repository, checkOutBranchNam
 
 // getRepositoryWorktreeWithBranchUpdated obtain working tree of git repositoy and checks if an specific
 // branch exists already and pull latest changes
-func getRepositoryWorktreeWithBranchUpdated(gitConfBranch string, appName string, gitR git.Repository, creds transport.AuthMethod) (*git.Worktree, error) {
-	logCtx := log.WithContext().AddField("application", appName)
+func getRepositoryWorktreeWithBranchUpdated(ctx context.Context, gitConf git_internal.Conf, appName string, gitR git.Repository, creds transport.AuthMethod) (_ *git.Worktree, err error) {
+	ctx, span := tracing.Start(ctx, "checkout", attribute.String("branch", gitConf.Branch))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
 	gitW, err := gitR.Worktree()
 	if err != nil {
 		return nil, err
 	}
-	checkOutBranchName, err := getCheckoutBranchName(gitConfBranch, appName, gitR)
+	checkOutBranchName, err := getCheckoutBranchName(ctx, gitConf.Branch, appName, gitR)
 	if err != nil {
 		return nil, err
 	}
 
+	created := false
+	if gitConf.CreateBranch {
+		if created, err = createBranch(ctx, appName, &gitR, *checkOutBranchName, gitConf.BaseRef); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(gitConf.SparsePaths) > 0 {
+		// the repository has just been cloned, so the sparse checkout
+		// of the branch already contains the latest changes
+		if err = sparseCheckout(ctx, appName, &gitR, *checkOutBranchName, gitW.Filesystem, gitConf.SparsePaths); err != nil {
+			return nil, err
+		}
+		return gitW, nil
+	}
+
 	gitWUpdated, err := checkBranchExists(*gitW, gitR, *checkOutBranchName)
 	if err != nil {
 		return nil, err
 	}
+	if gitConf.ShallowClone || gitConf.CacheDir != "" || created {
+		// the shallow clone or the cache mirror has just fetched the latest commit of the branch,
+		// and a branch just created doesn't exist in the remote repository yet
+		return gitWUpdated, nil
+	}
 	// Pull the latest changes from the origin remote and merge into the current branch
 	logCtx.Infof("Pulling latest changes of branch %s", checkOutBranchName.Short())
-	err = gitW.Pull(&git.PullOptions{
+	pullCtx, pullSpan := tracing.Start(ctx, "pull", attribute.String("branch", checkOutBranchName.Short()))
+	pullCtx, cancel := withTimeout(pullCtx, gitConf.Timeouts.Pull)
+	defer cancel()
+	err = gitW.PullContext(pullCtx, &git.PullOptions{
 		Auth:          creds,
 		ReferenceName: *checkOutBranchName,
 	})
 
-	if err != nil {
-		if err.Error() != "already up-to-date" {
-			return nil, err
-		}
+	if err != nil && err.Error() != "already up-to-date" {
+		err = operationError(pullCtx, "pull", err)
+		endSpan(pullSpan, err)
+		return nil, err
 	}
+	pullSpan.End()
 	return gitWUpdated, nil
 }
 
 // fetchLatestChangesGitRepository fetch the latest changes in a git repository
-func fetchLatestChangesGitRepository(appName string, gitR git.Repository, creds transport.AuthMethod) (*git.Repository, error) {
-	logCtx := log.WithContext().AddField("application", appName)
+func fetchLatestChangesGitRepository(ctx context.Context, appName string, gitR git.Repository, creds transport.AuthMethod, timeout time.Duration) (_ *git.Repository, err error) {
+	ctx, span := tracing.Start(ctx, "fetch")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
 	logCtx.Debugf("Fetching latest changes of repository")
 
-	err := gitR.Fetch(&git.FetchOptions{
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	err = gitR.FetchContext(ctx, &git.FetchOptions{
 		RefSpecs: []config.RefSpec{"refs/*:refs/*", "HEAD:refs/heads/HEAD"},
 		Auth:     creds,
 		Force:    true,
 	})
 	if err != nil {
-		return nil, err
+		return nil, operationError(ctx, "fetch", err)
 	}
 
 	return &gitR, nil
 }
 
-// cloneGitRepositoryInBranch clone git repository with a specific branch checking if that branch exists already
-func cloneGitRepositoryInBranch(appName string, repoURL string, creds transport.AuthMethod, tempRoot string, gitConfBranch string) (*git.Worktree, error) {
-	gitR, err := cloneRepository(appName, repoURL, creds, tempRoot)
+// cloneGitRepositoryInBranch clone git repository with a specific branch checking if that branch exists already,
+// using the cache mirror when it is provided
+func cloneGitRepositoryInBranch(ctx context.Context, appName string, gitConf git_internal.Conf, creds transport.AuthMethod, tempRoot string, mirror *cache.Mirror) (*git.Repository, *git.Worktree, error) {
+	start := time.Now()
+	defer func() {
+		metrics.GitCloneDuration.Observe(metrics.Since(start))
+	}()
+
+	var gitR *git.Repository
+	var err error
+	if mirror != nil {
+		_, span := tracing.Start(ctx, "clone", attribute.String("repo", log.RedactURL(gitConf.RepoURL)), attribute.Bool("cache", true))
+		gitR, err = cloneRepositoryFromCache(ctx, appName, gitConf, mirror, tempRoot)
+		endSpan(span, err)
+	} else {
+		gitR, err = cloneRepository(ctx, appName, gitConf, creds, tempRoot)
+	}
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	gitR, err = fetchLatestChangesGitRepository(appName, *gitR, creds)
-	if err != nil {
-		return nil, err
+	// a shallow clone only contains the branch to be updated and the cache
+	// mirror has just been fetched, so there is nothing else to fetch
+	if !gitConf.ShallowClone && mirror == nil {
+		gitR, err = fetchLatestChangesGitRepository(ctx, appName, *gitR, creds, gitConf.Timeouts.Fetch)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	gitW, err := getRepositoryWorktreeWithBranchUpdated(gitConfBranch, appName, *gitR, creds)
+	gitW, err := getRepositoryWorktreeWithBranchUpdated(ctx, gitConf, appName, *gitR, creds)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return gitW, nil
+	return gitR, gitW, nil
 }
 
 // commitChangesGit commits any changes required for updating one or more values
-// after the UpdateApplication cycle has finished.
-func commitChangesGit(cfg HelmUpdaterConfig, write changeWriter) (*[]ChangeEntry, error) {
+// after the UpdateApplication cycle has finished, recording the result in the metrics.
+func commitChangesGit(ctx context.Context, cfg HelmUpdaterConfig, write changeWriter) (*[]ChangeEntry, string, error) {
+	ctx, span := tracing.Start(ctx, "update", attribute.String("application", cfg.AppName),
+		attribute.String("repo", log.RedactURL(cfg.GitConf.RepoURL)), attribute.String("branch", cfg.GitConf.Branch),
+		attribute.Bool("dry_run", cfg.DryRun))
+	apps, commit, err := writeAndCommitChanges(ctx, cfg, write)
+	if commit != "" {
+		span.SetAttributes(attribute.String("commit", commit))
+	}
+	if failure, ok := err.(*updateFailure); ok {
+		span.SetAttributes(attribute.String("failure_reason", failure.reason))
+	}
+	endSpan(span, err)
+	recordUpdate(err)
+	return apps, commit, err
+}
+
+// writeAndCommitChanges clones the git repository, writes the changes and commits them,
+// the errors are classified by the stage where they happened
+func writeAndCommitChanges(ctx context.Context, cfg HelmUpdaterConfig, write changeWriter) (_ *[]ChangeEntry, commit string, err error) {
 	var apps []ChangeEntry
 
-	logCtx := log.WithContext().AddField("application", cfg.AppName)
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
+	_, span := tracing.Start(ctx, "credentials")
 	creds, err := cfg.GitCredentials.NewGitCreds(cfg.GitConf.RepoURL, cfg.GitCredentials.Password)
+	var pushCreds transport.AuthMethod
+	if err == nil {
+		pushCreds, err = newPushCreds(cfg, creds)
+	}
+	endSpan(span, err)
 	if err != nil {
-		return nil, fmt.Errorf("could not get creds for repo '%s': %v", cfg.AppName, err)
+		return nil, "", failed(reasonCredentials, fmt.Errorf("could not get creds for repo '%s': %v", cfg.AppName, err))
 	}
 
-	tempRoot, err := createTempFileInDirectory(fmt.Sprintf("git-%s", cfg.AppName), cfg.AppName, cfg.GitConf.RepoURL)
-	if err != nil {
-		return nil, err
+	if cfg.LockBackend != nil {
+		// the lock is the one of the repository where the changes are pushed, which is the one being modified
+		repoLock, lockErr := cfg.LockBackend.Acquire(ctx, cfg.GitConf.PushURL(), pushCreds)
+		if lockErr != nil {
+			return nil, "", failed(reasonLock, lockErr)
+		}
+		defer releaseRepositoryLock(ctx, cfg.AppName, repoLock)
+
+		var cancel context.CancelFunc
+		ctx, cancel = cancelOnLockLost(ctx, cfg.AppName, repoLock)
+		defer cancel()
+		defer func() {
+			if err != nil && lockLost(repoLock) {
+				err = &updateFailure{reason: reasonLock, err: fmt.Errorf("repository lock lost before the update finished: %v", err)}
+			}
+		}()
 	}
 
-	gitW, err := cloneGitRepositoryInBranch(cfg.AppName, cfg.GitConf.RepoURL, creds, *tempRoot, cfg.GitConf.Branch)
-	if err != nil {
-		return nil, err
+	if cfg.GitConf.CacheDir != "" && (cfg.GitConf.InMemory || cfg.GitConf.ShallowClone) {
+		return nil, "", failed(reasonConfig, fmt.Errorf("the cache directory can't be used with in memory or shallow clones"))
+	}
+	if cfg.GitConf.CreateBranch && cfg.GitConf.ShallowClone {
+		return nil, "", failed(reasonConfig, fmt.Errorf("the branch creation can't be used with shallow clones"))
+	}
+	if cfg.GitConf.LocalRepo != "" && (cfg.GitConf.CacheDir != "" || cfg.GitConf.InMemory || cfg.GitConf.ShallowClone || len(cfg.GitConf.SparsePaths) > 0) {
+		return nil, "", failed(reasonConfig, fmt.Errorf("the local repository can't be used with the cache directory, in memory, shallow or sparse clones"))
+	}
+
+	var mirror *cache.Mirror
+	if cfg.GitConf.CacheDir != "" {
+		if mirror, err = getCacheMirror(ctx, cfg.AppName, *cfg.GitConf, creds); err != nil {
+			return nil, "", failed(reasonClone, fmt.Errorf("could not get mirror of repo '%s' from cache: %v", cfg.GitConf.RepoURL, err))
+		}
+		defer mirror.Release()
+	}
+
+	var tempRoot string
+	var gitR *git.Repository
+	var gitW *git.Worktree
+	if cfg.GitConf.LocalRepo != "" {
+		gitR, gitW, err = openLocalRepositoryInBranch(ctx, cfg.AppName, *cfg.GitConf, creds)
+		if err != nil {
+			return nil, "", failed(reasonClone, err)
+		}
+		head, err := gitR.Head()
+		if err != nil {
+			return nil, "", failed(reasonClone, err)
+		}
+		// the checkout is the one of the user, so it's restored when the changes are not committed, or the
+		// commit is not pushed, to let the next updates use it
+		defer func() {
+			if commit != "" {
+				return
+			}
+			if restoreErr := restoreLocalRepository(gitR, gitW, head.Hash()); restoreErr != nil {
+				logCtx.Errorf("could not restore local repository %s: %v", cfg.GitConf.LocalRepo, restoreErr)
+			}
+		}()
+	} else {
+		if !cfg.GitConf.InMemory {
+			ws, err := newWorkspace(ctx, cfg.AppName, cfg.GitConf.RepoURL, cfg.KeepWorkspace)
+			if err != nil {
+				return nil, "", failed(reasonClone, err)
+			}
+			defer ws.Cleanup()
+			tempRoot = ws.Root
+		}
+
+		gitR, gitW, err = cloneGitRepositoryInBranch(ctx, cfg.AppName, *cfg.GitConf, creds, tempRoot, mirror)
+		if err != nil {
+			return nil, "", failed(reasonClone, err)
+		}
+	}
+
+	var target *pushTarget
+	if !cfg.GitConf.SkipPush {
+		if target, err = getPushTarget(ctx, cfg.AppName, *cfg.GitConf, gitR, pushCreds); err != nil {
+			return nil, "", failed(reasonPush, err)
+		}
 	}
 
 	// write changes to files
-	if apps, err = write(cfg, *tempRoot, *gitW); err != nil {
-		return nil, err
+	if apps, err = write(ctx, cfg, tempRoot, *gitW); err != nil {
+		return nil, "", failed(reasonWrite, err)
 	}
 
-	commitMessage, err := configureCommitMessage(cfg.AppName, apps, cfg.GitConf.Message)
+	commitMessage, err := configureCommitMessage(ctx, cfg.AppName, apps, cfg.GitConf.Message, cfg.GitConf.Trailers)
 	if err != nil {
-		return nil, err
+		return nil, "", failed(reasonTemplate, err)
+	}
+
+	var tagName string
+	if cfg.GitConf.Tag.NameTemplate != nil {
+		if tagName, err = TemplateTagName(cfg.GitConf.Tag.NameTemplate, cfg.AppName, apps); err != nil {
+			return nil, "", failed(reasonTemplate, err)
+		}
 	}
 
 	if cfg.DryRun {
-		logCtx.Infof("dry run, not committing changes")
-		return &apps, nil
+		if tagName != "" {
+			logCtx.Infof("dry run, not committing changes nor creating tag %s", tagName)
+		} else {
+			logCtx.Infof("dry run, not committing changes")
+		}
+		return &apps, "", nil
 	}
 
-	err = commitAndPushGitChanges(cfg, *commitMessage, *gitW, *tempRoot, creds)
+	commit, err = commitAndPushGitChanges(ctx, cfg, *commitMessage, tagName, changedFiles(cfg, apps), gitR, *gitW, target)
 	if err != nil {
-		return nil, err
+		return nil, "", failed(reasonCommit, err)
 	}
 
-	return &apps, nil
+	return &apps, commit, nil
 }
@@ -1,12 +1,19 @@
 package updater
 
 import (
+	"context"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/docplanner/helm-repo-updater/internal/app/git"
 	app_utils "github.com/docplanner/helm-repo-updater/internal/app/utils"
@@ -69,10 +76,8 @@ func TestUpdateApplicationDryRunNoChangesEntries(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
-	expectedErrorMessage := "nothing to update, skipping commit"
-
-	assert.Error(t, err, expectedErrorMessage)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
 }
 
 func TestUpdateApplicationDryRunNoChanges(t *testing.T) {
@@ -121,10 +126,8 @@ func TestUpdateApplicationDryRunNoChanges(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
-	expectedErrorMessage := "nothing to update, skipping commit"
-
-	assert.Error(t, err, expectedErrorMessage)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
 }
 
 func TestUpdateApplicationDryRun(t *testing.T) {
@@ -173,7 +176,7 @@ func TestUpdateApplicationDryRun(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	apps, err := UpdateApplication(cfg, syncState)
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
 
 	if err != nil {
 		log.Fatal(err)
@@ -230,7 +233,7 @@ func TestUpdateApplicationDryRunSSHPrivKeyString(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	apps, err := UpdateApplication(cfg, syncState)
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
 
 	if err != nil {
 		log.Fatal(err)
@@ -285,7 +288,7 @@ func TestUpdateApplicationDryRunInvalidFile(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
 
 	expectedErrorMessage1 := fmt.Sprintf("stat %s", os.TempDir())
 	expectedErrorMessage2 := fmt.Sprintf("%s: no such file or directory", incorrectFile)
@@ -337,7 +340,7 @@ func TestUpdateApplicationDryRunNoRepoURL(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
 	errorMessage := fmt.Sprintf("could not get creds for repo '%s': unknown repository type for git repository URL", cfg.AppName)
 
 	assert.ErrorContains(t, err, errorMessage)
@@ -389,7 +392,7 @@ func TestUpdateApplicationDryRunInvalidGitRepo(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
 	expectErrorMessage := "repository not found"
 	assert.Error(t, err, expectErrorMessage)
 }
@@ -440,7 +443,7 @@ func TestUpdateApplicationDryRunInvalidGitBranch(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	_, err = UpdateApplication(cfg, syncState)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
 
 	expectedErrorMessage := "reference not found"
 	assert.Error(t, err, expectedErrorMessage)
@@ -498,7 +501,7 @@ func TestUpdateApplicationDryRunWithGitMessage(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	apps, err := UpdateApplication(cfg, syncState)
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
 
 	if err != nil {
 		log.Fatal(err)
@@ -563,7 +566,7 @@ func TestUpdateApplicationDryRunInvalidKey(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	apps, err := UpdateApplication(cfg, syncState)
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
 
 	if err != nil {
 		log.Fatal(err)
@@ -618,16 +621,15 @@ func TestUpdateApplication(t *testing.T) {
 	}
 
 	syncState := NewSyncIterationState()
-	apps, err := UpdateApplication(cfg, syncState)
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
 	if err != nil {
 		log.Fatal(err)
 	}
 	assert.DeepEqual(t, *apps, changeEntries)
 
 	cfg.AllowErrorNothingToUpdate = false
-	_, err = UpdateApplication(cfg, syncState)
-	expectedErrorMessage := "nothing to update, skipping commit"
-	assert.Error(t, err, expectedErrorMessage)
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
 }
 
 func getSSHRepoHostnameAndPort() string {
@@ -638,3 +640,276 @@ func getSSHRepoHostnameAndPort() string {
 	}
 	return SSHRepoCIHostname
 }
+
+func TestUpdateApplicationLocalServer(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	changeEntries := []ChangeEntry{
+		{
+			OldValue: "1.0.0",
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	}
+	cfg := newLocalGitServerConfig(server, changeEntries)
+
+	syncState := NewSyncIterationState()
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *apps, changeEntries)
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+}
+
+func TestUpdateApplicationLocalServerShallowClone(t *testing.T) {
+	server := newLocalGitServer(t, 10)
+
+	changeEntries := []ChangeEntry{
+		{
+			OldValue: "1.0.0",
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	}
+	cfg := newLocalGitServerConfig(server, changeEntries)
+	cfg.GitConf.ShallowClone = true
+
+	syncState := NewSyncIterationState()
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *apps, changeEntries)
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	server.Git(t, "fsck", "--strict")
+}
+
+func TestUpdateApplicationLocalServerShallowCloneInvalidGitBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			OldValue: "1.0.0",
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Branch = invalidGitRepoBranch
+	cfg.GitConf.ShallowClone = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+
+	expectedErrorMessage := fmt.Sprintf("couldn't find remote ref %q", "refs/heads/"+invalidGitRepoBranch)
+	assert.Error(t, err, expectedErrorMessage)
+}
+
+func benchmarkUpdateApplicationLocalServer(b *testing.B, shallowClone bool) {
+	server := newLocalGitServer(b, 200)
+	b.ResetTimer()
+
+	tags := []string{"1.1.0", "1.0.0"}
+	for i := 0; i < b.N; i++ {
+		cfg := newLocalGitServerConfig(server, []ChangeEntry{
+			{
+				Key:      ".image.tag",
+				NewValue: tags[i%len(tags)],
+			},
+		})
+		cfg.GitConf.ShallowClone = shallowClone
+
+		syncState := NewSyncIterationState()
+		if _, err := UpdateApplication(context.Background(), cfg, syncState); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateApplicationFullClone(b *testing.B) {
+	benchmarkUpdateApplicationLocalServer(b, false)
+}
+
+func BenchmarkUpdateApplicationShallowClone(b *testing.B) {
+	benchmarkUpdateApplicationLocalServer(b, true)
+}
+
+func TestUpdateApplicationLocalServerInMemory(t *testing.T) {
+	for _, sparsePaths := range [][]string{nil, {validHelmAppName}} {
+		server := newLocalGitServer(t, 1)
+
+		changeEntries := []ChangeEntry{
+			{
+				OldValue: "1.0.0",
+				NewValue: "1.1.0",
+				Key:      ".image.tag",
+			},
+		}
+		cfg := newLocalGitServerConfig(server, changeEntries)
+		cfg.GitConf.InMemory = true
+		cfg.GitConf.ShallowClone = true
+		cfg.GitConf.SparsePaths = sparsePaths
+
+		syncState := NewSyncIterationState()
+		apps, err := UpdateApplication(context.Background(), cfg, syncState)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, *apps, changeEntries)
+
+		content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+		assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	}
+}
+
+func TestUpdateApplicationLocalServerInMemoryInvalidFile(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			OldValue: "1.0.0",
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.DryRun = true
+	cfg.GitConf.InMemory = true
+	cfg.File = validHelmAppName + "/values.yamll"
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+
+	assert.ErrorContains(t, err, "file does not exist")
+}
+
+func TestUpdateApplicationLocalServerCacheDir(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cacheDir := t.TempDir()
+
+	for _, newValue := range []string{"1.1.0", "1.2.0"} {
+		cfg := newLocalGitServerConfig(server, []ChangeEntry{
+			{
+				NewValue: newValue,
+				Key:      ".image.tag",
+			},
+		})
+		cfg.GitConf.CacheDir = cacheDir
+
+		syncState := NewSyncIterationState()
+		_, err := UpdateApplication(context.Background(), cfg, syncState)
+		assert.NilError(t, err)
+
+		content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+		assert.Equal(t, content, "image:\n  tag: "+newValue+"\n")
+	}
+	server.Git(t, "fsck", "--strict")
+
+	mirrors, err := filepath.Glob(filepath.Join(cacheDir, "*.git"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(mirrors), 1)
+}
+
+func TestUpdateApplicationLocalServerCacheDirInMemory(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.CacheDir = t.TempDir()
+	cfg.GitConf.InMemory = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.Error(t, err, "the cache directory can't be used with in memory or shallow clones")
+}
+
+// newHangingGitServer returns the configuration of a git server which never answers the requests
+func newHangingGitServer(t *testing.T) *git.Conf {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caContent := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caContent, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	installTestTransport(t, caFile)
+
+	return &git.Conf{
+		RepoURL: server.URL + "/" + localGitRepoName,
+		Branch:  validGitRepoBranch,
+	}
+}
+
+func TestUpdateApplicationCloneTimeout(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	cfg := HelmUpdaterConfig{
+		AppName: validHelmAppName,
+		UpdateApps: []ChangeEntry{
+			{
+				NewValue: "1.1.0",
+				Key:      ".image.tag",
+			},
+		},
+		File: validHelmAppFileToChange,
+		GitCredentials: &git.Credentials{
+			Email:    validGitCredentialsEmail,
+			Username: validGitCredentialsUsername,
+			Password: "test-password",
+		},
+		GitConf: newHangingGitServer(t),
+	}
+	cfg.GitConf.Timeouts.Clone = 200 * time.Millisecond
+
+	syncState := NewSyncIterationState()
+	start := time.Now()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "git clone cancelled: context deadline exceeded")
+	assert.Assert(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, len(workspacesInTempDir(t)), 0)
+}
+
+func TestUpdateApplicationContextCancelled(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(ctx, cfg, syncState)
+	assert.ErrorContains(t, err, "git clone cancelled: context canceled")
+}
+
+func TestUpdateApplicationPushTimeout(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	remoteHead := server.Git(t, "rev-parse", validGitRepoBranch)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Timeouts.Push = time.Nanosecond
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "git push cancelled: context deadline exceeded")
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), remoteHead)
+}
@@ -2,6 +2,8 @@ package updater
 
 import (
 	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/lock"
+	"github.com/docplanner/helm-repo-updater/internal/app/notify"
 )
 
 // HelmUpdaterConfig contains global configuration and required runtime data
@@ -14,6 +16,12 @@ type HelmUpdaterConfig struct {
 	GitCredentials            *git.Credentials
 	GitConf                   *git.Conf
 	AllowErrorNothingToUpdate bool
+	// KeepWorkspace keeps the temporal directory where the git repository is cloned after the update
+	KeepWorkspace bool
+	// LockBackend coordinates the updates of the git repository with other processes, not used if nil
+	LockBackend lock.Backend
+	// Notifier is notified of the changes pushed to the git repository, not used if nil
+	Notifier notify.Notifier
 }
 
 // ChangeEntry represents values that has been changed by Helm Repo Updater
@@ -22,4 +30,6 @@ type ChangeEntry struct {
 	NewValue string
 	File     string
 	Key      string
+	// App is the application of the change, only set by the updates of several applications
+	App string
 }
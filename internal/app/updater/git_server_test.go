@@ -0,0 +1,141 @@
+package updater
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/git"
+)
+
+const (
+	localGitRepoName       = "test-repo.git"
+	localGitRepoValuesFile = "image:\n  tag: 1.0.0\n"
+)
+
+// localGitServer is a git smart HTTP server stand-in backed by git http-backend
+type localGitServer struct {
+	*httptest.Server
+	root   string
+	caFile string
+}
+
+// RepoURL returns the url of the repository served
+func (s *localGitServer) RepoURL() string {
+	return s.URL + "/" + localGitRepoName
+}
+
+// Conf returns the git configuration needed to use the repository served
+func (s *localGitServer) Conf(branch string) *git.Conf {
+	return &git.Conf{
+		RepoURL: s.RepoURL(),
+		Branch:  branch,
+	}
+}
+
+// Git runs a git command against the bare repository served
+func (s *localGitServer) Git(t testing.TB, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", filepath.Join(s.root, localGitRepoName)}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %v failed: %v", args, err)
+	}
+	return string(out)
+}
+
+// runGit runs a git command failing the test if it is not successful
+func runGit(t testing.TB, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=" + validGitCredentialsUsername, "-c", "user.email=" + validGitCredentialsEmail}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+}
+
+// newLocalGitServer creates a bare repository with the develop branch containing the values file
+// of the example app preceded by historySize commits, and serves it using TLS
+func newLocalGitServer(t testing.TB, historySize int) *localGitServer {
+	t.Helper()
+	gitBin, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git binary is required to run the git HTTP server stand-in")
+	}
+
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	runGit(t, "init", "-q", src)
+	for i := 0; i < historySize; i++ {
+		historyFile := filepath.Join(src, "history", fmt.Sprintf("file-%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(historyFile), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(historyFile, []byte(fmt.Sprintf("content of commit %d\n", i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, "-C", src, "add", ".")
+		runGit(t, "-C", src, "commit", "-q", "-m", fmt.Sprintf("commit %d", i))
+	}
+	valuesFile := filepath.Join(src, validHelmAppFileToChange)
+	if err := os.MkdirAll(filepath.Dir(valuesFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(valuesFile, []byte(localGitRepoValuesFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, "-C", src, "add", ".")
+	runGit(t, "-C", src, "commit", "-q", "-m", "add example app")
+	runGit(t, "-C", src, "branch", "-M", "main")
+	runGit(t, "-C", src, "branch", validGitRepoBranch)
+	runGit(t, "clone", "-q", "--bare", src, filepath.Join(root, localGitRepoName))
+	runGit(t, "-C", filepath.Join(root, localGitRepoName), "config", "http.receivepack", "true")
+
+	server := httptest.NewTLSServer(&cgi.Handler{
+		Path: gitBin,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + root,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	})
+	t.Cleanup(server.Close)
+
+	caFile := filepath.Join(root, "ca.crt")
+	caContent := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, caContent, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	installTestTransport(t, caFile)
+
+	return &localGitServer{Server: server, root: root, caFile: caFile}
+}
+
+// installTestTransport installs the git transport trusting the certificate of the test servers, which is
+// the same for all the servers created by httptest
+func installTestTransport(t testing.TB, caFile string) {
+	t.Helper()
+	if err := (git.TransportConf{CAFile: caFile}).Install(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newLocalGitServerConfig returns a configuration updating the example app in the repository served by s
+func newLocalGitServerConfig(s *localGitServer, changeEntries []ChangeEntry) HelmUpdaterConfig {
+	return HelmUpdaterConfig{
+		LogLevel:   "info",
+		AppName:    validHelmAppName,
+		UpdateApps: changeEntries,
+		File:       validHelmAppFileToChange,
+		GitCredentials: &git.Credentials{
+			Email:    validGitCredentialsEmail,
+			Username: validGitCredentialsUsername,
+			Password: "test-password",
+		},
+		GitConf: s.Conf(validGitRepoBranch),
+	}
+}
@@ -0,0 +1,85 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// HistoryEntry is a commit of the repository with trailers in its message
+type HistoryEntry struct {
+	Hash     string                 `json:"hash"`
+	Author   string                 `json:"author"`
+	When     time.Time              `json:"when"`
+	Subject  string                 `json:"subject"`
+	Trailers []git_internal.Trailer `json:"trailers"`
+}
+
+// ReadHistory returns the latest commits with trailers reachable from rev in the repository located
+// in repoPath, up to maxCount commits when greater than zero. Only the commits having all the filter
+// trailers are returned, a filter without value matches any value of the trailer
+func ReadHistory(repoPath string, rev string, maxCount int, filters []git_internal.Trailer) ([]HistoryEntry, error) {
+	gitR, err := git.PlainOpenWithOptions(repoPath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not open repository %s: %v", repoPath, err)
+	}
+	if rev == "" {
+		rev = string(plumbing.HEAD)
+	}
+	hash, err := gitR.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve revision %s: %v", rev, err)
+	}
+	commits, err := gitR.Log(&git.LogOptions{From: *hash})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	var entries []HistoryEntry
+	err = commits.ForEach(func(c *object.Commit) error {
+		trailers := git_internal.ParseTrailers(c.Message)
+		if len(trailers) == 0 || !matchTrailers(trailers, filters) {
+			return nil
+		}
+		entries = append(entries, HistoryEntry{
+			Hash:     c.Hash.String(),
+			Author:   fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email),
+			When:     c.Author.When,
+			Subject:  strings.SplitN(c.Message, "\n", 2)[0],
+			Trailers: trailers,
+		})
+		if maxCount > 0 && len(entries) >= maxCount {
+			return storer.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// matchTrailers checks that every filter matches one of the trailers, comparing the keys without case
+func matchTrailers(trailers []git_internal.Trailer, filters []git_internal.Trailer) bool {
+	for _, filter := range filters {
+		matched := false
+		for _, t := range trailers {
+			if strings.EqualFold(t.Key, filter.Key) && (filter.Value == "" || t.Value == filter.Value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
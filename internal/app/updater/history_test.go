@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"gotest.tools/v3/assert"
+)
+
+var validCommitTrailers = []git.Trailer{
+	{Key: "Co-authored-by", Value: "test-user <test-user@example.com>"},
+	{Key: "Change-Id", Value: "run-1"},
+	{Key: "Pipeline-URL", Value: "https://ci.example.com/pipelines/1"},
+}
+
+func TestUpdateApplicationLocalServerCommitTrailers(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Trailers = validCommitTrailers
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	// the trailers are recognized by git
+	trailers := server.Git(t, "log", "-1", "--format=%(trailers:only)", validGitRepoBranch)
+	assert.Equal(t, trailers, "Co-authored-by: test-user <test-user@example.com>\nChange-Id: run-1\nPipeline-URL: https://ci.example.com/pipelines/1\n\n")
+	changeID := server.Git(t, "log", "-1", "--format=%(trailers:key=Change-Id,valueonly)", validGitRepoBranch)
+	assert.Equal(t, changeID, "run-1\n\n")
+}
+
+func TestReadHistory(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+
+	for i, value := range []string{"1.1.0", "1.2.0", "1.3.0"} {
+		cfg := newLocalGitServerConfig(server, []ChangeEntry{
+			{
+				NewValue: value,
+				Key:      ".image.tag",
+			},
+		})
+		cfg.GitConf.LocalRepo = checkout
+		cfg.GitConf.SkipPush = true
+		// the second update is made without trailers
+		if i != 1 {
+			cfg.GitConf.Trailers = []git.Trailer{
+				{Key: "Change-Id", Value: "run-" + value},
+				{Key: "Pipeline-URL", Value: "https://ci.example.com/pipelines/1"},
+			}
+		}
+		syncState := NewSyncIterationState()
+		_, err := UpdateApplication(context.Background(), cfg, syncState)
+		assert.NilError(t, err)
+	}
+
+	entries, err := ReadHistory(checkout, "", 0, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 2)
+	assert.Equal(t, entries[0].Subject, "🚀 automatic update of "+validHelmAppName)
+	assert.Equal(t, entries[0].Author, validGitCredentialsUsername+" <"+validGitCredentialsEmail+">")
+	assert.DeepEqual(t, entries[0].Trailers, []git.Trailer{
+		{Key: "Change-Id", Value: "run-1.3.0"},
+		{Key: "Pipeline-URL", Value: "https://ci.example.com/pipelines/1"},
+	})
+	assert.Equal(t, entries[1].Trailers[0].Value, "run-1.1.0")
+
+	entries, err = ReadHistory(checkout, validGitRepoBranch, 1, nil)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Trailers[0].Value, "run-1.3.0")
+
+	entries, err = ReadHistory(checkout, "", 0, []git.Trailer{{Key: "change-id", Value: "run-1.1.0"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Trailers[0].Value, "run-1.1.0")
+
+	entries, err = ReadHistory(checkout, "", 0, []git.Trailer{{Key: "Pipeline-URL"}, {Key: "Source-Commit"}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 0)
+
+	_, err = ReadHistory(checkout, "invalid-ref", 0, nil)
+	assert.ErrorContains(t, err, "could not resolve revision invalid-ref")
+}
@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/git"
+	"gotest.tools/v3/assert"
+)
+
+const commitIdentityFormat = "--format=%an|%ae|%aI|%cn|%ce|%cI"
+
+var (
+	validCommitAuthor = git.Identity{Name: "pipeline-user", Email: "pipeline-user@example.com"}
+	validCommitDate   = time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+)
+
+func TestUpdateApplicationLocalServerCommitIdentities(t *testing.T) {
+	tests := []struct {
+		name        string
+		sparsePaths []string
+	}{
+		{name: "full clone"},
+		{name: "sparse clone", sparsePaths: []string{validHelmAppName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newLocalGitServer(t, 1)
+
+			cfg := newLocalGitServerConfig(server, []ChangeEntry{
+				{
+					NewValue: "1.1.0",
+					Key:      ".image.tag",
+				},
+			})
+			cfg.GitConf.SparsePaths = tt.sparsePaths
+			cfg.GitConf.Author = validCommitAuthor
+			cfg.GitConf.CommitDate = validCommitDate
+
+			syncState := NewSyncIterationState()
+			_, err := UpdateApplication(context.Background(), cfg, syncState)
+			assert.NilError(t, err)
+
+			identities := server.Git(t, "log", "-1", commitIdentityFormat, validGitRepoBranch)
+			assert.Equal(t, identities, strings.Join([]string{
+				validCommitAuthor.Name,
+				validCommitAuthor.Email,
+				"2023-11-14T22:13:20+00:00",
+				validGitCredentialsUsername,
+				validGitCredentialsEmail,
+				"2023-11-14T22:13:20+00:00",
+			}, "|")+"\n")
+		})
+	}
+}
+
+func TestUpdateApplicationLocalServerCommitDefaultIdentities(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+
+	before := time.Now().Add(-time.Second)
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	// the committer is the author and the current time is used
+	identities := strings.Split(strings.TrimSpace(server.Git(t, "log", "-1", commitIdentityFormat, validGitRepoBranch)), "|")
+	assert.DeepEqual(t, identities[:2], []string{validGitCredentialsUsername, validGitCredentialsEmail})
+	assert.DeepEqual(t, identities[3:5], []string{validGitCredentialsUsername, validGitCredentialsEmail})
+	commitDate, err := time.Parse(time.RFC3339, identities[5])
+	assert.NilError(t, err)
+	assert.Assert(t, commitDate.After(before))
+	assert.Equal(t, identities[2], identities[5])
+}
+
+func TestUpdateApplicationLocalServerTagIdentity(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Author = validCommitAuthor
+	cfg.GitConf.CommitDate = validCommitDate
+	cfg.GitConf.Tag.NameTemplate = template.Must(template.New("tagName").Parse(validTagTemplate))
+	cfg.GitConf.Tag.Annotated = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	// the tag is created by the committer
+	tagger := server.Git(t, "for-each-ref", "--format=%(taggername)|%(taggeremail)|%(taggerdate:iso-strict)", "refs/tags/"+validHelmAppName+"-1.1.0")
+	assert.Equal(t, tagger, validGitCredentialsUsername+"|<"+validGitCredentialsEmail+">|2023-11-14T22:13:20+00:00\n")
+}
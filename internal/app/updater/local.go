@@ -0,0 +1,200 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// checkWorktreeClean checks that the working tree doesn't have changes in the files tracked by git,
+// so the commit created only contains the changes done by the updater
+func checkWorktreeClean(gitW git.Worktree) error {
+	status, err := gitW.Status()
+	if err != nil {
+		return err
+	}
+	for file, fileStatus := range status {
+		if fileStatus.Staging == git.Untracked && fileStatus.Worktree == git.Untracked {
+			continue
+		}
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			return fmt.Errorf("local repository has uncommitted changes in file %s", file)
+		}
+	}
+	return nil
+}
+
+// keepUntrackedFiles runs the update of the working tree, writing back the untracked files removed by it,
+// as the checkouts and pulls of go-git remove the untracked files which are not ignored
+func keepUntrackedFiles(gitW git.Worktree, update func() error) error {
+	status, err := gitW.Status()
+	if err != nil {
+		return err
+	}
+	type untrackedFile struct {
+		content []byte
+		mode    os.FileMode
+	}
+	untracked := make(map[string]untrackedFile)
+	for file, fileStatus := range status {
+		if fileStatus.Worktree != git.Untracked {
+			continue
+		}
+		info, err := gitW.Filesystem.Lstat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		content, err := util.ReadFile(gitW.Filesystem, file)
+		if err != nil {
+			return err
+		}
+		untracked[file] = untrackedFile{content: content, mode: info.Mode().Perm()}
+	}
+
+	updateErr := update()
+	for file, f := range untracked {
+		if _, err := gitW.Filesystem.Lstat(file); err == nil {
+			continue
+		}
+		if err := util.WriteFile(gitW.Filesystem, file, f.content, f.mode); err != nil {
+			return fmt.Errorf("could not restore untracked file %s: %v", file, err)
+		}
+	}
+	return updateErr
+}
+
+// restoreLocalRepository undoes the changes of an update which has not been pushed to the local repository,
+// so the checkout is left as it was: the branch is reset to the commit it pointed to, and the tracked files
+// changed are restored to their content in it. The untracked files of the checkout are kept
+func restoreLocalRepository(gitR *git.Repository, gitW *git.Worktree, head plumbing.Hash) error {
+	if err := gitW.Reset(&git.ResetOptions{Commit: head, Mode: git.MixedReset}); err != nil {
+		return err
+	}
+	commit, err := gitR.CommitObject(head)
+	if err != nil {
+		return err
+	}
+	status, err := gitW.Status()
+	if err != nil {
+		return err
+	}
+	for file, fileStatus := range status {
+		if fileStatus.Worktree == git.Unmodified || fileStatus.Worktree == git.Untracked {
+			continue
+		}
+		f, err := commit.File(file)
+		if err != nil {
+			return err
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		if err = util.WriteFile(gitW.Filesystem, file, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutLocalBranch checks out the branch in the working tree, creating it from the remote branch
+// when it doesn't exist yet in the local repository, or from the base ref when it doesn't exist in the
+// remote repository either and its creation is enabled. It returns true if the branch has been created
+// from the base ref
+func checkoutLocalBranch(ctx context.Context, appName string, gitR git.Repository, gitW git.Worktree, branchName plumbing.ReferenceName, gitConf git_internal.Conf) (bool, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	if _, err := gitR.Reference(branchName, false); err == nil {
+		logCtx.Debugf("Checking out existing branch %s", branchName.Short())
+		return false, gitW.Checkout(&git.CheckoutOptions{Branch: branchName})
+	}
+
+	remoteRef, err := gitR.Reference(plumbing.NewRemoteReferenceName(originRemoteName, branchName.Short()), false)
+	if err != nil {
+		if !gitConf.CreateBranch {
+			return false, fmt.Errorf("branch %s not found in local repository: %v", branchName.Short(), err)
+		}
+		if _, err = createBranch(ctx, appName, &gitR, branchName, gitConf.BaseRef); err != nil {
+			return false, err
+		}
+		return true, gitW.Checkout(&git.CheckoutOptions{Branch: branchName})
+	}
+	logCtx.Debugf("Creating branch %s from %s", branchName.Short(), remoteRef.Name().Short())
+	if err = gitW.Checkout(&git.CheckoutOptions{Branch: branchName, Hash: remoteRef.Hash(), Create: true}); err != nil {
+		return false, err
+	}
+
+	return false, setBranchUpstream(&gitR, branchName)
+}
+
+// openLocalRepositoryInBranch opens the existing checkout of the git repository, verifies that it is clean
+// and checks out the branch with the latest changes of the remote
+func openLocalRepositoryInBranch(ctx context.Context, appName string, gitConf git_internal.Conf, creds transport.AuthMethod) (*git.Repository, *git.Worktree, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+	logCtx.Infof("Using local git repository located in %s", gitConf.LocalRepo)
+
+	gitR, err := git.PlainOpenWithOptions(gitConf.LocalRepo, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open local repository %s: %v", gitConf.LocalRepo, err)
+	}
+	gitW, err := gitR.Worktree()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = checkWorktreeClean(*gitW); err != nil {
+		return nil, nil, err
+	}
+
+	logCtx.Debugf("Fetching latest changes of repository")
+	fetchCtx, cancelFetch := withTimeout(ctx, gitConf.Timeouts.Fetch)
+	defer cancelFetch()
+	err = gitR.FetchContext(fetchCtx, &git.FetchOptions{
+		RemoteName: originRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", originRemoteName))},
+		Auth:       creds,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, nil, operationError(fetchCtx, "fetch", err)
+	}
+
+	checkOutBranchName, err := getCheckoutBranchName(ctx, gitConf.Branch, appName, *gitR)
+	if err != nil {
+		return nil, nil, err
+	}
+	var created bool
+	err = keepUntrackedFiles(*gitW, func() (err error) {
+		created, err = checkoutLocalBranch(ctx, appName, *gitR, *gitW, *checkOutBranchName, gitConf)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if created {
+		// the branch doesn't exist in the remote repository yet, so there is nothing to pull
+		return gitR, gitW, nil
+	}
+
+	logCtx.Infof("Pulling latest changes of branch %s", checkOutBranchName.Short())
+	pullCtx, cancelPull := withTimeout(ctx, gitConf.Timeouts.Pull)
+	defer cancelPull()
+	err = keepUntrackedFiles(*gitW, func() error {
+		return gitW.PullContext(pullCtx, &git.PullOptions{
+			RemoteName:    originRemoteName,
+			ReferenceName: *checkOutBranchName,
+			Auth:          creds,
+		})
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, nil, operationError(pullCtx, "pull", err)
+	}
+
+	return gitR, gitW, nil
+}
@@ -0,0 +1,201 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// newLocalCheckout clones the repository served by s in a temporal directory, using the
+// server url as origin, and returns its location
+func newLocalCheckout(t *testing.T, s *localGitServer) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "checkout")
+	runGit(t, "clone", "-q", filepath.Join(s.root, localGitRepoName), dir)
+	runGit(t, "-C", dir, "remote", "set-url", "origin", s.RepoURL())
+	return dir
+}
+
+// localCheckoutGit runs a git command in the local checkout returning its output
+func localCheckoutGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %v failed: %v", args, err)
+	}
+	return string(out)
+}
+
+func TestUpdateApplicationLocalRepo(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", "--abbrev-ref", "HEAD"), validGitRepoBranch+"\n")
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", "HEAD"), server.Git(t, "rev-parse", validGitRepoBranch))
+}
+
+func TestUpdateApplicationLocalRepoSkipPush(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	remoteHead := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+	cfg.GitConf.SkipPush = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), remoteHead)
+	content := localCheckoutGit(t, checkout, "show", "HEAD:"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", "HEAD^"), remoteHead)
+}
+
+func TestUpdateApplicationLocalRepoDryRun(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	err := os.WriteFile(filepath.Join(checkout, "untracked.txt"), []byte("untracked"), 0600)
+	assert.NilError(t, err)
+	head := localCheckoutGit(t, checkout, "rev-parse", "HEAD")
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+	cfg.DryRun = true
+
+	syncState := NewSyncIterationState()
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.Equal(t, len(*apps), 1)
+
+	// the checkout is left clean, so it can be used by the next updates
+	assert.Equal(t, localCheckoutGit(t, checkout, "status", "--porcelain"), "?? untracked.txt\n")
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", "HEAD"), head)
+	cfg.DryRun = false
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
+	assert.Equal(t, localCheckoutGit(t, checkout, "status", "--porcelain"), "?? untracked.txt\n")
+}
+
+func TestUpdateApplicationLocalRepoPushRejected(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	head := localCheckoutGit(t, checkout, "rev-parse", "HEAD")
+	hook := filepath.Join(server.root, localGitRepoName, "hooks", "update")
+	err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0700)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "hook declined")
+
+	// the commit which could not be pushed is undone in the checkout
+	assert.Equal(t, localCheckoutGit(t, checkout, "status", "--porcelain"), "")
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", "HEAD"), head)
+	content, err := os.ReadFile(filepath.Join(checkout, validHelmAppFileToChange))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "image:\n  tag: 1.0.0\n")
+}
+
+func TestUpdateApplicationLocalRepoNotClean(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	err := os.WriteFile(filepath.Join(checkout, validHelmAppFileToChange), []byte("image:\n  tag: 0.0.1\n"), 0600)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Error(t, err, "local repository has uncommitted changes in file "+validHelmAppFileToChange)
+}
+
+func TestUpdateApplicationLocalRepoUntrackedFiles(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	err := os.WriteFile(filepath.Join(checkout, "untracked.txt"), []byte("untracked"), 0600)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	files := server.Git(t, "show", "--name-only", "--format=", validGitRepoBranch)
+	assert.Equal(t, strings.TrimSpace(files), validHelmAppFileToChange)
+	// the untracked files are kept in the checkout
+	content, err := os.ReadFile(filepath.Join(checkout, "untracked.txt"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "untracked")
+}
+
+func TestUpdateApplicationLocalRepoInvalidPath(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = t.TempDir()
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "could not open local repository")
+}
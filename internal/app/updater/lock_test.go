@@ -0,0 +1,161 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/lock"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gotest.tools/v3/assert"
+)
+
+func TestUpdateApplicationLocalServerGitRefLock(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	backend, err := lock.NewGitRefBackend(lock.DefaultLockRef, time.Minute)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.LockBackend = backend
+
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	// the lock is released once the update finishes
+	assert.Equal(t, server.Git(t, "for-each-ref", lock.DefaultLockRef), "")
+}
+
+func TestUpdateApplicationLocalServerLockHeld(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	backend, err := lock.NewFileBackend(t.TempDir())
+	assert.NilError(t, err)
+
+	heldLock, err := backend.Acquire(context.Background(), server.RepoURL(), nil)
+	assert.NilError(t, err)
+	defer heldLock.Release(context.Background())
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.LockBackend = backend
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(ctx, cfg, syncState)
+	assert.ErrorContains(t, err, "could not acquire lock file")
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, localGitRepoValuesFile)
+}
+
+func TestUpdateApplicationLocalServerGitRefLockPushRepoURL(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	forkURL := newLocalGitFork(t, server)
+	backend, err := lock.NewGitRefBackend(lock.DefaultLockRef, time.Minute)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushRepoURL = forkURL
+	cfg.LockBackend = backend
+
+	// the lock is held in the repository where the changes are pushed
+	write := func(ctx context.Context, cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) ([]ChangeEntry, error) {
+		assert.Assert(t, forkGit(t, server, "for-each-ref", lock.DefaultLockRef) != "")
+		assert.Equal(t, server.Git(t, "for-each-ref", lock.DefaultLockRef), "")
+		return writeOverrides(ctx, cfg, tempRoot, gitW)
+	}
+	_, _, err = commitChangesGit(context.Background(), cfg, write)
+	assert.NilError(t, err)
+	assert.Equal(t, forkGit(t, server, "for-each-ref", lock.DefaultLockRef), "")
+}
+
+// lostLockBackend acquires locks which are already lost
+type lostLockBackend struct{}
+
+// lostLock is a lock acquired from the lostLockBackend
+type lostLock struct {
+	lost chan struct{}
+}
+
+func (lostLockBackend) Acquire(ctx context.Context, repoURL string, auth transport.AuthMethod) (lock.Lock, error) {
+	l := &lostLock{lost: make(chan struct{})}
+	close(l.lost)
+	return l, nil
+}
+
+func (l *lostLock) Release(ctx context.Context) error {
+	return nil
+}
+
+func (l *lostLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func TestUpdateApplicationLocalServerLockLost(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.LockBackend = lostLockBackend{}
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "repository lock lost before the update finished")
+
+	content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, localGitRepoValuesFile)
+}
+
+// releaseFailedLock is a lock which can't be released, recording the context it's released with
+type releaseFailedLock struct {
+	lostLock
+	runID      string
+	releaseErr error
+}
+
+func (l *releaseFailedLock) Release(ctx context.Context) error {
+	l.runID, l.releaseErr = log.RunIDFromContext(ctx), ctx.Err()
+	return errors.New("lock ref deleted")
+}
+
+func TestReleaseRepositoryLockCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(log.ContextWithRunID(context.Background(), "test-run"))
+	cancel()
+	repoLock := &releaseFailedLock{}
+
+	// the lock is released with the values of the cancelled context of the update, but not its cancellation
+	out, err := utils.CaptureStderr(func() {
+		releaseRepositoryLock(ctx, validHelmAppName, repoLock)
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, repoLock.releaseErr)
+	assert.Equal(t, repoLock.runID, "test-run")
+	assert.Assert(t, strings.Contains(out, "could not release repository lock: lock ref deleted"), out)
+	assert.Assert(t, strings.Contains(out, "run_id=test-run"), out)
+}
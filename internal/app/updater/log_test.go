@@ -0,0 +1,59 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"gotest.tools/v3/assert"
+)
+
+func TestUpdateApplicationLocalServerLogFields(t *testing.T) {
+	assert.NilError(t, log.SetLogFormat("json"))
+	defer func() {
+		assert.NilError(t, log.SetLogFormat("text"))
+	}()
+
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	ctx := log.ContextWithRunID(context.Background(), "test-run")
+	var commit string
+	var err error
+	out, captureErr := utils.CaptureStdout(func() {
+		_, commit, err = UpdateApplicationCommit(ctx, cfg, NewSyncIterationState())
+	})
+	assert.NilError(t, captureErr)
+	assert.NilError(t, err)
+	assert.Assert(t, commit != "")
+
+	var keys, commits int
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "{") {
+			// the progress of the git operations is written to stdout too
+			continue
+		}
+		var entry map[string]interface{}
+		assert.NilError(t, json.Unmarshal([]byte(line), &entry), line)
+		assert.Equal(t, entry[log.FieldRunID], "test-run", line)
+		assert.Equal(t, entry[log.FieldApplication], cfg.AppName, line)
+		assert.Equal(t, entry[log.FieldRepo], log.RedactURL(cfg.GitConf.RepoURL), line)
+		if entry[log.FieldKey] != nil {
+			assert.Equal(t, entry[log.FieldKey], ".image.tag", line)
+			keys++
+		}
+		if entry[log.FieldCommit] != nil {
+			assert.Equal(t, entry[log.FieldCommit], commit, line)
+			commits++
+		}
+	}
+	assert.Assert(t, keys > 0)
+	assert.Assert(t, commits > 0)
+}
@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"errors"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+)
+
+// Reasons of the failures of the updates recorded in the metrics
+const (
+	reasonCredentials = "credentials"
+	reasonConfig      = "config"
+	reasonLock        = "lock"
+	reasonClone       = "clone"
+	reasonWrite       = "write"
+	reasonTemplate    = "template"
+	reasonCommit      = "commit"
+	reasonPush        = "push"
+)
+
+// updateFailure is an error of an update with the stage where it failed, its message is the one of the error
+// and it unwraps to it, so the callers can check the cause with errors.Is
+type updateFailure struct {
+	reason string
+	err    error
+}
+
+func (f *updateFailure) Error() string {
+	return f.err.Error()
+}
+
+func (f *updateFailure) Unwrap() error {
+	return f.err
+}
+
+// failed returns the error of an update failed by reason, keeping the reason of the errors already classified
+func failed(reason string, err error) error {
+	if _, ok := err.(*updateFailure); ok {
+		return err
+	}
+	return &updateFailure{reason: reason, err: err}
+}
+
+// recordUpdate records the result of an update in the metrics, the updates with nothing to update are skipped
+func recordUpdate(err error) {
+	metrics.UpdatesAttempted.Inc()
+	switch failure, ok := err.(*updateFailure); {
+	case err == nil:
+		metrics.UpdatesSucceeded.Inc()
+	case errors.Is(err, ErrNothingToUpdate):
+		metrics.UpdatesSkipped.Inc()
+	case ok:
+		metrics.UpdatesFailed.WithLabelValues(failure.reason).Inc()
+	default:
+		metrics.UpdatesFailed.WithLabelValues("unknown").Inc()
+	}
+}
@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"gotest.tools/v3/assert"
+)
+
+// sampleCount returns the number of observations of the histogram
+func sampleCount(t *testing.T, h prometheus.Histogram) uint64 {
+	t.Helper()
+	var m dto.Metric
+	assert.NilError(t, h.Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestUpdateApplicationLocalServerMetrics(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	syncState := NewSyncIterationState()
+
+	attempted := testutil.ToFloat64(metrics.UpdatesAttempted)
+	succeeded := testutil.ToFloat64(metrics.UpdatesSucceeded)
+	skipped := testutil.ToFloat64(metrics.UpdatesSkipped)
+	failedConfig := testutil.ToFloat64(metrics.UpdatesFailed.WithLabelValues(reasonConfig))
+	clones := sampleCount(t, metrics.GitCloneDuration)
+	pushes := sampleCount(t, metrics.GitPushDuration)
+
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	// the value is already set
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.Assert(t, errors.Is(err, ErrNothingToUpdate), err)
+
+	gitConf := *cfg.GitConf
+	gitConf.CacheDir = t.TempDir()
+	gitConf.InMemory = true
+	cfg.GitConf = &gitConf
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "the cache directory can't be used with in memory or shallow clones")
+
+	assert.Equal(t, testutil.ToFloat64(metrics.UpdatesAttempted)-attempted, 3.0)
+	assert.Equal(t, testutil.ToFloat64(metrics.UpdatesSucceeded)-succeeded, 1.0)
+	assert.Equal(t, testutil.ToFloat64(metrics.UpdatesSkipped)-skipped, 1.0)
+	assert.Equal(t, testutil.ToFloat64(metrics.UpdatesFailed.WithLabelValues(reasonConfig))-failedConfig, 1.0)
+	assert.Equal(t, sampleCount(t, metrics.GitCloneDuration)-clones, uint64(2))
+	assert.Equal(t, sampleCount(t, metrics.GitPushDuration)-pushes, uint64(1))
+}
+
+func TestFailedKeepsReason(t *testing.T) {
+	err := failed(reasonCommit, failed(reasonPush, context.Canceled))
+	assert.Equal(t, err.Error(), context.Canceled.Error())
+	assert.Equal(t, err.(*updateFailure).reason, reasonPush)
+}
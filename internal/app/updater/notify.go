@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"context"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/notify"
+)
+
+// notifyChanges notifies the changes of each application pushed in the commit, once the lock of the repository
+// has been released so the notifiers don't delay the next updates. The update has already been pushed, so the
+// notifications failing are logged instead of failing it
+func notifyChanges(ctx context.Context, cfg HelmUpdaterConfig, apps []ChangeEntry, commit string) {
+	if cfg.Notifier == nil || commit == "" || cfg.GitConf.SkipPush {
+		return
+	}
+	repoURL, branch := cfg.GitConf.RepoURL, cfg.GitConf.Branch
+	if cfg.GitConf.PushRepoURL != "" {
+		repoURL = cfg.GitConf.PushRepoURL
+	}
+	if cfg.GitConf.PushBranch != "" {
+		branch = cfg.GitConf.PushBranch
+	}
+
+	var order []string
+	notifications := make(map[string]*notify.Notification)
+	for _, app := range apps {
+		// only the changes of the updates of several applications have their application and file
+		appName, file := app.App, app.File
+		if appName == "" {
+			appName, file = cfg.AppName, cfg.File
+		}
+		notification, found := notifications[appName]
+		if !found {
+			notification = &notify.Notification{App: appName, Repo: log.RedactURL(repoURL), Branch: branch, Commit: commit}
+			notifications[appName] = notification
+			order = append(order, appName)
+		}
+		notification.Changes = append(notification.Changes, notify.Change{
+			File:     file,
+			Key:      app.Key,
+			OldValue: app.OldValue,
+			NewValue: app.NewValue,
+		})
+	}
+
+	for _, appName := range order {
+		if err := cfg.Notifier.Notify(ctx, *notifications[appName]); err != nil {
+			log.FromContext(ctx).AddField(log.FieldApplication, appName).AddField(log.FieldCommit, commit).
+				Errorf("could not notify changes: %v", err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/notify"
+	"gotest.tools/v3/assert"
+)
+
+// recordingNotifier keeps the notifications sent, failing with err
+type recordingNotifier struct {
+	mu            sync.Mutex
+	notifications []notify.Notification
+	err           error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, notification notify.Notification) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.notifications = append(n.notifications, notification)
+	return n.err
+}
+
+func TestUpdateApplicationLocalServerNotify(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	// the update doesn't fail if the notification can't be sent, as it's already pushed
+	notifier := &recordingNotifier{err: errors.New("notifier down")}
+	cfg.Notifier = notifier
+
+	_, commit, err := UpdateApplicationCommit(context.Background(), cfg, NewSyncIterationState())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, notifier.notifications, []notify.Notification{{
+		App:     validHelmAppName,
+		Repo:    server.RepoURL(),
+		Branch:  validGitRepoBranch,
+		Commit:  commit,
+		Changes: []notify.Change{{File: cfg.File, Key: ".image.tag", OldValue: "1.0.0", NewValue: "1.1.0"}},
+	}})
+}
+
+func TestUpdateApplicationLocalServerNotifyDryRun(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	cfg.DryRun = true
+
+	_, err := UpdateApplication(context.Background(), cfg, NewSyncIterationState())
+	assert.NilError(t, err)
+	assert.Equal(t, len(notifier.notifications), 0)
+
+	cfg.DryRun = false
+	cfg.GitConf.SkipPush = true
+	_, err = UpdateApplication(context.Background(), cfg, NewSyncIterationState())
+	assert.NilError(t, err)
+	assert.Equal(t, len(notifier.notifications), 0)
+}
+
+func TestUpdateApplicationsLocalServerNotify(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	pushOtherAppValues(t, server, validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, nil)
+	notifier := &recordingNotifier{}
+	cfg.Notifier = notifier
+	updates := []ApplicationUpdate{
+		{AppName: validHelmAppName, File: validHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}}},
+		{AppName: otherHelmAppName, File: otherHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "2.0.0"}}},
+	}
+
+	_, err := UpdateApplications(context.Background(), cfg, updates, NewSyncIterationState())
+	assert.NilError(t, err)
+	commit := server.Git(t, "rev-parse", validGitRepoBranch)
+	// each application is notified of its own changes
+	assert.Equal(t, len(notifier.notifications), 2)
+	for i, update := range updates {
+		notification := notifier.notifications[i]
+		assert.Equal(t, notification.App, update.AppName)
+		assert.Equal(t, notification.Commit+"\n", commit)
+		assert.DeepEqual(t, notification.Changes, []notify.Change{{File: update.File, Key: ".image.tag", OldValue: "1.0.0", NewValue: update.UpdateApps[0].NewValue}})
+	}
+}
+
+// lockCheckingNotifier records whether the lock of the repository was free when each notification was sent
+type lockCheckingNotifier struct {
+	lock   *sync.Mutex
+	locked []bool
+}
+
+func (n *lockCheckingNotifier) Notify(_ context.Context, _ notify.Notification) error {
+	acquired := make(chan struct{})
+	go func() {
+		n.lock.Lock()
+		close(acquired)
+		n.lock.Unlock()
+	}()
+	select {
+	case <-acquired:
+		n.locked = append(n.locked, false)
+	case <-time.After(time.Second):
+		n.locked = append(n.locked, true)
+	}
+	return nil
+}
+
+func TestUpdateApplicationsLocalServerNotifyUnlocked(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}})
+	state := NewSyncIterationState()
+	// the notifiers don't delay the updates of the same repository waiting for its lock
+	notifier := &lockCheckingNotifier{lock: state.GetRepositoryLock(cfg.GitConf.PushURL())}
+	cfg.Notifier = notifier
+
+	_, _, err := UpdateApplicationCommit(context.Background(), cfg, state)
+	assert.NilError(t, err)
+	_, err = UpdateApplications(context.Background(), cfg, []ApplicationUpdate{
+		{AppName: validHelmAppName, File: validHelmAppFileToChange, UpdateApps: []ChangeEntry{{Key: ".image.tag", NewValue: "1.2.0"}}},
+	}, state)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, notifier.locked, []bool{false, false})
+}
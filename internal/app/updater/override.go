@@ -1,94 +1,126 @@
 package updater
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"path"
 
 	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
 	"github.com/docplanner/helm-repo-updater/internal/app/yq"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
 	git "github.com/go-git/go-git/v5"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var _ changeWriter = writeOverrides
 
-type changeWriter func(cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) (apps []ChangeEntry, err error)
+type changeWriter func(ctx context.Context, cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) (apps []ChangeEntry, err error)
 
-// writeOverrides writes the overrides to the git files
-func writeOverrides(cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) (apps []ChangeEntry, err error) {
-	targetFile := path.Join(tempRoot, cfg.GitConf.File, cfg.File)
+// writeOverrides writes the overrides to the git files of the working tree
+func writeOverrides(ctx context.Context, cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) (apps []ChangeEntry, err error) {
+	targetFile := path.Join(cfg.GitConf.File, cfg.File)
 
 	apps = make([]ChangeEntry, 0)
 
-	_, err = os.Stat(targetFile)
+	_, err = gitW.Filesystem.Stat(targetFile)
 	if err != nil {
-		log.WithContext().
-			AddField("application", cfg.AppName).
+		log.FromContext(ctx).
+			AddField(log.FieldApplication, cfg.AppName).
 			Errorf("target file %s doesn't exist.", cfg.File)
 
 		return apps, err
 	}
 
-	apps = overrideValues(apps, cfg, targetFile)
+	apps, err = overrideValues(ctx, apps, cfg, gitW.Filesystem, targetFile)
+	if err != nil {
+		return apps, err
+	}
 
 	if len(apps) == 0 {
-		return apps, fmt.Errorf("nothing to update, skipping commit")
+		return apps, fmt.Errorf("values of file %s already set: %w", cfg.File, ErrNothingToUpdate)
 	}
 
 	return apps, nil
 }
 
-// overrideValues overrides values in the given file
-func overrideValues(apps []ChangeEntry, cfg HelmUpdaterConfig, targetFile string) []ChangeEntry {
-	var err error
+// overrideValues overrides values in the given file of the filesystem, with a span for the write of each key
+func overrideValues(ctx context.Context, apps []ChangeEntry, cfg HelmUpdaterConfig, fs billy.Filesystem, targetFile string) ([]ChangeEntry, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, cfg.AppName)
+
+	content, err := util.ReadFile(fs, targetFile)
+	if err != nil {
+		return apps, err
+	}
 
-	logCtx := log.WithContext().AddField("application", cfg.AppName)
+	changed := false
 	for _, app := range cfg.UpdateApps {
-		// define new entry
-		var newEntry ChangeEntry
-		var oldValue, newValue *string
+		var newEntry *ChangeEntry
+		_, span := tracing.Start(ctx, "write key", attribute.String("application", cfg.AppName),
+			attribute.String("file", targetFile), attribute.String("key", app.Key), attribute.String("value", app.NewValue))
+		content, newEntry, err = overrideValue(logCtx.WithField(log.FieldKey, app.Key), app, content)
+		span.RecordError(err)
+		span.SetAttributes(attribute.Bool("changed", newEntry != nil))
+		span.End()
+		if newEntry != nil {
+			apps = append(apps, *newEntry)
+			changed = true
+		}
+	}
 
-		// replace helm parameters
-		oldValue, err = yq.ReadKey(app.Key, targetFile)
-		if err != nil {
-			logCtx.Infof("failed to read the presented key %s due to error %s, skipping change", app.Key, err.Error())
+	// the file is left untouched when none of its values change
+	if !changed {
+		return apps, nil
+	}
+	if err = util.WriteFile(fs, targetFile, content, 0644); err != nil {
+		return apps, err
+	}
 
-			continue
-		}
+	return apps, nil
+}
+
+// overrideValue overrides the value of a key in the content, returning the content and the change made,
+// which is nil when the key is skipped because it can't be read or updated, or it already has the value
+func overrideValue(logCtx *log.Context, app ChangeEntry, content []byte) ([]byte, *ChangeEntry, error) {
+	// define new entry
+	var newEntry ChangeEntry
 
-		newEntry.Key = app.Key
-		newEntry.OldValue = *oldValue
+	// replace helm parameters
+	oldValue, err := yq.ReadKeyFromBytes(app.Key, content)
+	if err != nil {
+		logCtx.Infof("failed to read the presented key %s due to error %s, skipping change", app.Key, err.Error())
 
-		// replace helm parameters
-		logCtx.Infof("Actual value for key %s: %s", app.Key, newEntry.OldValue)
-		logCtx.Infof("Setting new value for key %s: %s", app.Key, app.NewValue)
-		err = yq.InplaceApply(app.Key, app.NewValue, targetFile)
-		if err != nil {
-			logCtx.Infof("failed to update key %s: %v", app.Key, err)
+		return content, nil, err
+	}
 
-			newEntry.NewValue = *oldValue
+	newEntry.Key = app.Key
+	newEntry.OldValue = *oldValue
 
-			continue
-		}
+	// replace helm parameters
+	logCtx.Infof("Actual value for key %s: %s", app.Key, newEntry.OldValue)
+	logCtx.Infof("Setting new value for key %s: %s", app.Key, app.NewValue)
+	newContent, err := yq.Apply(app.Key, app.NewValue, content)
+	if err != nil {
+		logCtx.Infof("failed to update key %s: %v", app.Key, err)
 
-		// check patched app
-		newValue, err = yq.ReadKey(app.Key, targetFile)
-		if err != nil {
-			logCtx.Infof("failed to read the patched key %s due to error %s, skipping change", app.Key, err.Error())
-			newEntry.NewValue = *oldValue
+		return content, nil, err
+	}
 
-			continue
-		}
-		newEntry.NewValue = *newValue
-		// check if there is any change
-		if *oldValue == *newValue {
-			logCtx.Infof("target for key %s is the same, skipping", app.Key)
+	// check patched app
+	newValue, err := yq.ReadKeyFromBytes(app.Key, newContent)
+	if err != nil {
+		logCtx.Infof("failed to read the patched key %s due to error %s, skipping change", app.Key, err.Error())
 
-			continue
-		}
+		return content, nil, err
+	}
+	newEntry.NewValue = *newValue
+	// check if there is any change
+	if *oldValue == *newValue {
+		logCtx.Infof("target for key %s is the same, skipping", app.Key)
 
-		apps = append(apps, newEntry)
+		return newContent, nil, nil
 	}
 
-	return apps
+	return newContent, &newEntry, nil
 }
@@ -0,0 +1,113 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// anonymousRemoteName is the name required by go-git for remotes not stored in the repository config
+const anonymousRemoteName = "anonymous"
+
+// pushTarget is the remote branch where the commit with the changes is pushed
+type pushTarget struct {
+	remote *git.Remote
+	// auth are the credentials of the remote, obtained with newPushCreds
+	auth   transport.AuthMethod
+	branch plumbing.ReferenceName
+	// lease is the commit the remote branch must point to for being overwritten, when nil
+	// the branch is only fast-forwarded or created
+	lease *plumbing.Hash
+}
+
+// getPushTarget returns where the commit with the changes is pushed. By default it's the branch
+// being updated in origin, unless other branch or repository are configured to push to. In that
+// case the current commit of the remote branch is leased, so it can be overwritten only if nobody
+// else has updated it in the meantime
+func getPushTarget(ctx context.Context, appName string, gitConf git_internal.Conf, gitR *git.Repository, creds transport.AuthMethod) (*pushTarget, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	head, err := gitR.Head()
+	if err != nil {
+		return nil, err
+	}
+	target := &pushTarget{auth: creds, branch: head.Name()}
+	if gitConf.PushBranch != "" {
+		target.branch = plumbing.NewBranchReferenceName(gitConf.PushBranch)
+	}
+
+	if gitConf.PushRepoURL != "" {
+		target.remote, err = gitR.CreateRemoteAnonymous(&config.RemoteConfig{
+			Name: anonymousRemoteName,
+			URLs: []string{gitConf.PushRepoURL},
+		})
+	} else {
+		target.remote, err = gitR.Remote(originRemoteName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if gitConf.PushBranch == "" && gitConf.PushRepoURL == "" {
+		return target, nil
+	}
+
+	listCtx, cancel := withTimeout(ctx, gitConf.Timeouts.Fetch)
+	defer cancel()
+	refs, err := target.remote.ListContext(listCtx, &git.ListOptions{Auth: target.auth})
+	if err != nil && err != transport.ErrEmptyRemoteRepository {
+		return nil, fmt.Errorf("could not list branches of %s: %v", log.RedactURL(target.remote.Config().URLs[0]), operationError(listCtx, "list", err))
+	}
+	for _, ref := range refs {
+		if ref.Name() == target.branch {
+			target.lease = refHash(ref)
+			logCtx.Infof("Branch %s of %s is leased at commit %s", target.branch.Short(), log.RedactURL(target.remote.Config().URLs[0]), target.lease)
+			return target, nil
+		}
+	}
+	logCtx.Infof("Branch %s doesn't exist in %s, it will be created", target.branch.Short(), log.RedactURL(target.remote.Config().URLs[0]))
+
+	return target, nil
+}
+
+// newPushCreds returns the credentials of the repository where the changes are pushed, which are creds
+// unless the changes are pushed to other repository, whose credentials are built for its url
+func newPushCreds(cfg HelmUpdaterConfig, creds transport.AuthMethod) (transport.AuthMethod, error) {
+	if cfg.GitConf.PushRepoURL == "" {
+		return creds, nil
+	}
+	pushCreds, err := cfg.GitCredentials.NewGitCreds(cfg.GitConf.PushRepoURL, cfg.GitCredentials.Password)
+	if err != nil {
+		return nil, fmt.Errorf("could not get creds for push repo '%s': %v", log.RedactURL(cfg.GitConf.PushRepoURL), err)
+	}
+	return pushCreds, nil
+}
+
+// pushOptions returns the options to push the HEAD of the repository and the tags to the target in
+// a single push, overwriting the remote branch only if it's still pointing to the leased commit. The push
+// is atomic when the remote supports it, so the tags are not pushed if the branch is rejected
+func (target *pushTarget) pushOptions(head plumbing.ReferenceName, tags []plumbing.ReferenceName) *git.PushOptions {
+	refSpec := config.RefSpec(fmt.Sprintf("%s:%s", head, target.branch))
+	var requireRemoteRefs []config.RefSpec
+	if target.lease != nil {
+		refSpec = "+" + refSpec
+		requireRemoteRefs = []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", target.lease, target.branch))}
+	}
+	refSpecs := []config.RefSpec{refSpec}
+	for _, tag := range tags {
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("%s:%s", tag, tag)))
+	}
+	return &git.PushOptions{
+		RemoteName:        target.remote.Config().Name,
+		RefSpecs:          refSpecs,
+		RequireRemoteRefs: requireRemoteRefs,
+		Atomic:            true,
+		Auth:              target.auth,
+	}
+}
@@ -0,0 +1,205 @@
+package updater
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"github.com/go-git/go-git/v5"
+	"gotest.tools/v3/assert"
+)
+
+const (
+	stagingGitRepoBranch = "staging"
+	localGitForkName     = "test-fork.git"
+)
+
+// newLocalGitFork creates a fork of the repository served by s, which is served too, returning its url
+func newLocalGitFork(t *testing.T, s *localGitServer) string {
+	t.Helper()
+	fork := filepath.Join(s.root, localGitForkName)
+	runGit(t, "clone", "-q", "--bare", filepath.Join(s.root, localGitRepoName), fork)
+	runGit(t, "-C", fork, "config", "http.receivepack", "true")
+	return s.URL + "/" + localGitForkName
+}
+
+// forkGit runs a git command against the bare repository of the fork served by s
+func forkGit(t *testing.T, s *localGitServer, args ...string) string {
+	t.Helper()
+	out, err := exec.Command("git", append([]string{"-C", filepath.Join(s.root, localGitForkName)}, args...)...).Output()
+	if err != nil {
+		t.Fatalf("git %v failed: %v", args, err)
+	}
+	return string(out)
+}
+
+func TestUpdateApplicationLocalServerPushBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushBranch = stagingGitRepoBranch
+
+	syncState := NewSyncIterationState()
+	_, commit, err := UpdateApplicationCommit(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	content := server.Git(t, "show", stagingGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	assert.Equal(t, strings.TrimSpace(server.Git(t, "rev-parse", stagingGitRepoBranch)), commit)
+	assert.Equal(t, server.Git(t, "rev-parse", stagingGitRepoBranch+"^"), developCommit)
+	// the branch read is not modified
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), developCommit)
+}
+
+func TestUpdateApplicationLocalServerPushBranchOverwrite(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+	server.Git(t, "branch", stagingGitRepoBranch, "main")
+	pushValuesCommit(t, server, stagingGitRepoBranch, "2.0.0")
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushBranch = stagingGitRepoBranch
+
+	syncState := NewSyncIterationState()
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.Equal(t, (*apps)[0].OldValue, "1.0.0")
+
+	// the previous content of the branch is replaced by the changes made over the branch read
+	assert.Equal(t, server.Git(t, "rev-parse", stagingGitRepoBranch+"^"), developCommit)
+}
+
+func TestUpdateApplicationLocalServerPushBranchLeaseBroken(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	server.Git(t, "branch", stagingGitRepoBranch, "main")
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushBranch = stagingGitRepoBranch
+
+	var stagingCommit string
+	// the push branch is updated by someone else while the changes are being made
+	write := func(ctx context.Context, cfg HelmUpdaterConfig, tempRoot string, gitW git.Worktree) ([]ChangeEntry, error) {
+		stagingCommit = pushValuesCommit(t, server, stagingGitRepoBranch, "2.0.0")
+		return writeOverrides(ctx, cfg, tempRoot, gitW)
+	}
+	_, _, err := commitChangesGit(context.Background(), cfg, write)
+	assert.ErrorContains(t, err, "could not push to branch "+stagingGitRepoBranch+" leased at commit")
+
+	assert.Equal(t, strings.TrimSpace(server.Git(t, "rev-parse", stagingGitRepoBranch)), stagingCommit)
+}
+
+func TestUpdateApplicationLocalServerPushRepoURL(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	forkURL := newLocalGitFork(t, server)
+	pushValuesCommit(t, server, validGitRepoBranch, "2.0.0")
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "2.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushRepoURL = forkURL
+
+	syncState := NewSyncIterationState()
+	apps, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.Equal(t, (*apps)[0].OldValue, "2.0.0")
+
+	// the values are read from the origin repository and pushed to the same branch of the fork
+	content := forkGit(t, server, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 2.1.0\n")
+	assert.Equal(t, forkGit(t, server, "rev-parse", validGitRepoBranch+"^"), developCommit)
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), developCommit)
+}
+
+func TestUpdateApplicationLocalServerPushRepoURLCredentials(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	// the credentials of the push repository are the ones of its url, not the ones of the https origin
+	pushRepoURL := "ssh://git@localhost:2222/git-server/repos/test-repo.git"
+	cfg.GitConf.PushRepoURL = pushRepoURL
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "could not get creds for push repo '"+pushRepoURL+"': sshPrivKey not provided")
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), developCommit)
+}
+
+func TestUpdateApplicationLocalRepoPushBranch(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+	forkURL := newLocalGitFork(t, server)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+	cfg.GitConf.PushRepoURL = forkURL
+	cfg.GitConf.PushBranch = stagingGitRepoBranch
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	content := forkGit(t, server, "show", stagingGitRepoBranch+":"+validHelmAppFileToChange)
+	assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+	// no remote is added to the local repository to push to the fork
+	assert.Equal(t, localCheckoutGit(t, checkout, "remote"), "origin\n")
+}
+
+func TestUpdateApplicationLocalServerPushRepoURLRedacted(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	forkURL, err := url.Parse(newLocalGitFork(t, server))
+	assert.NilError(t, err)
+	forkURL.User = url.UserPassword("updater", "push-token")
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.PushRepoURL = forkURL.String()
+
+	// the password of the url of the push repository is not logged
+	out, captureErr := utils.CaptureStdout(func() {
+		_, err = UpdateApplication(context.Background(), cfg, NewSyncIterationState())
+	})
+	assert.NilError(t, captureErr)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(out, "Pushing changes to branch "+validGitRepoBranch+" of "+log.RedactURL(forkURL.String())), out)
+	assert.Assert(t, !strings.Contains(out, "push-token"), out)
+}
@@ -0,0 +1,130 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"github.com/docplanner/helm-repo-updater/internal/app/yq"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ReadValues reads the current values of the keys of the file of the application from the latest
+// commit of the branch, without changing it. The file is read from the commit of the local repository,
+// of the mirror of the cache or, if none is configured, of a shallow clone of the branch kept in memory
+// without a working tree
+func ReadValues(ctx context.Context, cfg HelmUpdaterConfig, keys []string) (map[string]string, error) {
+	creds, err := cfg.GitCredentials.NewGitCreds(cfg.GitConf.RepoURL, cfg.GitCredentials.Password)
+	if err != nil {
+		return nil, fmt.Errorf("could not get creds for repo '%s': %v", cfg.AppName, err)
+	}
+
+	gitConf := *cfg.GitConf
+	var commit *object.Commit
+	switch {
+	case gitConf.LocalRepo != "":
+		gitR, _, err := openLocalRepositoryInBranch(ctx, cfg.AppName, gitConf, creds)
+		if err != nil {
+			return nil, err
+		}
+		commit, err = referenceCommit(gitR, plumbing.HEAD)
+		if err != nil {
+			return nil, err
+		}
+	case gitConf.CacheDir != "":
+		mirror, err := getCacheMirror(ctx, cfg.AppName, gitConf, creds)
+		if err != nil {
+			return nil, fmt.Errorf("could not get mirror of repo '%s' from cache: %v", gitConf.RepoURL, err)
+		}
+		defer mirror.Release()
+		commit, err = referenceCommit(mirror.Repository, branchReferenceName(gitConf.Branch))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		gitR, err := cloneBranchInMemory(ctx, cfg.AppName, gitConf, creds)
+		if err != nil {
+			return nil, err
+		}
+		// the clone has only the branch, which is the one of HEAD
+		commit, err = referenceCommit(gitR, plumbing.HEAD)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := commit.File(path.Join(gitConf.File, cfg.File))
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s at commit %s: %v", cfg.File, commit.Hash, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("could not read file %s at commit %s: %v", cfg.File, commit.Hash, err)
+	}
+	values := make(map[string]string, len(keys))
+	for _, key := range keys {
+		value, err := yq.ReadKeyFromBytes(key, []byte(content))
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %s of file %s: %v", key, cfg.File, err)
+		}
+		values[key] = *value
+	}
+	return values, nil
+}
+
+// cloneBranchInMemory clones only the latest commit of the branch in memory, without tags nor
+// a working tree, as only the objects of the commit are read
+func cloneBranchInMemory(ctx context.Context, appName string, gitConf git_internal.Conf, creds transport.AuthMethod) (r *git.Repository, err error) {
+	ctx, span := tracing.Start(ctx, "clone", attribute.String("repo", log.RedactURL(gitConf.RepoURL)),
+		attribute.Bool("shallow", true), attribute.Bool("in_memory", true))
+	start := time.Now()
+	defer func() {
+		metrics.GitCloneDuration.Observe(metrics.Since(start))
+		endSpan(span, err)
+	}()
+
+	cloneOptions := &git.CloneOptions{
+		Auth:         creds,
+		URL:          gitConf.RepoURL,
+		Depth:        1,
+		SingleBranch: true,
+		NoCheckout:   true,
+		Tags:         git.NoTags,
+	}
+	if gitConf.Branch != "" && gitConf.Branch != "HEAD" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(gitConf.Branch)
+	}
+
+	log.FromContext(ctx).AddField(log.FieldApplication, appName).Debugf("Cloning branch of git repository %s in memory", gitConf.RepoURL)
+	ctx, cancel := withTimeout(ctx, gitConf.Timeouts.Clone)
+	defer cancel()
+	r, err = git.CloneContext(ctx, memory.NewStorage(), nil, cloneOptions)
+	return r, operationError(ctx, "clone", err)
+}
+
+// branchReferenceName returns the name of the reference of the branch, HEAD for the default branch
+func branchReferenceName(branch string) plumbing.ReferenceName {
+	if branch == "" || branch == "HEAD" {
+		return plumbing.HEAD
+	}
+	return plumbing.NewBranchReferenceName(branch)
+}
+
+// referenceCommit returns the commit the reference points to
+func referenceCommit(gitR *git.Repository, name plumbing.ReferenceName) (*object.Commit, error) {
+	ref, err := gitR.Reference(name, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %v", name, err)
+	}
+	return gitR.CommitObject(ref.Hash())
+}
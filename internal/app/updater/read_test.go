@@ -0,0 +1,43 @@
+package updater
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReadValuesLocalServer(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, nil)
+
+	values, err := ReadValues(context.Background(), cfg, []string{".image.tag"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{".image.tag": "1.0.0"})
+
+	// the values are read from the latest commit of the branch
+	pushValuesCommit(t, server, validGitRepoBranch, "1.1.0")
+	values, err = ReadValues(context.Background(), cfg, []string{".image.tag"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{".image.tag": "1.1.0"})
+
+	cfg.File = "missing-app/values.yaml"
+	_, err = ReadValues(context.Background(), cfg, []string{".image.tag"})
+	assert.ErrorContains(t, err, "could not read file missing-app/values.yaml")
+}
+
+func TestReadValuesLocalServerCache(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, nil)
+	cfg.GitConf.CacheDir = t.TempDir()
+
+	values, err := ReadValues(context.Background(), cfg, []string{".image.tag"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{".image.tag": "1.0.0"})
+
+	// the mirror is fetched before reading the values
+	pushValuesCommit(t, server, validGitRepoBranch, "1.1.0")
+	values, err = ReadValues(context.Background(), cfg, []string{".image.tag"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, map[string]string{".image.tag": "1.1.0"})
+}
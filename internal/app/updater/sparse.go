@@ -0,0 +1,226 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// sparseCheckout writes in the working tree filesystem only the files inside
+// sparsePaths of the commit pointed by branchName, and points HEAD to it
+func sparseCheckout(ctx context.Context, appName string, gitR *git.Repository, branchName plumbing.ReferenceName, fs billy.Filesystem, sparsePaths []string) error {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	ref, err := gitR.Reference(branchName, true)
+	if err != nil {
+		return err
+	}
+	commit, err := gitR.CommitObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	for _, sparsePath := range sparsePaths {
+		sparsePath = strings.Trim(path.Clean(sparsePath), "/")
+		logCtx.Debugf("Checking out sparse path %s of branch %s", sparsePath, branchName.Short())
+		if sparsePath == "" || sparsePath == "." {
+			return fmt.Errorf("invalid sparse path, the repository root can't be used as sparse path")
+		}
+
+		entry, err := tree.FindEntry(sparsePath)
+		if err != nil {
+			return fmt.Errorf("sparse path %s: %v", sparsePath, err)
+		}
+
+		if entry.Mode != filemode.Dir {
+			file, err := tree.TreeEntryFile(entry)
+			if err != nil {
+				return err
+			}
+			file.Name = sparsePath
+			if err = writeTreeFile(fs, file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		subtree, err := tree.Tree(sparsePath)
+		if err != nil {
+			return err
+		}
+		err = subtree.Files().ForEach(func(file *object.File) error {
+			file.Name = path.Join(sparsePath, file.Name)
+			return writeTreeFile(fs, file)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return gitR.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branchName))
+}
+
+// writeTreeFile writes the content of a file of a git tree in the working tree filesystem
+func writeTreeFile(fs billy.Filesystem, file *object.File) error {
+	if !file.Mode.IsFile() {
+		return nil
+	}
+	if err := fs.MkdirAll(path.Dir(file.Name), 0755); err != nil {
+		return err
+	}
+
+	mode, err := file.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	f, err := fs.OpenFile(file.Name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, reader)
+	return err
+}
+
+// storeBlob stores content as a blob in the repository and returns its hash
+func storeBlob(s storer.EncodedObjectStorer, content []byte) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err = w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err = w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
+
+// replaceTreeBlob stores a copy of tree where the existing file located in filePath
+// points to blobHash, returning the hash of the new tree
+func replaceTreeBlob(s storer.EncodedObjectStorer, tree *object.Tree, filePath []string, blobHash plumbing.Hash) (plumbing.Hash, error) {
+	newTree := &object.Tree{}
+	found := false
+	for _, entry := range tree.Entries {
+		if entry.Name == filePath[0] {
+			found = true
+			if len(filePath) == 1 {
+				if entry.Mode == filemode.Dir {
+					return plumbing.ZeroHash, fmt.Errorf("%s is a directory", entry.Name)
+				}
+				entry.Hash = blobHash
+			} else {
+				subtree, err := object.GetTree(s, entry.Hash)
+				if err != nil {
+					return plumbing.ZeroHash, err
+				}
+				entry.Hash, err = replaceTreeBlob(s, subtree, filePath[1:], blobHash)
+				if err != nil {
+					return plumbing.ZeroHash, err
+				}
+			}
+		}
+		newTree.Entries = append(newTree.Entries, entry)
+	}
+	if !found {
+		return plumbing.ZeroHash, fmt.Errorf("%s not found in tree", filePath[0])
+	}
+
+	obj := s.NewEncodedObject()
+	if err := newTree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return s.SetEncodedObject(obj)
+}
+
+// commitSparseChanges creates a commit in the branch pointed by HEAD with the content of the
+// files of the sparse working tree filesystem. The commit is built directly from the tree
+// of the current commit, so the files outside the sparse paths are kept unchanged
+func commitSparseChanges(ctx context.Context, appName string, gitR *git.Repository, fs billy.Filesystem, files []string, commitMessage string, author object.Signature, committer object.Signature) (*plumbing.Hash, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	head, err := gitR.Head()
+	if err != nil {
+		return nil, err
+	}
+	parent, err := gitR.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parent.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	treeHash := tree.Hash
+	for _, file := range files {
+		content, err := util.ReadFile(fs, file)
+		if err != nil {
+			return nil, err
+		}
+		blobHash, err := storeBlob(gitR.Storer, content)
+		if err != nil {
+			return nil, err
+		}
+		if tree, err = object.GetTree(gitR.Storer, treeHash); err != nil {
+			return nil, err
+		}
+		treeHash, err = replaceTreeBlob(gitR.Storer, tree, strings.Split(path.Clean(file), "/"), blobHash)
+		if err != nil {
+			return nil, fmt.Errorf("could not update file %s: %v", file, err)
+		}
+	}
+
+	if treeHash == parent.TreeHash {
+		return nil, fmt.Errorf("files %s unchanged: %w", strings.Join(files, ", "), ErrNothingToUpdate)
+	}
+
+	logCtx.Infof("It's going to commit changes with message: %s", commitMessage)
+	commit := &object.Commit{
+		Author:       author,
+		Committer:    committer,
+		Message:      commitMessage,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+	obj := gitR.Storer.NewEncodedObject()
+	if err = commit.Encode(obj); err != nil {
+		return nil, err
+	}
+	commitHash, err := gitR.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = gitR.Storer.SetReference(plumbing.NewHashReference(head.Name(), commitHash)); err != nil {
+		return nil, err
+	}
+
+	return &commitHash, nil
+}
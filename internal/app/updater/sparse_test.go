@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"gotest.tools/v3/assert"
+)
+
+func TestUpdateApplicationLocalServerSparsePaths(t *testing.T) {
+	for _, shallowClone := range []bool{false, true} {
+		server := newLocalGitServer(t, 5)
+
+		changeEntries := []ChangeEntry{
+			{
+				OldValue: "1.0.0",
+				NewValue: "1.1.0",
+				Key:      ".image.tag",
+			},
+		}
+		cfg := newLocalGitServerConfig(server, changeEntries)
+		cfg.GitConf.ShallowClone = shallowClone
+		cfg.GitConf.SparsePaths = []string{validHelmAppName}
+
+		syncState := NewSyncIterationState()
+		apps, err := UpdateApplication(context.Background(), cfg, syncState)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, *apps, changeEntries)
+
+		content := server.Git(t, "show", validGitRepoBranch+":"+validHelmAppFileToChange)
+		assert.Equal(t, content, "image:\n  tag: 1.1.0\n")
+		changedFiles := server.Git(t, "diff", "--name-status", validGitRepoBranch+"~1", validGitRepoBranch)
+		assert.Equal(t, changedFiles, "M\t"+validHelmAppFileToChange+"\n")
+	}
+}
+
+func TestSparseCheckout(t *testing.T) {
+	server := newLocalGitServer(t, 3)
+	tempRoot := t.TempDir()
+
+	gitConf := server.Conf(validGitRepoBranch)
+	gitConf.SparsePaths = []string{"history/file-1.txt", validHelmAppName + "/"}
+	_, _, err := cloneGitRepositoryInBranch(context.Background(), validHelmAppName, *gitConf, nil, tempRoot, nil)
+	assert.NilError(t, err)
+
+	_, err = os.Stat(filepath.Join(tempRoot, validHelmAppFileToChange))
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(tempRoot, "history", "file-1.txt"))
+	assert.NilError(t, err)
+	_, err = os.Stat(filepath.Join(tempRoot, "history", "file-0.txt"))
+	assert.Assert(t, os.IsNotExist(err))
+
+	gitR, err := git.PlainOpen(tempRoot)
+	assert.NilError(t, err)
+	head, err := gitR.Head()
+	assert.NilError(t, err)
+	assert.Equal(t, head.Name().Short(), validGitRepoBranch)
+}
+
+func TestSparseCheckoutInvalidPath(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+
+	gitConf := server.Conf(validGitRepoBranch)
+	gitConf.SparsePaths = []string{"not-found"}
+	_, _, err := cloneGitRepositoryInBranch(context.Background(), validHelmAppName, *gitConf, nil, t.TempDir(), nil)
+
+	assert.Error(t, err, "sparse path not-found: entry not found")
+}
@@ -0,0 +1,38 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+
+	git_internal "github.com/docplanner/helm-repo-updater/internal/app/git"
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// createTag creates the tag pointing to the commit with the changes, annotated with the commit
+// message by the tagger when the tag configuration requires an annotated or signed tag
+func createTag(ctx context.Context, appName string, gitR *git.Repository, tagName string, commit plumbing.Hash, commitMessage string, tagConf git_internal.TagConf, tagger object.Signature) (*plumbing.Reference, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+
+	var opts *git.CreateTagOptions
+	if tagConf.Annotated || tagConf.SignKey != nil {
+		opts = &git.CreateTagOptions{
+			Tagger:  &tagger,
+			Message: commitMessage,
+			SignKey: tagConf.SignKey,
+		}
+	}
+
+	logCtx.Infof("Creating tag %s on commit %s", tagName, commit)
+	tag, err := gitR.CreateTag(tagName, commit, opts)
+	if err == git.ErrTagExists {
+		return nil, fmt.Errorf("tag %s already exists", tagName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create tag %s: %v", tagName, err)
+	}
+
+	return tag, nil
+}
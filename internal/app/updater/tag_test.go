@@ -0,0 +1,168 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"gotest.tools/v3/assert"
+)
+
+const validTagTemplate = "{{ .AppName }}-{{ (index .KeyChanges 0).NewValue }}"
+
+func TestTemplateTagName(t *testing.T) {
+	changes := []ChangeEntry{
+		{
+			Key:      ".image.tag",
+			OldValue: "1.0.0",
+			NewValue: "1.1.0",
+		},
+	}
+
+	tests := []struct {
+		name          string
+		template      string
+		expectedName  string
+		expectedError string
+	}{
+		{name: "valid name", template: validTagTemplate, expectedName: "example-app-1.1.0"},
+		{name: "trimmed name", template: " release/{{ .AppName }}\n", expectedName: "release/example-app"},
+		{name: "empty name", template: "{{ if false }}tag{{ end }}", expectedError: "invalid Git tag name ''"},
+		{name: "name with spaces", template: "{{ .AppName }} release", expectedError: "invalid Git tag name 'example-app release'"},
+		{name: "name with invalid sequence", template: "{{ .AppName }}..release", expectedError: "invalid Git tag name 'example-app..release'"},
+		{name: "name with lock suffix", template: "{{ .AppName }}.lock", expectedError: "invalid Git tag name 'example-app.lock'"},
+		{name: "template error", template: "{{ (index .KeyChanges 1).NewValue }}", expectedError: "could not execute template for Git tag name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tpl := template.Must(template.New("tagName").Parse(tt.template))
+			name, err := TemplateTagName(tpl, validHelmAppName, changes)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, name, tt.expectedName)
+		})
+	}
+}
+
+func TestUpdateApplicationLocalServerTag(t *testing.T) {
+	signKey, err := openpgp.NewEntity(validGitCredentialsUsername, "", validGitCredentialsEmail, nil)
+	assert.NilError(t, err)
+
+	tests := []struct {
+		name         string
+		annotated    bool
+		signed       bool
+		expectedType string
+	}{
+		{name: "lightweight", expectedType: "commit"},
+		{name: "annotated", annotated: true, expectedType: "tag"},
+		{name: "signed", signed: true, expectedType: "tag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newLocalGitServer(t, 1)
+
+			cfg := newLocalGitServerConfig(server, []ChangeEntry{
+				{
+					NewValue: "1.1.0",
+					Key:      ".image.tag",
+				},
+			})
+			cfg.GitConf.Tag.NameTemplate = template.Must(template.New("tagName").Parse(validTagTemplate))
+			cfg.GitConf.Tag.Annotated = tt.annotated
+			if tt.signed {
+				cfg.GitConf.Tag.SignKey = signKey
+			}
+
+			syncState := NewSyncIterationState()
+			_, err := UpdateApplication(context.Background(), cfg, syncState)
+			assert.NilError(t, err)
+
+			tagName := validHelmAppName + "-1.1.0"
+			assert.Equal(t, server.Git(t, "cat-file", "-t", tagName), tt.expectedType+"\n")
+			assert.Equal(t, server.Git(t, "rev-parse", tagName+"^{commit}"), server.Git(t, "rev-parse", validGitRepoBranch))
+			if tt.expectedType == "tag" {
+				tag := server.Git(t, "cat-file", "-p", tagName)
+				assert.Assert(t, strings.Contains(tag, "tagger "+validGitCredentialsUsername+" <"+validGitCredentialsEmail+">"))
+				assert.Assert(t, strings.Contains(tag, "updates key .image.tag value from '1.0.0' to '1.1.0'"))
+				assert.Equal(t, strings.Contains(tag, "-----BEGIN PGP SIGNATURE-----"), tt.signed)
+			}
+		})
+	}
+}
+
+func TestUpdateApplicationLocalServerTagExists(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+	server.Git(t, "tag", validHelmAppName+"-1.1.0", "main")
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Tag.NameTemplate = template.Must(template.New("tagName").Parse(validTagTemplate))
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.Error(t, err, "tag "+validHelmAppName+"-1.1.0 already exists")
+
+	// nothing is pushed when the tag can't be created
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), developCommit)
+}
+
+func TestUpdateApplicationLocalServerTagBranchRejected(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	developCommit := server.Git(t, "rev-parse", validGitRepoBranch)
+	// the server rejects the updates of the branches, but not the creation of the tags
+	hook := filepath.Join(server.root, localGitRepoName, "hooks", "update")
+	err := os.WriteFile(hook, []byte("#!/bin/sh\ncase \"$1\" in refs/heads/*) exit 1;; esac\n"), 0700)
+	assert.NilError(t, err)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.Tag.NameTemplate = template.Must(template.New("tagName").Parse(validTagTemplate))
+
+	syncState := NewSyncIterationState()
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "command error on refs/heads/develop: hook declined")
+
+	// the branch and the tag are pushed atomically
+	assert.Equal(t, server.Git(t, "rev-parse", validGitRepoBranch), developCommit)
+	assert.Equal(t, server.Git(t, "tag", "--list", validHelmAppName+"-1.1.0"), "")
+}
+
+func TestUpdateApplicationLocalRepoTagSkipPush(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	checkout := newLocalCheckout(t, server)
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.GitConf.LocalRepo = checkout
+	cfg.GitConf.SkipPush = true
+	cfg.GitConf.Tag.NameTemplate = template.Must(template.New("tagName").Parse(validTagTemplate))
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	tagName := validHelmAppName + "-1.1.0"
+	assert.Equal(t, localCheckoutGit(t, checkout, "rev-parse", tagName), localCheckoutGit(t, checkout, "rev-parse", validGitRepoBranch))
+	assert.Equal(t, server.Git(t, "tag", "--list", tagName), "")
+}
@@ -2,6 +2,8 @@ package updater
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
 	"text/template"
 
 	"github.com/docplanner/helm-repo-updater/internal/app/log"
@@ -14,26 +16,48 @@ type commitMessageChange struct {
 	NewValue string
 }
 
+type commitMessageApp struct {
+	AppName    string
+	KeyChanges []commitMessageChange
+}
+
 type commitMessageTemplate struct {
 	AppName    string
 	KeyChanges []commitMessageChange
+	// Apps are the changes grouped by application, when several applications are updated in the same commit
+	Apps []commitMessageApp
 }
 
-// TemplateCommitMessage renders a commit message template and returns it
-// as a string. If the template could not be rendered, returns a default message.
-func TemplateCommitMessage(tpl *template.Template, appName string, changeList []ChangeEntry) string {
-	var cmBuf bytes.Buffer
+// newCommitMessageTemplate returns the data available to the templates of the commit
+func newCommitMessageTemplate(appName string, changeList []ChangeEntry) commitMessageTemplate {
 	changes := make([]commitMessageChange, 0)
+	apps := make([]commitMessageApp, 0)
 	for _, c := range changeList {
-		changes = append(changes, commitMessageChange{c.File, c.Key, c.OldValue, c.NewValue})
+		change := commitMessageChange{c.File, c.Key, c.OldValue, c.NewValue}
+		changes = append(changes, change)
+
+		name := c.App
+		if name == "" {
+			name = appName
+		}
+		if len(apps) == 0 || apps[len(apps)-1].AppName != name {
+			apps = append(apps, commitMessageApp{AppName: name})
+		}
+		apps[len(apps)-1].KeyChanges = append(apps[len(apps)-1].KeyChanges, change)
 	}
 
-	tplData := commitMessageTemplate{
+	return commitMessageTemplate{
 		AppName:    appName,
 		KeyChanges: changes,
+		Apps:       apps,
 	}
+}
 
-	err := tpl.Execute(&cmBuf, tplData)
+// TemplateCommitMessage renders a commit message template and returns it
+// as a string. If the template could not be rendered, returns a default message.
+func TemplateCommitMessage(tpl *template.Template, appName string, changeList []ChangeEntry) string {
+	var cmBuf bytes.Buffer
+	err := tpl.Execute(&cmBuf, newCommitMessageTemplate(appName, changeList))
 	if err != nil {
 		log.Errorf("could not execute template for Git commit message: %v", err)
 
@@ -42,3 +66,39 @@ func TemplateCommitMessage(tpl *template.Template, appName string, changeList []
 
 	return cmBuf.String()
 }
+
+// TemplateTagName renders a tag name template with the same data as the commit message
+// and returns it as a string, failing if the result is not a valid tag name
+func TemplateTagName(tpl *template.Template, appName string, changeList []ChangeEntry) (string, error) {
+	var tagBuf bytes.Buffer
+	if err := tpl.Execute(&tagBuf, newCommitMessageTemplate(appName, changeList)); err != nil {
+		return "", fmt.Errorf("could not execute template for Git tag name: %v", err)
+	}
+
+	tagName := strings.TrimSpace(tagBuf.String())
+	if !validTagName(tagName) {
+		return "", fmt.Errorf("invalid Git tag name '%s'", tagName)
+	}
+
+	return tagName, nil
+}
+
+// validTagName checks the name follows the rules of git check-ref-format for tags
+func validTagName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "-") || strings.HasSuffix(name, ".") ||
+		strings.HasSuffix(name, "/") || strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.Contains(name, "//") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return false
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	for _, c := range name {
+		if c < ' ' {
+			return false
+		}
+	}
+	return true
+}
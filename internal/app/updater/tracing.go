@@ -0,0 +1,18 @@
+package updater
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endSpan records the error of the operation of the span and ends it, the updates with nothing
+// to update are not recorded as failed
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNothingToUpdate) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,57 @@
+package updater
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"gotest.tools/v3/assert"
+)
+
+func TestUpdateApplicationLocalServerTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	server := newLocalGitServer(t, 1)
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.missing",
+		},
+	})
+	ctx, parent := tracing.Start(context.Background(), "request")
+	_, commit, err := UpdateApplicationCommit(ctx, cfg, NewSyncIterationState())
+	assert.NilError(t, err)
+	parent.End()
+	// the spans are read before shutting down the provider, which resets the exporter
+	assert.NilError(t, provider.ForceFlush(context.Background()))
+	defer provider.Shutdown(context.Background())
+
+	spans := make(map[string][]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		assert.Equal(t, span.SpanContext.TraceID(), parent.SpanContext().TraceID())
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+	for _, name := range []string{"update", "credentials", "clone", "fetch", "checkout", "pull", "commit", "push"} {
+		assert.Equal(t, len(spans[name]), 1, name)
+	}
+	assert.Equal(t, len(spans["write key"]), 2)
+
+	update := spans["update"][0]
+	assert.Equal(t, update.Parent.SpanID(), parent.SpanContext().SpanID())
+	for _, name := range []string{"credentials", "clone", "fetch", "checkout", "commit"} {
+		assert.Equal(t, spans[name][0].Parent.SpanID(), update.SpanContext.SpanID(), name)
+	}
+	assert.Equal(t, spans["pull"][0].Parent.SpanID(), spans["checkout"][0].SpanContext.SpanID())
+	assert.Assert(t, commit != "")
+}
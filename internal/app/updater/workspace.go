@@ -0,0 +1,76 @@
+package updater
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+)
+
+// workspace is the temporal directory where a copy of the git repository is stored
+// during an update, removed once the update finishes unless it has to be kept
+type workspace struct {
+	Root   string
+	logCtx *log.Context
+	keep   bool
+	once   sync.Once
+}
+
+// activeWorkspaces are the workspaces not cleaned up yet, removed by CleanupWorkspaces
+var activeWorkspaces = struct {
+	sync.Mutex
+	workspaces map[*workspace]struct{}
+}{workspaces: map[*workspace]struct{}{}}
+
+// newWorkspace creates the temporal directory of the workspace where the git repository is going to be stored
+func newWorkspace(ctx context.Context, appName string, repoURL string, keep bool) (*workspace, error) {
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, appName)
+	root, err := ioutil.TempDir(os.TempDir(), "git-"+appName)
+	if err != nil {
+		return nil, err
+	}
+	logCtx.Debugf("Created temporal directory %s to clone repository %s", root, repoURL)
+
+	w := &workspace{Root: root, logCtx: logCtx, keep: keep}
+	activeWorkspaces.Lock()
+	activeWorkspaces.workspaces[w] = struct{}{}
+	activeWorkspaces.Unlock()
+
+	return w, nil
+}
+
+// Cleanup removes the temporal directory of the workspace, it is safe to call it more than once
+func (w *workspace) Cleanup() {
+	w.once.Do(func() {
+		activeWorkspaces.Lock()
+		delete(activeWorkspaces.workspaces, w)
+		activeWorkspaces.Unlock()
+
+		logCtx := w.logCtx
+		if w.keep {
+			logCtx.Infof("Keeping workspace located in %s", w.Root)
+			return
+		}
+		logCtx.Debugf("Removing workspace located in %s", w.Root)
+		if err := os.RemoveAll(w.Root); err != nil {
+			logCtx.Errorf("could not remove workspace %s: %v", w.Root, err)
+		}
+	})
+}
+
+// CleanupWorkspaces cleans up all the workspaces not cleaned up yet. The updates clean up their workspaces
+// when they finish, even if they are cancelled, so it's only needed once the updates have been drained
+func CleanupWorkspaces() {
+	activeWorkspaces.Lock()
+	workspaces := make([]*workspace, 0, len(activeWorkspaces.workspaces))
+	for w := range activeWorkspaces.workspaces {
+		workspaces = append(workspaces, w)
+	}
+	activeWorkspaces.Unlock()
+
+	for _, w := range workspaces {
+		w.Cleanup()
+	}
+}
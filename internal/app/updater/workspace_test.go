@@ -0,0 +1,100 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// workspacesInTempDir returns the workspaces of the example app in the temporal directory
+func workspacesInTempDir(t *testing.T) []string {
+	t.Helper()
+	workspaces, err := filepath.Glob(filepath.Join(os.TempDir(), "git-"+validHelmAppName+"*"))
+	assert.NilError(t, err)
+	return workspaces
+}
+
+func TestWorkspaceCleanup(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ws, err := newWorkspace(context.Background(), validHelmAppName, "https://example.com/test-repo.git", false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, workspacesInTempDir(t), []string{ws.Root})
+
+	ws.Cleanup()
+	ws.Cleanup()
+	assert.Equal(t, len(workspacesInTempDir(t)), 0)
+}
+
+func TestWorkspaceKeep(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ws, err := newWorkspace(context.Background(), validHelmAppName, "https://example.com/test-repo.git", true)
+	assert.NilError(t, err)
+
+	ws.Cleanup()
+	assert.DeepEqual(t, workspacesInTempDir(t), []string{ws.Root})
+}
+
+func TestCleanupWorkspaces(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	for i := 0; i < 3; i++ {
+		_, err := newWorkspace(context.Background(), validHelmAppName, "https://example.com/test-repo.git", false)
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, len(workspacesInTempDir(t)), 3)
+
+	CleanupWorkspaces()
+	assert.Equal(t, len(workspacesInTempDir(t)), 0)
+	assert.Equal(t, len(activeWorkspaces.workspaces), 0)
+}
+
+func TestUpdateApplicationLocalServerWorkspaceRemoved(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+	assert.Equal(t, len(workspacesInTempDir(t)), 0)
+
+	// the workspace is removed as well when the update fails
+	cfg.File = validHelmAppName + "/values.yamll"
+	_, err = UpdateApplication(context.Background(), cfg, syncState)
+	assert.ErrorContains(t, err, "no such file or directory")
+	assert.Equal(t, len(workspacesInTempDir(t)), 0)
+}
+
+func TestUpdateApplicationLocalServerKeepWorkspace(t *testing.T) {
+	server := newLocalGitServer(t, 1)
+	t.Setenv("TMPDIR", t.TempDir())
+
+	cfg := newLocalGitServerConfig(server, []ChangeEntry{
+		{
+			NewValue: "1.1.0",
+			Key:      ".image.tag",
+		},
+	})
+	cfg.KeepWorkspace = true
+
+	syncState := NewSyncIterationState()
+	_, err := UpdateApplication(context.Background(), cfg, syncState)
+	assert.NilError(t, err)
+
+	workspaces := workspacesInTempDir(t)
+	assert.Equal(t, len(workspaces), 1)
+	content, err := os.ReadFile(filepath.Join(workspaces[0], validHelmAppFileToChange))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "image:\n  tag: 1.1.0\n")
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keeps the values of the context without its deadline and cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// WithoutCancel returns a copy of ctx with its values, eg. the trace and the log fields, which is not
+// cancelled when ctx is, so the work outliving it keeps them
+func WithoutCancel(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// SecretSource contains the different places from where a secret value can be obtained,
+// only one of them can be used at the same time
+type SecretSource struct {
+	// Name is the name of the secret used in error messages
+	Name string
+	// Value is the secret value provided directly
+	Value string
+	// File is the location of a file with the secret value
+	File string
+	// EnvVar is the name of the environment variable with the secret value
+	EnvVar string
+	// Stdin indicates that the secret value is going to be read from the standard input
+	Stdin bool
+}
+
+// sourcesProvided returns the number of sources configured for the secret
+func (s SecretSource) sourcesProvided() int {
+	provided := 0
+	for _, isProvided := range []bool{s.Value != "", s.File != "", s.EnvVar != "", s.Stdin} {
+		if isProvided {
+			provided++
+		}
+	}
+	return provided
+}
+
+// Resolve obtains the secret value from the configured source, using stdin as
+// the reader of the standard input. An empty value is returned if no source is configured
+func (s SecretSource) Resolve(stdin io.Reader) (string, error) {
+	if s.sourcesProvided() > 1 {
+		return "", fmt.Errorf("only one source can be provided for %s", s.Name)
+	}
+
+	switch {
+	case s.File != "":
+		content, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s from file: %v", s.Name, err)
+		}
+		return trimTrailingNewLine(string(content)), nil
+	case s.EnvVar != "":
+		value, exists := os.LookupEnv(s.EnvVar)
+		if !exists || value == "" {
+			return "", fmt.Errorf("environment variable %s with %s is not set", s.EnvVar, s.Name)
+		}
+		return trimTrailingNewLine(value), nil
+	case s.Stdin:
+		content, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s from stdin: %v", s.Name, err)
+		}
+		return trimTrailingNewLine(string(content)), nil
+	}
+
+	return s.Value, nil
+}
+
+// trimTrailingNewLine removes the new line characters present at the end of value
+func trimTrailingNewLine(value string) string {
+	return strings.TrimRight(value, "\r\n")
+}
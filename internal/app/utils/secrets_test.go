@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const validSecretValue = "test-password"
+
+func TestSecretSourceResolveValue(t *testing.T) {
+	value, err := SecretSource{Name: "password", Value: validSecretValue}.Resolve(nil)
+
+	assert.NilError(t, err)
+	assert.Equal(t, value, validSecretValue)
+}
+
+func TestSecretSourceResolveFile(t *testing.T) {
+	f, err := CreateAndWriteContentInTempFile("secret", validSecretValue+"\n")
+	assert.NilError(t, err)
+	defer os.Remove(f.Name())
+
+	value, err := SecretSource{Name: "password", File: f.Name()}.Resolve(nil)
+
+	assert.NilError(t, err)
+	assert.Equal(t, value, validSecretValue)
+}
+
+func TestSecretSourceResolveEnvVar(t *testing.T) {
+	t.Setenv("HELM_REPO_UPDATER_TEST_SECRET", validSecretValue)
+
+	value, err := SecretSource{Name: "password", EnvVar: "HELM_REPO_UPDATER_TEST_SECRET"}.Resolve(nil)
+
+	assert.NilError(t, err)
+	assert.Equal(t, value, validSecretValue)
+}
+
+func TestSecretSourceResolveEnvVarNotSet(t *testing.T) {
+	_, err := SecretSource{Name: "password", EnvVar: "HELM_REPO_UPDATER_TEST_SECRET_NOT_SET"}.Resolve(nil)
+
+	assert.Error(t, err, "environment variable HELM_REPO_UPDATER_TEST_SECRET_NOT_SET with password is not set")
+}
+
+func TestSecretSourceResolveStdin(t *testing.T) {
+	value, err := SecretSource{Name: "password", Stdin: true}.Resolve(strings.NewReader(validSecretValue + "\r\n"))
+
+	assert.NilError(t, err)
+	assert.Equal(t, value, validSecretValue)
+}
+
+func TestSecretSourceResolveMultipleSources(t *testing.T) {
+	_, err := SecretSource{Name: "password", Value: validSecretValue, Stdin: true}.Resolve(nil)
+
+	assert.Error(t, err, "only one source can be provided for password")
+}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semverRegexp matches the semantic versions, optionally prefixed by v, eg. v1.2.3-rc.1+build.5
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// CompareSemver compares two semantic versions by precedence, returning -1, 0 or 1 if a is lower,
+// equal or greater than b. The build metadata is ignored, and ok is false if any of them is not
+// a semantic version
+func CompareSemver(a, b string) (result int, ok bool) {
+	ma := semverRegexp.FindStringSubmatch(a)
+	mb := semverRegexp.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return 0, false
+	}
+	for i := 1; i <= 3; i++ {
+		if c := compareNumeric(ma[i], mb[i]); c != 0 {
+			return c, true
+		}
+	}
+
+	// a version without pre-release has higher precedence than the same version with it
+	switch {
+	case ma[4] == mb[4]:
+		return 0, true
+	case ma[4] == "":
+		return 1, true
+	case mb[4] == "":
+		return -1, true
+	}
+	pa := strings.Split(ma[4], ".")
+	pb := strings.Split(mb[4], ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if c := comparePrerelease(pa[i], pb[i]); c != 0 {
+			return c, true
+		}
+	}
+	return compareInts(len(pa), len(pb)), true
+}
+
+// comparePrerelease compares two identifiers of pre-release versions, the numeric ones have lower precedence
+func comparePrerelease(a, b string) int {
+	_, errA := strconv.ParseUint(a, 10, 64)
+	_, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return compareNumeric(a, b)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// compareNumeric compares two numbers without leading zeros of any length
+func compareNumeric(a, b string) int {
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// compareInts returns -1, 0 or 1 if a is lower, equal or greater than b
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// semverComparisonRegexp matches a comparison of a constraint, whose version can be partial, eg. >=1.2 or ^1
+var semverComparisonRegexp = regexp.MustCompile(`^(>=|<=|!=|>|<|=|\^|~)?v?(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:\.(0|[1-9]\d*))?(-[0-9A-Za-z.-]+)?$`)
+
+// semverOperatorSpace matches the spaces between the operator and the version of a comparison
+var semverOperatorSpace = regexp.MustCompile(`(>=|<=|!=|>|<|=|\^|~)\s+`)
+
+// semverComparison compares a version with the version of a constraint
+type semverComparison struct {
+	operator string
+	version  string
+}
+
+// SemverConstraint is a set of ranges of semantic versions, a version satisfies it when it is in any of them
+type SemverConstraint struct {
+	ranges [][]semverComparison
+}
+
+// ParseSemverConstraint parses a constraint of semantic versions, made of ranges separated by ||, each of them
+// with comparisons separated by spaces or commas which the versions must satisfy, eg. >=1.2.0 <2.0.0 || ^3.1.
+// The operators are =, !=, >, >=, <, <=, ^ (same major version, or minor version for 0.x versions) and ~
+// (same minor version). A partial version without operator, eg. 1.2, matches any version starting with it
+func ParseSemverConstraint(constraint string) (*SemverConstraint, error) {
+	c := &SemverConstraint{}
+	for _, part := range strings.Split(constraint, "||") {
+		part = semverOperatorSpace.ReplaceAllString(strings.ReplaceAll(part, ",", " "), "$1")
+		var comparisons []semverComparison
+		for _, field := range strings.Fields(part) {
+			parsed, err := parseSemverComparison(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint %s: %v", constraint, err)
+			}
+			comparisons = append(comparisons, parsed...)
+		}
+		if len(comparisons) == 0 {
+			return nil, fmt.Errorf("invalid version constraint %s: empty range", constraint)
+		}
+		c.ranges = append(c.ranges, comparisons)
+	}
+	return c, nil
+}
+
+// parseSemverComparison parses a comparison of a constraint, returning the comparisons with full versions
+// equivalent to it. The upper bounds of the ranges exclude the pre-release versions of the bound
+func parseSemverComparison(comparison string) ([]semverComparison, error) {
+	m := semverComparisonRegexp.FindStringSubmatch(comparison)
+	if m == nil {
+		return nil, fmt.Errorf("invalid comparison %s", comparison)
+	}
+	operator, prerelease := m[1], m[5]
+	major, _ := strconv.Atoi(m[2])
+	minor, _ := strconv.Atoi(m[3])
+	patch, _ := strconv.Atoi(m[4])
+	hasMinor, hasPatch := m[3] != "", m[4] != ""
+	lower := fmt.Sprintf("%d.%d.%d%s", major, minor, patch, prerelease)
+	upper := func(major, minor, patch int) semverComparison {
+		return semverComparison{operator: "<", version: fmt.Sprintf("%d.%d.%d-0", major, minor, patch)}
+	}
+
+	switch operator {
+	case "^":
+		bound := upper(major+1, 0, 0)
+		switch {
+		case major == 0 && hasMinor && minor > 0:
+			bound = upper(0, minor+1, 0)
+		case major == 0 && hasPatch:
+			bound = upper(0, 0, patch+1)
+		case major == 0 && hasMinor:
+			bound = upper(0, 1, 0)
+		}
+		return []semverComparison{{operator: ">=", version: lower}, bound}, nil
+	case "~":
+		bound := upper(major+1, 0, 0)
+		if hasMinor {
+			bound = upper(major, minor+1, 0)
+		}
+		return []semverComparison{{operator: ">=", version: lower}, bound}, nil
+	case "", "=":
+		switch {
+		case hasPatch:
+			return []semverComparison{{operator: "=", version: lower}}, nil
+		case hasMinor:
+			return []semverComparison{{operator: ">=", version: lower}, upper(major, minor+1, 0)}, nil
+		}
+		return []semverComparison{{operator: ">=", version: lower}, upper(major+1, 0, 0)}, nil
+	}
+	return []semverComparison{{operator: operator, version: lower}}, nil
+}
+
+// Check checks if the semantic version satisfies the constraint
+func (c *SemverConstraint) Check(version string) bool {
+	for _, comparisons := range c.ranges {
+		satisfied := true
+		for _, comparison := range comparisons {
+			if !comparison.check(version) {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks if the semantic version satisfies the comparison
+func (c semverComparison) check(version string) bool {
+	result, ok := CompareSemver(version, c.version)
+	if !ok {
+		return false
+	}
+	switch c.operator {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		result int
+		ok     bool
+	}{
+		{a: "1.2.3", b: "1.2.3", result: 0, ok: true},
+		{a: "v1.2.3", b: "1.2.3", result: 0, ok: true},
+		{a: "1.10.0", b: "1.9.0", result: 1, ok: true},
+		{a: "1.9.9", b: "2.0.0", result: -1, ok: true},
+		{a: "1.0.0-rc.1", b: "1.0.0", result: -1, ok: true},
+		{a: "1.0.0-rc.10", b: "1.0.0-rc.2", result: 1, ok: true},
+		{a: "1.0.0-alpha", b: "1.0.0-1", result: 1, ok: true},
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", result: -1, ok: true},
+		{a: "1.0.0+build.2", b: "1.0.0+build.1", result: 0, ok: true},
+		{a: "latest", b: "1.0.0", ok: false},
+		{a: "1.0", b: "1.0.0", ok: false},
+		{a: "01.0.0", b: "1.0.0", ok: false},
+	}
+	for _, test := range tests {
+		result, ok := CompareSemver(test.a, test.b)
+		assert.Equal(t, ok, test.ok, "%s %s", test.a, test.b)
+		assert.Equal(t, result, test.result, "%s %s", test.a, test.b)
+	}
+}
+
+func TestSemverConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		excludes   []string
+	}{
+		{constraint: "1.2.3", matches: []string{"1.2.3", "v1.2.3"}, excludes: []string{"1.2.4", "1.2.3-rc.1"}},
+		{constraint: ">=1.2.0 <2.0.0", matches: []string{"1.2.0", "1.9.9"}, excludes: []string{"1.1.9", "2.0.0"}},
+		{constraint: ">= 1.2, < 2", matches: []string{"1.2.0", "1.9.9"}, excludes: []string{"1.1.9", "2.0.0"}},
+		{constraint: "^1.2.3", matches: []string{"1.2.3", "1.9.0"}, excludes: []string{"1.2.2", "2.0.0", "2.0.0-rc.1"}},
+		{constraint: "^0.2.3", matches: []string{"0.2.3", "0.2.9"}, excludes: []string{"0.3.0"}},
+		{constraint: "^0.0.3", matches: []string{"0.0.3"}, excludes: []string{"0.0.4"}},
+		{constraint: "~1.2.3", matches: []string{"1.2.3", "1.2.9"}, excludes: []string{"1.3.0"}},
+		{constraint: "~1", matches: []string{"1.0.0", "1.9.0"}, excludes: []string{"2.0.0"}},
+		{constraint: "1.2", matches: []string{"1.2.0", "1.2.9"}, excludes: []string{"1.3.0", "1.1.0"}},
+		{constraint: "^1.0 || ^3.0, !=3.1.0", matches: []string{"1.5.0", "3.0.1", "3.2.0"}, excludes: []string{"2.0.0", "3.1.0", "latest"}},
+		{constraint: ">=1.0.0-rc.1", matches: []string{"1.0.0-rc.2", "1.0.0"}, excludes: []string{"1.0.0-beta.1"}},
+	}
+	for _, test := range tests {
+		constraint, err := ParseSemverConstraint(test.constraint)
+		assert.NilError(t, err, test.constraint)
+		for _, version := range test.matches {
+			assert.Assert(t, constraint.Check(version), "%s %s", test.constraint, version)
+		}
+		for _, version := range test.excludes {
+			assert.Assert(t, !constraint.Check(version), "%s %s", test.constraint, version)
+		}
+	}
+
+	for _, invalid := range []string{"", "1.2.3 ||", "=>1.2.3", "latest", "1.2.3.4"} {
+		_, err := ParseSemverConstraint(invalid)
+		assert.ErrorContains(t, err, "invalid version constraint", invalid)
+	}
+}
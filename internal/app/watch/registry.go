@@ -0,0 +1,227 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// dockerHubHost is the host of the images without registry
+	dockerHubHost = "docker.io"
+	// dockerHubRegistry is the host serving the registry API of Docker Hub
+	dockerHubRegistry = "registry-1.docker.io"
+	// maxResponseSize is the maximum size of the responses of the registries and chart repositories
+	maxResponseSize = 32 << 20
+)
+
+// challengeParam matches the parameters of the WWW-Authenticate challenge of a registry
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// nextLink matches the link to the next page of the tags of a repository
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// parseImage returns the host of the registry and the repository of an image
+func parseImage(image string) (string, string) {
+	host, repository := dockerHubHost, image
+	if parts := strings.SplitN(image, "/", 2); len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, repository = parts[0], parts[1]
+	}
+	if host == dockerHubHost {
+		host = dockerHubRegistry
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+	return host, repository
+}
+
+// registryTags returns the tags of the image of the source listed by the Docker registry HTTP API
+func registryTags(ctx context.Context, client *http.Client, source *Source) ([]string, error) {
+	start := time.Now()
+	defer func() {
+		metrics.RegistryRequestDuration.WithLabelValues("image").Observe(metrics.Since(start))
+	}()
+
+	host, repository := parseImage(source.Image)
+	scheme := "https"
+	if source.Insecure {
+		scheme = "http"
+	}
+	next := fmt.Sprintf("%s://%s/v2/%s/tags/list", scheme, host, repository)
+
+	var tags []string
+	var authorization string
+	for next != "" {
+		resp, err := registryGet(ctx, client, next, authorization)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && authorization == "" {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if authorization, err = authorize(ctx, client, source, repository, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = decodeResponse(resp, func(body []byte) error { return json.Unmarshal(body, &page) })
+		if err != nil {
+			return nil, fmt.Errorf("could not list tags of image %s: %v", source.Image, err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if match := nextLink.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			link, err := resp.Request.URL.Parse(match[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid link to the next tags of image %s: %v", source.Image, err)
+			}
+			next = link.String()
+		}
+	}
+	return tags, nil
+}
+
+// authorize returns the authorization header answering the challenge of the registry, obtaining a
+// bearer token from the realm of the challenge for the registries using token authentication
+func authorize(ctx context.Context, client *http.Client, source *Source, repository, challenge string) (string, error) {
+	scheme := strings.ToLower(strings.SplitN(challenge, " ", 2)[0])
+	if scheme == "basic" {
+		if source.Username == "" {
+			return "", fmt.Errorf("registry of image %s requires credentials", source.Image)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(source.Username, source.password())
+		return req.Header.Get("Authorization"), nil
+	}
+	if scheme != "bearer" {
+		return "", fmt.Errorf("unsupported authentication challenge of registry of image %s: %q", source.Image, challenge)
+	}
+
+	params := make(map[string]string)
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid realm of authentication challenge of registry of image %s: %q", source.Image, challenge)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if source.Username != "" {
+		req.SetBasicAuth(source.Username, source.password())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("could not get token of registry of image %s: %v", source.Image, err)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = decodeResponse(resp, func(body []byte) error { return json.Unmarshal(body, &token) })
+	if err != nil {
+		return "", fmt.Errorf("could not get token of registry of image %s: %v", source.Image, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("could not get token of registry of image %s: empty token", source.Image)
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// registryGet requests the address of the registry with the authorization header, if any
+func registryGet(ctx context.Context, client *http.Client, address, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return client.Do(req)
+}
+
+// chartVersions returns the versions of the chart of the source listed in the index of its repository
+func chartVersions(ctx context.Context, client *http.Client, source *Source) ([]string, error) {
+	start := time.Now()
+	defer func() {
+		metrics.RegistryRequestDuration.WithLabelValues("chart").Observe(metrics.Since(start))
+	}()
+
+	indexURL := strings.TrimSuffix(source.ChartRepository, "/") + "/index.yaml"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if source.Username != "" {
+		req.SetBasicAuth(source.Username, source.password())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get index of chart repository %s: %v", source.ChartRepository, err)
+	}
+
+	var index struct {
+		Entries map[string][]struct {
+			Version string `yaml:"version"`
+		} `yaml:"entries"`
+	}
+	err = decodeResponse(resp, func(body []byte) error { return yaml.Unmarshal(body, &index) })
+	if err != nil {
+		return nil, fmt.Errorf("could not get index of chart repository %s: %v", source.ChartRepository, err)
+	}
+	entries, found := index.Entries[source.Chart]
+	if !found {
+		return nil, fmt.Errorf("chart %s not found in index of chart repository %s", source.Chart, source.ChartRepository)
+	}
+	versions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		versions = append(versions, entry.Version)
+	}
+	return versions, nil
+}
+
+// decodeResponse checks the response is successful and decodes its body, closing it
+func decodeResponse(resp *http.Response, decode func(body []byte) error) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	return decode(body)
+}
@@ -0,0 +1,119 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// newTestRegistry returns a registry stand-in serving the tags of the repository in pages of
+// two tags, which requires a bearer token obtained with the credentials of the user
+func newTestRegistry(t *testing.T, repository string, tags []string) *httptest.Server {
+	t.Helper()
+	const token = "registry-token"
+	var registry *httptest.Server
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			user, password, _ := r.BasicAuth()
+			if user != "registry-user" || password != "registry-password" ||
+				r.URL.Query().Get("scope") != "repository:"+repository+":pull" || r.URL.Query().Get("service") != "test-registry" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+		case r.Header.Get("Authorization") != "Bearer "+token:
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, registry.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/"+repository+"/tags/list":
+			var last int
+			if start := r.URL.Query().Get("last"); start != "" {
+				fmt.Sscanf(start, "%d", &last)
+			}
+			end := last + 2
+			if end >= len(tags) {
+				end = len(tags)
+			} else {
+				w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=2&last=%d>; rel="next"`, repository, end))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repository, "tags": tags[last:end]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(registry.Close)
+	return registry
+}
+
+func TestParseImage(t *testing.T) {
+	tests := map[string][2]string{
+		"nginx":                          {"registry-1.docker.io", "library/nginx"},
+		"docker.io/bitnami/nginx":        {"registry-1.docker.io", "bitnami/nginx"},
+		"ghcr.io/docplanner/example-app": {"ghcr.io", "docplanner/example-app"},
+		"localhost:5000/example-app":     {"localhost:5000", "example-app"},
+	}
+	for image, expected := range tests {
+		host, repository := parseImage(image)
+		assert.DeepEqual(t, [2]string{host, repository}, expected)
+	}
+}
+
+func TestRegistryTags(t *testing.T) {
+	tags := []string{"1.0.0", "1.1.0", "latest", "1.2.0", "2.0.0-rc.1"}
+	registry := newTestRegistry(t, "docplanner/example-app", tags)
+	t.Setenv("REGISTRY_PASSWORD", "registry-password")
+
+	source := &Source{
+		Image:           strings.TrimPrefix(registry.URL, "http://") + "/docplanner/example-app",
+		Insecure:        true,
+		Username:        "registry-user",
+		PasswordFromEnv: "REGISTRY_PASSWORD",
+	}
+	listed, err := registryTags(context.Background(), registry.Client(), source)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, listed, tags)
+
+	source.Username = "other-user"
+	_, err = registryTags(context.Background(), registry.Client(), source)
+	assert.ErrorContains(t, err, "could not get token of registry of image")
+}
+
+func TestChartVersions(t *testing.T) {
+	repository := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/charts/index.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `apiVersion: v1
+entries:
+  example-chart:
+    - name: example-chart
+      version: 1.1.0
+    - name: example-chart
+      version: 1.0.0
+  other-chart:
+    - name: other-chart
+      version: 3.0.0
+`)
+	}))
+	defer repository.Close()
+
+	source := &Source{Chart: "example-chart", ChartRepository: repository.URL + "/charts/"}
+	versions, err := chartVersions(context.Background(), repository.Client(), source)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, versions, []string{"1.1.0", "1.0.0"})
+
+	source.Chart = "missing-chart"
+	_, err = chartVersions(context.Background(), repository.Client(), source)
+	assert.ErrorContains(t, err, "chart missing-chart not found in index")
+
+	source.ChartRepository = repository.URL
+	_, err = chartVersions(context.Background(), repository.Client(), source)
+	assert.ErrorContains(t, err, "unexpected status 404 Not Found")
+}
@@ -0,0 +1,171 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/utils"
+	"github.com/docplanner/helm-repo-updater/internal/app/yq"
+	"gopkg.in/yaml.v3"
+)
+
+// Source is an image repository or a Helm chart whose newest version is set in the key of the values of an application
+type Source struct {
+	// Image is the repository of the image whose tags are polled, eg. ghcr.io/docplanner/example-app
+	Image string `yaml:"image"`
+	// Chart is the name of the Helm chart whose versions are polled from the index of ChartRepository
+	Chart string `yaml:"chart"`
+	// ChartRepository is the url of the Helm chart repository, eg. https://charts.example.com
+	ChartRepository string `yaml:"chartRepository"`
+	// Tag is a regular expression the versions must match to be eligible, every version matches if empty
+	Tag string `yaml:"tag"`
+	// Version is a constraint the semantic versions must satisfy to be eligible, eg. ^1.2 or >=1.2.0 <2.0.0
+	Version string `yaml:"version"`
+	// Prerelease makes the semantic versions with a prerelease eligible, eg. 1.2.0-rc.1
+	Prerelease bool `yaml:"prerelease"`
+	// Interval is the time between the polls of the source, the interval of the watcher is used if zero
+	Interval time.Duration `yaml:"interval"`
+	// Insecure polls the image registry using plain HTTP
+	Insecure bool `yaml:"insecure"`
+	// Username is the user authenticated with the registry or the chart repository
+	Username string `yaml:"username"`
+	// PasswordFromEnv is the name of the environment variable with the password of Username
+	PasswordFromEnv string `yaml:"passwordFromEnv"`
+	// App is the name of the application updated
+	App string `yaml:"app"`
+	// File is the location of the values file inside the directory of the application
+	File string `yaml:"file"`
+	// Key is the key of the values file updated, eg. .image.tag
+	Key string `yaml:"key"`
+
+	tag        *regexp.Regexp
+	constraint *utils.SemverConstraint
+}
+
+// sourcesFile is the content of the file with the sources
+type sourcesFile struct {
+	Sources []Source `yaml:"sources"`
+}
+
+// LoadSources reads the sources from a YAML file
+func LoadSources(file string) ([]Source, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read watch sources from file %s: %v", file, err)
+	}
+	var sources sourcesFile
+	if err = yaml.Unmarshal(content, &sources); err != nil {
+		return nil, fmt.Errorf("could not parse watch sources from file %s: %v", file, err)
+	}
+	ids := make(map[string]bool)
+	for i := range sources.Sources {
+		source := &sources.Sources[i]
+		if err = source.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid watch source %d of file %s: %v", i+1, file, err)
+		}
+		if ids[source.ID()] {
+			return nil, fmt.Errorf("invalid watch source %d of file %s: key %s is already updated by another source", i+1, file, source.ID())
+		}
+		ids[source.ID()] = true
+	}
+	return sources.Sources, nil
+}
+
+// Compile checks the source is valid, compiling its tag regular expression and version constraint
+func (s *Source) Compile() error {
+	if s.App == "" || s.File == "" || s.Key == "" {
+		return fmt.Errorf("app, file and key are required")
+	}
+	// the key is written in the yq expressions of the updates, so it can only be a plain path
+	if err := yq.ValidateKey(s.Key); err != nil {
+		return err
+	}
+	if (s.Image == "") == (s.Chart == "") {
+		return fmt.Errorf("one of image or chart is required")
+	}
+	if s.Chart != "" && s.ChartRepository == "" {
+		return fmt.Errorf("the chart repository is required")
+	}
+	if s.Interval < 0 {
+		return fmt.Errorf("invalid interval %s", s.Interval)
+	}
+	if s.Tag != "" {
+		tag, err := regexp.Compile(s.Tag)
+		if err != nil {
+			return fmt.Errorf("invalid tag regular expression %s: %v", s.Tag, err)
+		}
+		s.tag = tag
+	}
+	if s.Version != "" {
+		constraint, err := utils.ParseSemverConstraint(s.Version)
+		if err != nil {
+			return err
+		}
+		s.constraint = constraint
+	}
+	return nil
+}
+
+// ID identifies the source by the key it updates, which is used to store its state
+func (s *Source) ID() string {
+	return s.App + "/" + s.File + ":" + s.Key
+}
+
+// String describes what is polled by the source
+func (s *Source) String() string {
+	if s.Image != "" {
+		return "image " + s.Image
+	}
+	return "chart " + s.Chart + " of " + s.ChartRepository
+}
+
+// Versions lists the versions of the image or the chart of the source
+func (s *Source) Versions(ctx context.Context, client *http.Client) ([]string, error) {
+	if s.Image != "" {
+		return registryTags(ctx, client, s)
+	}
+	return chartVersions(ctx, client, s)
+}
+
+// password returns the password of the user authenticated with the registry or the chart repository
+func (s *Source) password() string {
+	if s.PasswordFromEnv == "" {
+		return ""
+	}
+	return os.Getenv(s.PasswordFromEnv)
+}
+
+// eligible checks if the version can be set in the key of the source, only semantic
+// versions are eligible because they are the only ones which can be ordered
+func (s *Source) eligible(version string) bool {
+	if s.tag != nil && !s.tag.MatchString(version) {
+		return false
+	}
+	if _, ok := utils.CompareSemver(version, version); !ok {
+		return false
+	}
+	if s.constraint != nil && !s.constraint.Check(version) {
+		return false
+	}
+	release := strings.SplitN(version, "+", 2)[0]
+	return s.Prerelease || !strings.Contains(release, "-")
+}
+
+// Newest returns the newest eligible version, or an empty string if there is none
+func (s *Source) Newest(versions []string) string {
+	var newest string
+	for _, version := range versions {
+		if !s.eligible(version) {
+			continue
+		}
+		if result, _ := utils.CompareSemver(version, newest); newest == "" || result > 0 {
+			newest = version
+		}
+	}
+	return newest
+}
@@ -0,0 +1,99 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// writeSources writes the sources to a file, returning its location
+func writeSources(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "sources.yaml")
+	assert.NilError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestLoadSources(t *testing.T) {
+	file := writeSources(t, `
+sources:
+  - image: ghcr.io/docplanner/example-app
+    tag: '^v?\d+\.\d+\.\d+'
+    version: <2.0.0
+    interval: 1m
+    app: example-app
+    file: values.yaml
+    key: .image.tag
+  - chart: example-chart
+    chartRepository: https://charts.example.com
+    prerelease: true
+    app: example-app
+    file: values.yaml
+    key: .chart.version
+`)
+	sources, err := LoadSources(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(sources), 2)
+	assert.Equal(t, sources[0].Interval, time.Minute)
+	assert.Equal(t, sources[0].ID(), "example-app/values.yaml:.image.tag")
+	assert.Equal(t, sources[0].String(), "image ghcr.io/docplanner/example-app")
+	assert.Equal(t, sources[1].String(), "chart example-chart of https://charts.example.com")
+
+	// only the semantic versions matching the tag and the constraint without prerelease are eligible
+	versions := []string{"latest", "1.10.0", "v1.9.0", "1.11.0-rc.1", "2.0.0-rc.1", "2.1.0", "release-3.0.0", "1.2"}
+	assert.Equal(t, sources[0].Newest(versions), "1.10.0")
+	assert.Equal(t, sources[1].Newest(versions), "2.1.0")
+	assert.Equal(t, sources[0].Newest([]string{"latest"}), "")
+}
+
+func TestLoadSourcesInvalid(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		error   string
+	}{
+		"missing key": {
+			content: "sources:\n  - image: ghcr.io/docplanner/example-app\n    app: example-app\n    file: values.yaml\n",
+			error:   "invalid watch source 1",
+		},
+		"expression key": {
+			content: "sources:\n  - image: ghcr.io/docplanner/example-app\n    app: example-app\n    file: values.yaml\n    key: '.x = load(\"/path/secret\") | .image.tag'\n",
+			error:   "must be a path of keys and indexes",
+		},
+		"image and chart": {
+			content: "sources:\n  - image: ghcr.io/docplanner/example-app\n    chart: example-chart\n    chartRepository: https://charts.example.com\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "one of image or chart is required",
+		},
+		"missing chart repository": {
+			content: "sources:\n  - chart: example-chart\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "the chart repository is required",
+		},
+		"invalid tag": {
+			content: "sources:\n  - image: ghcr.io/docplanner/example-app\n    tag: '('\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "invalid tag regular expression",
+		},
+		"invalid version": {
+			content: "sources:\n  - image: ghcr.io/docplanner/example-app\n    version: latest\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "invalid version constraint latest",
+		},
+		"duplicated key": {
+			content: "sources:\n  - image: example-app\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n  - image: other-app\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "invalid watch source 2 of file",
+		},
+		"invalid interval": {
+			content: "sources:\n  - image: example-app\n    interval: often\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "could not parse watch sources",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadSources(writeSources(t, test.content))
+			assert.ErrorContains(t, err, test.error)
+		})
+	}
+
+	_, err := LoadSources(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "could not read watch sources")
+}
@@ -0,0 +1,96 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SourceState is what is known about a source since the last time it was polled
+type SourceState struct {
+	// Version is the newest version of the source known to be set in its key
+	Version string `json:"version,omitempty"`
+	// CheckedAt is the last time the source was polled
+	CheckedAt time.Time `json:"checkedAt"`
+	// UpdatedAt is the last time the version of the source was committed by the watcher
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// State is the state of the sources persisted in a file between runs of the watcher, so
+// the versions already set are not checked again and the intervals survive restarts
+type State struct {
+	file    string
+	mu      sync.Mutex
+	sources map[string]SourceState
+}
+
+// stateFile is the content of the file with the state
+type stateFile struct {
+	Sources map[string]SourceState `json:"sources"`
+}
+
+// LoadState reads the state from the file, the state is empty if the file doesn't exist yet and
+// it is not persisted if the file is empty
+func LoadState(file string) (*State, error) {
+	state := &State{file: file, sources: make(map[string]SourceState)}
+	if file == "" {
+		return state, nil
+	}
+	content, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read watch state from file %s: %v", file, err)
+	}
+	var states stateFile
+	if err = json.Unmarshal(content, &states); err != nil {
+		return nil, fmt.Errorf("could not parse watch state from file %s: %v", file, err)
+	}
+	for id, sourceState := range states.Sources {
+		state.sources[id] = sourceState
+	}
+	return state, nil
+}
+
+// Get returns the state of the source
+func (s *State) Get(id string) SourceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sources[id]
+}
+
+// Set changes the state of the source, persisting the state in its file
+func (s *State) Set(id string, sourceState SourceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources[id] = sourceState
+	if s.file == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(stateFile{Sources: s.sources}, "", "  ")
+	if err != nil {
+		return err
+	}
+	// the state is written to a temporal file renamed afterwards so the file is never left half written
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write watch state to file %s: %v", s.file, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(append(content, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write watch state to file %s: %v", s.file, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("could not write watch state to file %s: %v", s.file, err)
+	}
+	if err = os.Rename(tmp.Name(), s.file); err != nil {
+		return fmt.Errorf("could not write watch state to file %s: %v", s.file, err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+)
+
+const (
+	// DefaultInterval is the time between the polls of the sources without interval
+	DefaultInterval = 5 * time.Minute
+	// requestTimeout is the maximum duration of the requests to the registries and chart repositories
+	requestTimeout = 30 * time.Second
+)
+
+// updateFunc updates the values of an application
+type updateFunc func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error)
+
+// readFunc reads the current values of the keys of an application
+type readFunc func(ctx context.Context, cfg updater.HelmUpdaterConfig, keys []string) (map[string]string, error)
+
+// versionsFunc lists the versions of a source
+type versionsFunc func(ctx context.Context, client *http.Client, source *Source) ([]string, error)
+
+// Config is the configuration of the watcher
+type Config struct {
+	// Base is the configuration of the updates, whose application, file and values are set from the sources
+	Base updater.HelmUpdaterConfig
+	// Dir is the directory of the git repository where the directories of the applications are located
+	Dir string
+	// Sources are the image repositories and Helm charts polled
+	Sources []Source
+	// Interval is the time between the polls of the sources without interval
+	Interval time.Duration
+	// Jitter is the maximum random delay added to the interval of each poll, so
+	// the sources polled with the same interval are not polled at the same time
+	Jitter time.Duration
+	// Client is the HTTP client of the registries and chart repositories
+	Client *http.Client
+}
+
+// Watcher polls the sources periodically, updating their keys when a newer version is found
+type Watcher struct {
+	cfg       Config
+	state     *State
+	syncState *updater.SyncIterationState
+	update    updateFunc
+	read      readFunc
+	images    versionsFunc
+	charts    versionsFunc
+	random    *rand.Rand
+}
+
+// New returns a watcher of the sources, whose state is kept in state
+func New(cfg Config, state *State) *Watcher {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: requestTimeout}
+	}
+	return &Watcher{
+		cfg:       cfg,
+		state:     state,
+		syncState: updater.NewSyncIterationState(),
+		update:    updater.UpdateApplication,
+		read:      updater.ReadValues,
+		images:    registryTags,
+		charts:    chartVersions,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Run polls every source when its interval since the last poll has elapsed, until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	next := make([]time.Time, len(w.cfg.Sources))
+	for i := range w.cfg.Sources {
+		next[i] = w.nextCheck(&w.cfg.Sources[i], w.state.Get(w.cfg.Sources[i].ID()).CheckedAt)
+	}
+
+	if len(next) == 0 {
+		<-ctx.Done()
+		return
+	}
+
+	for {
+		first := 0
+		for i := range next {
+			if next[i].Before(next[first]) {
+				first = i
+			}
+		}
+
+		timer := time.NewTimer(time.Until(next[first]))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		source := &w.cfg.Sources[first]
+		if err := w.Check(ctx, source); err != nil {
+			log.WithContext().AddField(log.FieldApplication, source.App).Errorf("Could not check %s: %v", source, err)
+		}
+		next[first] = w.nextCheck(source, time.Now())
+	}
+}
+
+// CheckAll polls every source once, returning the number of sources whose check failed
+func (w *Watcher) CheckAll(ctx context.Context) int {
+	failed := 0
+	for i := range w.cfg.Sources {
+		source := &w.cfg.Sources[i]
+		if err := w.Check(ctx, source); err != nil {
+			log.WithContext().AddField(log.FieldApplication, source.App).Errorf("Could not check %s: %v", source, err)
+			failed++
+		}
+	}
+	return failed
+}
+
+// nextCheck returns when the source has to be polled again after it was polled at checkedAt
+func (w *Watcher) nextCheck(source *Source, checkedAt time.Time) time.Time {
+	interval := source.Interval
+	if interval <= 0 {
+		interval = w.cfg.Interval
+	}
+	var jitter time.Duration
+	if w.cfg.Jitter > 0 {
+		jitter = time.Duration(w.random.Int63n(int64(w.cfg.Jitter)))
+	}
+	if checkedAt.IsZero() {
+		// the sources never polled are polled right away, spread over the jitter
+		return time.Now().Add(jitter)
+	}
+	return checkedAt.Add(interval + jitter)
+}
+
+// Check polls the source, updating its key if the newest eligible version is not the current value.
+// The key is not read again while the newest version is the one known to be set in the state
+func (w *Watcher) Check(ctx context.Context, source *Source) error {
+	ctx = log.ContextWithRunID(ctx, log.NewRunID())
+	logCtx := log.FromContext(ctx).AddField(log.FieldApplication, source.App)
+	id := source.ID()
+	sourceState := w.state.Get(id)
+	sourceState.CheckedAt = time.Now().UTC()
+
+	versions, err := w.versions(ctx, source)
+	if err != nil {
+		return err
+	}
+	newest := source.Newest(versions)
+	if newest == "" {
+		logCtx.Warnf("No eligible version of %s found", source)
+		return w.state.Set(id, sourceState)
+	}
+	if newest == sourceState.Version {
+		logCtx.Debugf("Version %s of %s is already set in key %s", newest, source, source.Key)
+		return w.state.Set(id, sourceState)
+	}
+
+	cfg := w.cfg.Base
+	cfg.AppName = source.App
+	cfg.File = path.Join(w.cfg.Dir, source.App, source.File)
+	values, err := w.read(ctx, cfg, []string{source.Key})
+	if err != nil {
+		return err
+	}
+	if values[source.Key] == newest {
+		logCtx.Infof("Version %s of %s is already set in key %s", newest, source, source.Key)
+		sourceState.Version = newest
+		return w.state.Set(id, sourceState)
+	}
+
+	logCtx.Infof("Updating key %s from %s to version %s of %s", source.Key, values[source.Key], newest, source)
+	cfg.UpdateApps = []updater.ChangeEntry{{Key: source.Key, NewValue: newest}}
+	if _, err = w.update(ctx, cfg, w.syncState); err != nil && !errors.Is(err, updater.ErrNothingToUpdate) {
+		return err
+	}
+	if !cfg.DryRun {
+		// a dry run doesn't set the version, so it is set again in the next poll
+		sourceState.Version = newest
+		updatedAt := sourceState.CheckedAt
+		sourceState.UpdatedAt = &updatedAt
+	}
+	return w.state.Set(id, sourceState)
+}
+
+// versions lists the versions of the source
+func (w *Watcher) versions(ctx context.Context, source *Source) ([]string, error) {
+	if source.Image != "" {
+		return w.images(ctx, w.cfg.Client, source)
+	}
+	if source.Chart != "" {
+		return w.charts(ctx, w.cfg.Client, source)
+	}
+	return nil, fmt.Errorf("source %s has no image nor chart", source.ID())
+}
@@ -0,0 +1,162 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/updater"
+	"gotest.tools/v3/assert"
+)
+
+// fakeRepository is a git repository stand-in keeping the values of the keys, recording the updates
+type fakeRepository struct {
+	mu      sync.Mutex
+	values  map[string]string
+	reads   int
+	updates []updater.HelmUpdaterConfig
+}
+
+func (r *fakeRepository) read(ctx context.Context, cfg updater.HelmUpdaterConfig, keys []string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	values := make(map[string]string)
+	for _, key := range keys {
+		values[key] = r.values[cfg.File+":"+key]
+	}
+	return values, nil
+}
+
+func (r *fakeRepository) update(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, cfg)
+	for _, change := range cfg.UpdateApps {
+		r.values[cfg.File+":"+change.Key] = change.NewValue
+	}
+	return &cfg.UpdateApps, nil
+}
+
+// newTestWatcher returns a watcher of an image whose tags are listed by tags, updating repository
+func newTestWatcher(t *testing.T, state *State, repository *fakeRepository, tags func() []string) *Watcher {
+	t.Helper()
+	w := New(Config{
+		Dir: "gitops",
+		Sources: []Source{
+			{Image: "ghcr.io/docplanner/example-app", App: "example-app", File: "values.yaml", Key: ".image.tag", Interval: 50 * time.Millisecond},
+		},
+		Jitter: 10 * time.Millisecond,
+	}, state)
+	w.read = repository.read
+	w.update = repository.update
+	w.images = func(ctx context.Context, client *http.Client, source *Source) ([]string, error) {
+		return tags(), nil
+	}
+	return w
+}
+
+func TestWatcherCheck(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadState(stateFile)
+	assert.NilError(t, err)
+	repository := &fakeRepository{values: map[string]string{"gitops/example-app/values.yaml:.image.tag": "1.0.0"}}
+	tags := []string{"1.0.0", "1.1.0", "latest"}
+	w := newTestWatcher(t, state, repository, func() []string { return tags })
+	source := &w.cfg.Sources[0]
+
+	// the newest version is set when it's not the current value
+	assert.NilError(t, w.Check(context.Background(), source))
+	assert.Equal(t, len(repository.updates), 1)
+	assert.Equal(t, repository.updates[0].AppName, "example-app")
+	assert.Equal(t, repository.updates[0].File, "gitops/example-app/values.yaml")
+	assert.DeepEqual(t, repository.updates[0].UpdateApps, []updater.ChangeEntry{{Key: ".image.tag", NewValue: "1.1.0"}})
+
+	// the key is not read again while there is no newer version, even after restarting the watcher
+	state, err = LoadState(stateFile)
+	assert.NilError(t, err)
+	assert.Equal(t, state.Get(source.ID()).Version, "1.1.0")
+	assert.Assert(t, state.Get(source.ID()).UpdatedAt != nil)
+	w = newTestWatcher(t, state, repository, func() []string { return tags })
+	assert.NilError(t, w.Check(context.Background(), source))
+	assert.Equal(t, repository.reads, 1)
+	assert.Equal(t, len(repository.updates), 1)
+
+	// the newer version already set by someone else is not updated
+	tags = append(tags, "1.2.0")
+	repository.values["gitops/example-app/values.yaml:.image.tag"] = "1.2.0"
+	assert.NilError(t, w.Check(context.Background(), source))
+	assert.Equal(t, repository.reads, 2)
+	assert.Equal(t, len(repository.updates), 1)
+	assert.Equal(t, state.Get(source.ID()).Version, "1.2.0")
+}
+
+func TestWatcherCheckFailed(t *testing.T) {
+	state, err := LoadState("")
+	assert.NilError(t, err)
+	repository := &fakeRepository{values: map[string]string{}}
+	w := newTestWatcher(t, state, repository, func() []string { return []string{"1.1.0"} })
+	w.update = func(ctx context.Context, cfg updater.HelmUpdaterConfig, state *updater.SyncIterationState) (*[]updater.ChangeEntry, error) {
+		return nil, errors.New("could not push changes")
+	}
+
+	// the version is not recorded so the update is retried in the next poll
+	assert.Equal(t, w.CheckAll(context.Background()), 1)
+	assert.Equal(t, state.Get(w.cfg.Sources[0].ID()).Version, "")
+	assert.Equal(t, w.CheckAll(context.Background()), 1)
+	assert.Equal(t, repository.reads, 2)
+}
+
+func TestWatcherRun(t *testing.T) {
+	state, err := LoadState("")
+	assert.NilError(t, err)
+	repository := &fakeRepository{values: map[string]string{}}
+	var mu sync.Mutex
+	tags := []string{"1.0.0"}
+	w := newTestWatcher(t, state, repository, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return tags
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the source is polled periodically, setting each new version once
+	waitValue(t, repository, "1.0.0")
+	mu.Lock()
+	tags = append(tags, "1.1.0")
+	mu.Unlock()
+	waitValue(t, repository, "1.1.0")
+	time.Sleep(150 * time.Millisecond)
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+	assert.Equal(t, len(repository.updates), 2)
+}
+
+// waitValue waits until the key of the source of the test watcher is set to the value
+func waitValue(t *testing.T, repository *fakeRepository, value string) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		repository.mu.Lock()
+		current := repository.values["gitops/example-app/values.yaml:.image.tag"]
+		repository.mu.Unlock()
+		if current == value {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("key was not set to %s", value)
+}
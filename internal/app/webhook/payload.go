@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DockerHub is the provider of the Docker Hub webhooks
+	DockerHub = "dockerhub"
+	// Harbor is the provider of the Harbor webhooks
+	Harbor = "harbor"
+	// GitHub is the provider of the GitHub package webhooks, sent for the GHCR images
+	GitHub = "github"
+	// OCI is the provider of the notifications of the OCI distribution registries
+	OCI = "oci"
+)
+
+// Event is the push of a tag of an image to a registry
+type Event struct {
+	// Repository is the repository of the image including the registry host, eg. ghcr.io/docplanner/example-app
+	Repository string
+	// Tag is the tag pushed
+	Tag string
+	// Digest is the digest of the manifest pushed, empty when the provider doesn't send it
+	Digest string
+	// Timestamp is when the push happened, zero when the provider doesn't send it, which is rejected as it
+	// can't be checked for replays
+	Timestamp time.Time
+}
+
+// parseFunc returns the events of the push of tags of a webhook payload, the rest of events are ignored
+type parseFunc func(header http.Header, body []byte) ([]Event, error)
+
+// parsers are the functions parsing the payloads of each provider
+var parsers = map[string]parseFunc{
+	DockerHub: parseDockerHub,
+	Harbor:    parseHarbor,
+	GitHub:    parseGitHub,
+	OCI:       parseOCI,
+}
+
+// dockerHubPayload is the payload of the Docker Hub webhooks
+type dockerHubPayload struct {
+	PushData struct {
+		Tag      string `json:"tag"`
+		PushedAt int64  `json:"pushed_at"`
+	} `json:"push_data"`
+	Repository struct {
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+}
+
+// parseDockerHub parses the Docker Hub webhooks, which are only sent for pushes and don't include the digest
+func parseDockerHub(header http.Header, body []byte) ([]Event, error) {
+	var payload dockerHubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Repository.RepoName == "" || payload.PushData.Tag == "" {
+		return nil, fmt.Errorf("repository and tag are required")
+	}
+	return []Event{{
+		Repository: "docker.io/" + payload.Repository.RepoName,
+		Tag:        payload.PushData.Tag,
+		Timestamp:  unixTime(payload.PushData.PushedAt),
+	}}, nil
+}
+
+// harborPayload is the payload of the Harbor webhooks
+type harborPayload struct {
+	Type      string `json:"type"`
+	OccurAt   int64  `json:"occur_at"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// parseHarbor parses the PUSH_ARTIFACT Harbor webhooks, where the registry host is taken from the url of the resources
+func parseHarbor(header http.Header, body []byte) ([]Event, error) {
+	var payload harborPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Type != "PUSH_ARTIFACT" {
+		return nil, nil
+	}
+	if payload.EventData.Repository.RepoFullName == "" {
+		return nil, fmt.Errorf("repository is required")
+	}
+
+	var events []Event
+	for _, resource := range payload.EventData.Resources {
+		if resource.Tag == "" {
+			continue
+		}
+		repository := payload.EventData.Repository.RepoFullName
+		if i := strings.Index(resource.ResourceURL, "/"); i > 0 {
+			repository = resource.ResourceURL[:i] + "/" + repository
+		}
+		events = append(events, Event{
+			Repository: repository,
+			Tag:        resource.Tag,
+			Digest:     resource.Digest,
+			Timestamp:  unixTime(payload.OccurAt),
+		})
+	}
+	return events, nil
+}
+
+// gitHubPackage is the package of the GitHub package and registry_package webhooks
+type gitHubPackage struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace"`
+	PackageType string `json:"package_type"`
+	Owner       struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	PackageVersion struct {
+		CreatedAt         string `json:"created_at"`
+		UpdatedAt         string `json:"updated_at"`
+		ContainerMetadata struct {
+			Tag struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"tag"`
+		} `json:"container_metadata"`
+	} `json:"package_version"`
+}
+
+// gitHubPayload is the payload of the GitHub package and registry_package webhooks
+type gitHubPayload struct {
+	Action          string         `json:"action"`
+	Package         *gitHubPackage `json:"package"`
+	RegistryPackage *gitHubPackage `json:"registry_package"`
+}
+
+// parseGitHub parses the webhooks of the container packages published to GHCR, the rest of
+// events, eg. the ping sent when the webhook is created, are ignored
+func parseGitHub(header http.Header, body []byte) ([]Event, error) {
+	event := header.Get("X-GitHub-Event")
+	if event != "package" && event != "registry_package" {
+		return nil, nil
+	}
+	var payload gitHubPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	pkg := payload.Package
+	if pkg == nil {
+		pkg = payload.RegistryPackage
+	}
+	if payload.Action != "published" || pkg == nil || !strings.EqualFold(pkg.PackageType, "container") {
+		return nil, nil
+	}
+
+	tag := pkg.PackageVersion.ContainerMetadata.Tag
+	if tag.Name == "" {
+		return nil, nil
+	}
+	owner := pkg.Namespace
+	if owner == "" {
+		owner = pkg.Owner.Login
+	}
+	if owner == "" || pkg.Name == "" {
+		return nil, fmt.Errorf("package owner and name are required")
+	}
+	timestamp := pkg.PackageVersion.UpdatedAt
+	if timestamp == "" {
+		timestamp = pkg.PackageVersion.CreatedAt
+	}
+	return []Event{{
+		Repository: strings.ToLower("ghcr.io/" + owner + "/" + pkg.Name),
+		Tag:        tag.Name,
+		Digest:     tag.Digest,
+		Timestamp:  parseTime(timestamp),
+	}}, nil
+}
+
+// ociPayload is the envelope of the notifications of the OCI distribution registries
+type ociPayload struct {
+	Events []struct {
+		Timestamp string `json:"timestamp"`
+		Action    string `json:"action"`
+		Target    struct {
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// parseOCI parses the notifications of the OCI distribution registries, where the registry host
+// is taken from the request which pushed the tag
+func parseOCI(header http.Header, body []byte) ([]Event, error) {
+	var payload ociPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, event := range payload.Events {
+		if event.Action != "push" || event.Target.Tag == "" {
+			continue
+		}
+		if event.Target.Repository == "" {
+			return nil, fmt.Errorf("repository is required")
+		}
+		repository := event.Target.Repository
+		if event.Request.Host != "" {
+			repository = event.Request.Host + "/" + repository
+		}
+		events = append(events, Event{
+			Repository: repository,
+			Tag:        event.Target.Tag,
+			Digest:     event.Target.Digest,
+			Timestamp:  parseTime(event.Timestamp),
+		})
+	}
+	return events, nil
+}
+
+// unixTime returns the time of a unix timestamp, or zero if it's not set
+func unixTime(timestamp int64) time.Time {
+	if timestamp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(timestamp, 0)
+}
+
+// parseTime returns the time of a RFC3339 timestamp, or zero if it's not valid
+func parseTime(timestamp string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const (
+	dockerHubPayloadPush = `{
+  "callback_url": "https://registry.hub.docker.com/u/docplanner/example-app/hook/1/",
+  "push_data": {"pushed_at": 1700000000, "pusher": "docplanner", "tag": "1.1.0"},
+  "repository": {"name": "example-app", "namespace": "docplanner", "repo_name": "docplanner/example-app"}
+}`
+	harborPayloadPush = `{
+  "type": "PUSH_ARTIFACT",
+  "occur_at": 1700000000,
+  "operator": "admin",
+  "event_data": {
+    "resources": [
+      {"digest": "sha256:4c9ba4a0", "tag": "1.1.0", "resource_url": "harbor.example.com/docplanner/example-app:1.1.0"},
+      {"digest": "sha256:4c9ba4a0", "tag": "", "resource_url": "harbor.example.com/docplanner/example-app@sha256:4c9ba4a0"}
+    ],
+    "repository": {"name": "example-app", "namespace": "docplanner", "repo_full_name": "docplanner/example-app", "repo_type": "private"}
+  }
+}`
+	gitHubPayloadPublished = `{
+  "action": "published",
+  "package": {
+    "name": "Example-App",
+    "namespace": "DocPlanner",
+    "package_type": "CONTAINER",
+    "package_version": {
+      "version": "sha256:4c9ba4a0",
+      "created_at": "2023-11-14T22:13:20Z",
+      "container_metadata": {"tag": {"name": "1.1.0", "digest": "sha256:4c9ba4a0"}}
+    }
+  }
+}`
+	ociPayloadPush = `{
+  "events": [
+    {
+      "id": "320678d8-ca14-430f-8bb6-4ca139cd83f7",
+      "timestamp": "2023-11-14T22:13:20.402973972Z",
+      "action": "push",
+      "target": {"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": "sha256:4c9ba4a0", "repository": "docplanner/example-app", "tag": "1.1.0"},
+      "request": {"host": "registry.example.com", "method": "PUT"}
+    },
+    {
+      "id": "6b7ca3b4-1c5b-4c2c-9a2e-4ab6b6ad1d2c",
+      "timestamp": "2023-11-14T22:13:20.402973972Z",
+      "action": "pull",
+      "target": {"digest": "sha256:4c9ba4a0", "repository": "docplanner/example-app", "tag": "1.1.0"},
+      "request": {"host": "registry.example.com", "method": "GET"}
+    }
+  ]
+}`
+)
+
+// pushTimestamp is the time of the pushes of the payloads
+var pushTimestamp = time.Unix(1700000000, 0)
+
+func TestParsePayloads(t *testing.T) {
+	tests := map[string]struct {
+		provider string
+		header   http.Header
+		payload  string
+		events   []Event
+		error    string
+	}{
+		"dockerhub": {
+			provider: DockerHub,
+			payload:  dockerHubPayloadPush,
+			events:   []Event{{Repository: "docker.io/docplanner/example-app", Tag: "1.1.0", Timestamp: pushTimestamp}},
+		},
+		"dockerhub without tag": {
+			provider: DockerHub,
+			payload:  `{"repository": {"repo_name": "docplanner/example-app"}}`,
+			error:    "repository and tag are required",
+		},
+		"harbor": {
+			provider: Harbor,
+			payload:  harborPayloadPush,
+			events:   []Event{{Repository: "harbor.example.com/docplanner/example-app", Tag: "1.1.0", Digest: "sha256:4c9ba4a0", Timestamp: pushTimestamp}},
+		},
+		"harbor other event": {
+			provider: Harbor,
+			payload:  `{"type": "DELETE_ARTIFACT", "occur_at": 1700000000}`,
+		},
+		"github": {
+			provider: GitHub,
+			header:   http.Header{"X-Github-Event": []string{"package"}},
+			payload:  gitHubPayloadPublished,
+			events:   []Event{{Repository: "ghcr.io/docplanner/example-app", Tag: "1.1.0", Digest: "sha256:4c9ba4a0", Timestamp: pushTimestamp.UTC()}},
+		},
+		"github ping": {
+			provider: GitHub,
+			header:   http.Header{"X-Github-Event": []string{"ping"}},
+			payload:  `{"zen": "Keep it logically awesome."}`,
+		},
+		"oci": {
+			provider: OCI,
+			payload:  ociPayloadPush,
+			events: []Event{{
+				Repository: "registry.example.com/docplanner/example-app",
+				Tag:        "1.1.0",
+				Digest:     "sha256:4c9ba4a0",
+				Timestamp:  time.Date(2023, 11, 14, 22, 13, 20, 402973972, time.UTC),
+			}},
+		},
+		"invalid json": {
+			provider: OCI,
+			payload:  `{"events":`,
+			error:    "unexpected end of JSON input",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			header := test.header
+			if header == nil {
+				header = http.Header{}
+			}
+			events, err := parsers[test.provider](header, []byte(test.payload))
+			if test.error != "" {
+				assert.ErrorContains(t, err, test.error)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, len(events), len(test.events))
+			for i := range events {
+				assert.Equal(t, events[i].Repository, test.events[i].Repository)
+				assert.Equal(t, events[i].Tag, test.events[i].Tag)
+				assert.Equal(t, events[i].Digest, test.events[i].Digest)
+				assert.Assert(t, events[i].Timestamp.Equal(test.events[i].Timestamp), events[i].Timestamp)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/server"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ValueTag sets the key to the tag pushed
+	ValueTag = "tag"
+	// ValueDigest sets the key to the digest of the manifest pushed
+	ValueDigest = "digest"
+)
+
+// Rule maps the pushes of the tags of a repository to the key of the values of an application
+type Rule struct {
+	// Repository is the repository of the image, which can be a glob pattern eg. ghcr.io/docplanner/*
+	Repository string `yaml:"repository"`
+	// Tag is a regular expression the tags pushed must match, every tag matches if empty
+	Tag string `yaml:"tag"`
+	// App is the name of the application updated
+	App string `yaml:"app"`
+	// File is the location of the values file inside the directory of the application
+	File string `yaml:"file"`
+	// Key is the key of the values file updated, eg. .image.tag
+	Key string `yaml:"key"`
+	// Value is what the key is set to, one of tag|digest (default is tag)
+	Value string `yaml:"value"`
+
+	tag *regexp.Regexp
+}
+
+// rulesFile is the content of the file with the rules
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadRules reads the rules from a YAML file
+func LoadRules(file string) ([]Rule, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read webhook rules from file %s: %v", file, err)
+	}
+	var rules rulesFile
+	if err = yaml.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("could not parse webhook rules from file %s: %v", file, err)
+	}
+	for i := range rules.Rules {
+		if err = rules.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid webhook rule %d of file %s: %v", i+1, file, err)
+		}
+	}
+	return rules.Rules, nil
+}
+
+// compile checks the rule is valid, compiling its tag regular expression
+func (r *Rule) compile() error {
+	if r.Repository == "" || r.App == "" || r.File == "" || r.Key == "" {
+		return fmt.Errorf("repository, app, file and key are required")
+	}
+	if _, err := path.Match(r.Repository, ""); err != nil {
+		return fmt.Errorf("invalid repository pattern %s: %v", r.Repository, err)
+	}
+	switch r.Value {
+	case "":
+		r.Value = ValueTag
+	case ValueTag, ValueDigest:
+	default:
+		return fmt.Errorf("invalid value %s, it must be one of %s|%s", r.Value, ValueTag, ValueDigest)
+	}
+	if r.Tag != "" {
+		tag, err := regexp.Compile(r.Tag)
+		if err != nil {
+			return fmt.Errorf("invalid tag regular expression %s: %v", r.Tag, err)
+		}
+		r.tag = tag
+	}
+	return nil
+}
+
+// match checks if the push of the event must update the key of the rule
+func (r *Rule) match(event Event) bool {
+	if matched, _ := path.Match(r.Repository, event.Repository); !matched {
+		return false
+	}
+	return r.tag == nil || r.tag.MatchString(event.Tag)
+}
+
+// value returns what the key of the rule is set to for the event
+func (r *Rule) value(event Event) string {
+	if r.Value == ValueDigest {
+		return event.Digest
+	}
+	return event.Tag
+}
+
+// updateRequests returns the updates of the keys of the rules matching the events, grouped by
+// application and file so each of them is updated in a single commit
+func updateRequests(rules []Rule, events []Event) []server.UpdateRequest {
+	var requests []server.UpdateRequest
+	index := make(map[string]int)
+	for _, event := range events {
+		for i := range rules {
+			rule := &rules[i]
+			value := rule.value(event)
+			if !rule.match(event) || value == "" {
+				continue
+			}
+			id := rule.App + "/" + rule.File
+			if _, found := index[id]; !found {
+				index[id] = len(requests)
+				requests = append(requests, server.UpdateRequest{
+					App:    rule.App,
+					File:   rule.File,
+					Values: make(map[string]string),
+				})
+			}
+			requests[index[id]].Values[rule.Key] = value
+		}
+	}
+	return requests
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/server"
+	"gotest.tools/v3/assert"
+)
+
+// writeRules writes the rules to a file, returning its location
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NilError(t, os.WriteFile(file, []byte(content), 0600))
+	return file
+}
+
+func TestLoadRules(t *testing.T) {
+	file := writeRules(t, `
+rules:
+  - repository: ghcr.io/docplanner/*
+    tag: '^\d+\.\d+\.\d+$'
+    app: example-app
+    file: values.yaml
+    key: .image.tag
+  - repository: ghcr.io/docplanner/example-app
+    app: example-app
+    file: values.yaml
+    key: .image.digest
+    value: digest
+`)
+	rules, err := LoadRules(file)
+	assert.NilError(t, err)
+	assert.Equal(t, len(rules), 2)
+	assert.Equal(t, rules[0].Value, ValueTag)
+	assert.Equal(t, rules[1].Value, ValueDigest)
+
+	event := Event{Repository: "ghcr.io/docplanner/example-app", Tag: "1.1.0", Digest: "sha256:4c9ba4a0"}
+	assert.Assert(t, rules[0].match(event))
+	assert.Assert(t, !rules[0].match(Event{Repository: "ghcr.io/docplanner/example-app", Tag: "latest"}))
+	assert.Assert(t, !rules[0].match(Event{Repository: "ghcr.io/other/example-app", Tag: "1.1.0"}))
+
+	requests := updateRequests(rules, []Event{event})
+	assert.DeepEqual(t, requests, []server.UpdateRequest{{
+		App:    "example-app",
+		File:   "values.yaml",
+		Values: map[string]string{".image.tag": "1.1.0", ".image.digest": "sha256:4c9ba4a0"},
+	}})
+}
+
+func TestLoadRulesInvalid(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		error   string
+	}{
+		"missing key": {
+			content: "rules:\n  - repository: ghcr.io/docplanner/example-app\n    app: example-app\n    file: values.yaml\n",
+			error:   "invalid webhook rule 1",
+		},
+		"invalid value": {
+			content: "rules:\n  - repository: ghcr.io/docplanner/example-app\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n    value: name\n",
+			error:   "invalid value name, it must be one of tag|digest",
+		},
+		"invalid tag": {
+			content: "rules:\n  - repository: ghcr.io/docplanner/example-app\n    tag: '('\n    app: example-app\n    file: values.yaml\n    key: .image.tag\n",
+			error:   "invalid tag regular expression",
+		},
+		"invalid yaml": {
+			content: "rules: [",
+			error:   "could not parse webhook rules",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadRules(writeRules(t, test.content))
+			assert.ErrorContains(t, err, test.error)
+		})
+	}
+}
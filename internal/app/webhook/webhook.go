@@ -0,0 +1,237 @@
+// Package webhook receives the webhooks sent by the registries when an image is pushed, updating
+// the keys of the applications mapped to the repository of the image by the rules.
+//
+// The payloads must be signed with HMAC-SHA256 using a shared secret, as GitHub does, and the
+// deliveries already received, too old or without the time of the push are rejected, so they
+// can't be replayed.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/log"
+	"github.com/docplanner/helm-repo-updater/internal/app/server"
+	"github.com/docplanner/helm-repo-updater/internal/app/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Path is the path where the webhooks are received, followed by the provider, eg. /v1/webhooks/harbor
+	Path = "/v1/webhooks/"
+	// SignatureHeader is the header with the HMAC-SHA256 signature of the payload, as sha256=<hex>
+	SignatureHeader = "X-Hub-Signature-256"
+	// DeliveryHeader is the header with the identifier of the delivery, the hash of the payload is always used too
+	DeliveryHeader = "X-Delivery-Id"
+	// DefaultMaxAge is the default maximum age of the deliveries accepted
+	DefaultMaxAge = 5 * time.Minute
+	// maxPayloadSize is the maximum size of the payloads
+	maxPayloadSize = 1 << 20
+)
+
+// deliveryHeaders are the headers where the providers send the identifier of the delivery
+var deliveryHeaders = []string{DeliveryHeader, "X-GitHub-Delivery"}
+
+// Enqueuer queues the updates requested by the webhooks, continuing the trace of ctx
+type Enqueuer interface {
+	Enqueue(ctx context.Context, request server.UpdateRequest) (server.Job, error)
+}
+
+// Config is the configuration of the webhooks receiver
+type Config struct {
+	// Rules map the images pushed to the keys updated
+	Rules []Rule
+	// Secret is the key of the HMAC-SHA256 signatures of the payloads
+	Secret []byte
+	// MaxAge is the maximum age of the deliveries, older ones are rejected as replayed
+	MaxAge time.Duration
+}
+
+// Handler receives the webhooks of the registries
+type Handler struct {
+	cfg      Config
+	enqueuer Enqueuer
+	now      func() time.Time
+
+	mu sync.Mutex
+	// deliveries are the identifiers of the deliveries received during the last MaxAge, with the time they were received
+	deliveries map[string]time.Time
+}
+
+// NewHandler returns a handler queueing the updates of the webhooks received in enqueuer
+func NewHandler(cfg Config, enqueuer Enqueuer) *Handler {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultMaxAge
+	}
+	return &Handler{
+		cfg:        cfg,
+		enqueuer:   enqueuer,
+		now:        time.Now,
+		deliveries: make(map[string]time.Time),
+	}
+}
+
+// response is the body of the responses of the webhooks
+type response struct {
+	Jobs  []string `json:"jobs"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ServeHTTP receives a webhook, whose provider is the last element of the path
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeResponse(w, http.StatusMethodNotAllowed, response{Error: "method not allowed"})
+		return
+	}
+	provider := strings.TrimPrefix(r.URL.Path, Path)
+	parse, found := parsers[provider]
+	if !found {
+		writeResponse(w, http.StatusNotFound, response{Error: fmt.Sprintf("unknown provider %s", provider)})
+		return
+	}
+	logCtx := log.WithContext().AddField("provider", provider)
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{Error: fmt.Sprintf("could not read payload: %v", err)})
+		return
+	}
+	if !h.validSignature(r.Header.Get(SignatureHeader), body) {
+		logCtx.Warnf("Rejected webhook with invalid signature")
+		writeResponse(w, http.StatusUnauthorized, response{Error: "invalid or missing payload signature"})
+		return
+	}
+
+	events, err := parse(r.Header, body)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{Error: fmt.Sprintf("invalid payload: %v", err)})
+		return
+	}
+	deliveries := deliveryIDs(r.Header, body)
+	delivery := deliveries[0]
+	if err = h.checkReplay(deliveries, events); err != nil {
+		logCtx.Warnf("Rejected webhook delivery %s: %v", delivery, err)
+		writeResponse(w, http.StatusConflict, response{Error: err.Error()})
+		return
+	}
+
+	ctx, span := tracing.StartWithKind(propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header)), "POST "+Path+provider, trace.SpanKindServer,
+		attribute.String("delivery", delivery))
+	defer span.End()
+	jobs := []string{}
+	for _, request := range updateRequests(h.cfg.Rules, events) {
+		job, err := h.enqueuer.Enqueue(ctx, request)
+		if err != nil {
+			// the delivery can be retried, the updates already queued are skipped as nothing to update
+			h.forget(deliveries)
+			logCtx.Errorf("Could not queue update of application %s: %v", request.App, err)
+			writeResponse(w, http.StatusServiceUnavailable, response{Jobs: jobs, Error: err.Error()})
+			return
+		}
+		jobs = append(jobs, job.ID)
+	}
+
+	for _, event := range events {
+		logCtx.Infof("Received push of %s:%s", event.Repository, event.Tag)
+	}
+	if len(jobs) == 0 {
+		writeResponse(w, http.StatusOK, response{Jobs: jobs})
+		return
+	}
+	writeResponse(w, http.StatusAccepted, response{Jobs: jobs})
+}
+
+// validSignature checks the signature is the HMAC-SHA256 of the payload
+func (h *Handler) validSignature(signature string, body []byte) bool {
+	if len(h.cfg.Secret) == 0 || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(received, Sign(h.cfg.Secret, body))
+}
+
+// checkReplay rejects the deliveries already received, identified by any of their ids, or whose
+// events have no timestamp or are older than MaxAge, so an old payload can't be sent again once
+// its delivery has been forgotten
+func (h *Handler) checkReplay(ids []string, events []Event) error {
+	now := h.now()
+	for _, event := range events {
+		if event.Timestamp.IsZero() {
+			return fmt.Errorf("push of %s:%s has no timestamp, it can't be checked for replays", event.Repository, event.Tag)
+		}
+		if age := now.Sub(event.Timestamp); age > h.cfg.MaxAge || age < -h.cfg.MaxAge {
+			return fmt.Errorf("push of %s:%s at %s is outside the accepted window of %s", event.Repository, event.Tag, event.Timestamp.Format(time.RFC3339), h.cfg.MaxAge)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, received := range h.deliveries {
+		if now.Sub(received) > h.cfg.MaxAge {
+			delete(h.deliveries, id)
+		}
+	}
+	for _, id := range ids {
+		if _, found := h.deliveries[id]; found {
+			return fmt.Errorf("delivery %s already received", id)
+		}
+	}
+	for _, id := range ids {
+		h.deliveries[id] = now
+	}
+	return nil
+}
+
+// forget removes the ids of a delivery from the ones received, so it can be retried
+func (h *Handler) forget(ids []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range ids {
+		delete(h.deliveries, id)
+	}
+}
+
+// deliveryIDs returns the identifiers of a delivery: the one sent by the provider, if any, and always
+// the hash of the payload, so the same payload can't be sent again with another identifier
+func deliveryIDs(header http.Header, body []byte) []string {
+	var ids []string
+	for _, name := range deliveryHeaders {
+		if id := header.Get(name); id != "" {
+			ids = append(ids, id)
+			break
+		}
+	}
+	hash := sha256.Sum256(body)
+	return append(ids, hex.EncodeToString(hash[:]))
+}
+
+// Sign returns the HMAC-SHA256 signature of the payload
+func Sign(secret, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// writeResponse writes the JSON body of the response
+func writeResponse(w http.ResponseWriter, statusCode int, body response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("could not write response: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package webhook
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docplanner/helm-repo-updater/internal/app/server"
+	"gotest.tools/v3/assert"
+)
+
+const validSecret = "test-secret"
+
+// fakeEnqueuer records the updates requested, failing when full
+type fakeEnqueuer struct {
+	requests []server.UpdateRequest
+	full     bool
+}
+
+func (e *fakeEnqueuer) Enqueue(_ context.Context, request server.UpdateRequest) (server.Job, error) {
+	if e.full {
+		return server.Job{}, server.ErrQueueFull
+	}
+	e.requests = append(e.requests, request)
+	return server.Job{ID: request.App + "-job", Request: request}, nil
+}
+
+// newTestHandler returns a handler with rules for the example-app images, at the time of the pushes of the payloads
+func newTestHandler(t *testing.T, enqueuer Enqueuer) *Handler {
+	t.Helper()
+	rules, err := LoadRules(writeRules(t, `
+rules:
+  - repository: '*/docplanner/example-app'
+    tag: '^\d+\.\d+\.\d+$'
+    app: example-app
+    file: values.yaml
+    key: .image.tag
+`))
+	assert.NilError(t, err)
+	h := NewHandler(Config{Rules: rules, Secret: []byte(validSecret)}, enqueuer)
+	h.now = func() time.Time { return pushTimestamp.Add(time.Minute) }
+	return h
+}
+
+// sendWebhook sends the payload signed with secret to the handler
+func sendWebhook(t *testing.T, h http.Handler, provider, payload, secret string, header http.Header) (*httptest.ResponseRecorder, response) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, Path+provider, strings.NewReader(payload))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(Sign([]byte(secret), []byte(payload))))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var body response
+	assert.NilError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return rec, body
+}
+
+func TestWebhookProviders(t *testing.T) {
+	tests := map[string]struct {
+		provider string
+		header   http.Header
+		payload  string
+	}{
+		"dockerhub": {provider: DockerHub, payload: dockerHubPayloadPush},
+		"harbor":    {provider: Harbor, payload: harborPayloadPush},
+		"github":    {provider: GitHub, payload: gitHubPayloadPublished, header: http.Header{"X-Github-Event": []string{"package"}}},
+		"oci":       {provider: OCI, payload: ociPayloadPush},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			enqueuer := &fakeEnqueuer{}
+			rec, body := sendWebhook(t, newTestHandler(t, enqueuer), test.provider, test.payload, validSecret, test.header)
+			assert.Equal(t, rec.Code, http.StatusAccepted, body.Error)
+			assert.DeepEqual(t, body.Jobs, []string{"example-app-job"})
+			assert.DeepEqual(t, enqueuer.requests, []server.UpdateRequest{{
+				App:    "example-app",
+				File:   "values.yaml",
+				Values: map[string]string{".image.tag": "1.1.0"},
+			}})
+		})
+	}
+}
+
+func TestWebhookNoRuleMatched(t *testing.T) {
+	enqueuer := &fakeEnqueuer{}
+	payload := strings.Replace(dockerHubPayloadPush, `"tag": "1.1.0"`, `"tag": "latest"`, 1)
+	rec, body := sendWebhook(t, newTestHandler(t, enqueuer), DockerHub, payload, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusOK)
+	assert.DeepEqual(t, body.Jobs, []string{})
+	assert.Equal(t, len(enqueuer.requests), 0)
+}
+
+func TestWebhookInvalidSignature(t *testing.T) {
+	for name, secret := range map[string]string{"missing": "", "invalid": "other-secret"} {
+		t.Run(name, func(t *testing.T) {
+			enqueuer := &fakeEnqueuer{}
+			rec, body := sendWebhook(t, newTestHandler(t, enqueuer), DockerHub, dockerHubPayloadPush, secret, nil)
+			assert.Equal(t, rec.Code, http.StatusUnauthorized)
+			assert.Equal(t, body.Error, "invalid or missing payload signature")
+			assert.Equal(t, len(enqueuer.requests), 0)
+		})
+	}
+}
+
+func TestWebhookReplay(t *testing.T) {
+	enqueuer := &fakeEnqueuer{}
+	h := newTestHandler(t, enqueuer)
+
+	rec, _ := sendWebhook(t, h, DockerHub, dockerHubPayloadPush, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+	rec, body := sendWebhook(t, h, DockerHub, dockerHubPayloadPush, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Assert(t, strings.Contains(body.Error, "already received"), body.Error)
+
+	// the deliveries are identified by the header of the provider when sent
+	header := http.Header{"X-Github-Event": []string{"package"}, "X-Github-Delivery": []string{"72d3162e-cc78-11e3-81ab-4c9367dc0958"}}
+	rec, _ = sendWebhook(t, h, GitHub, gitHubPayloadPublished, validSecret, header)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+	payload := strings.Replace(gitHubPayloadPublished, `"1.1.0"`, `"1.2.0"`, 1)
+	rec, _ = sendWebhook(t, h, GitHub, payload, validSecret, header)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+
+	// once forgotten, the old deliveries are rejected by the time of the push
+	h.now = func() time.Time { return pushTimestamp.Add(time.Hour) }
+	rec, body = sendWebhook(t, h, DockerHub, dockerHubPayloadPush, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Assert(t, strings.Contains(body.Error, "outside the accepted window"), body.Error)
+	assert.Equal(t, len(enqueuer.requests), 2)
+}
+
+func TestWebhookReplayOtherDelivery(t *testing.T) {
+	enqueuer := &fakeEnqueuer{}
+	h := newTestHandler(t, enqueuer)
+
+	header := http.Header{"X-Github-Event": []string{"package"}, "X-Github-Delivery": []string{"72d3162e-cc78-11e3-81ab-4c9367dc0958"}}
+	rec, _ := sendWebhook(t, h, GitHub, gitHubPayloadPublished, validSecret, header)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+
+	// the same payload is identified by its hash whatever the identifier of the delivery
+	header.Set("X-Github-Delivery", "0a4e1f5a-cc79-11e3-81ab-4c9367dc0958")
+	rec, body := sendWebhook(t, h, GitHub, gitHubPayloadPublished, validSecret, header)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Assert(t, strings.Contains(body.Error, "already received"), body.Error)
+	rec, _ = sendWebhook(t, h, GitHub, gitHubPayloadPublished, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Equal(t, len(enqueuer.requests), 1)
+}
+
+func TestWebhookReplayNoTimestamp(t *testing.T) {
+	enqueuer := &fakeEnqueuer{}
+	h := newTestHandler(t, enqueuer)
+	payload := strings.Replace(dockerHubPayloadPush, `"pushed_at": 1700000000, `, "", 1)
+
+	rec, body := sendWebhook(t, h, DockerHub, payload, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Assert(t, strings.Contains(body.Error, "has no timestamp"), body.Error)
+
+	// the payload is rejected too once its delivery would have been forgotten
+	h.now = func() time.Time { return pushTimestamp.Add(time.Hour) }
+	rec, body = sendWebhook(t, h, DockerHub, payload, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusConflict)
+	assert.Assert(t, strings.Contains(body.Error, "has no timestamp"), body.Error)
+	assert.Equal(t, len(enqueuer.requests), 0)
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	enqueuer := &fakeEnqueuer{full: true}
+	h := newTestHandler(t, enqueuer)
+
+	rec, body := sendWebhook(t, h, DockerHub, dockerHubPayloadPush, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusServiceUnavailable)
+	assert.Equal(t, body.Error, server.ErrQueueFull.Error())
+
+	// the delivery can be retried
+	enqueuer.full = false
+	rec, _ = sendWebhook(t, h, DockerHub, dockerHubPayloadPush, validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+}
+
+func TestWebhookUnknownProvider(t *testing.T) {
+	rec, body := sendWebhook(t, newTestHandler(t, &fakeEnqueuer{}), "quay", "{}", validSecret, nil)
+	assert.Equal(t, rec.Code, http.StatusNotFound)
+	assert.Equal(t, body.Error, "unknown provider quay")
+}
@@ -1,19 +1,31 @@
 package yq
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/mikefarah/yq/v4/pkg/yqlib"
-	"github.com/pkg/errors"
+	pkgerrors "github.com/pkg/errors"
 	"gopkg.in/op/go-logging.v1"
 	"gopkg.in/yaml.v3"
 )
 
 const outputFormat = "yaml"
 
-var completedSuccessfully = false
+// yqDocSeparator is the marker used by yqlib to identify document separators in the leading content
+const yqDocSeparator = "$yqDocSeperator$"
+
+var commentLineRegEx = regexp.MustCompile(`^\s*#`)
+
+// keyRegEx matches the keys which are a plain path of map keys and array indexes, eg. .image.tag or
+// .containers[0].image, so they can't add other operations to the yq expressions built with them
+var keyRegEx = regexp.MustCompile(`^\.[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+|\[[0-9]+\])*$`)
 
 // readFile takes a filepath and returns the byte value of the data within
 func readFile(filePath string) ([]byte, error) {
@@ -54,12 +66,17 @@ func disableYqlibLogging() {
 
 // QueryFile get result of apply query to yaml file
 func QueryFile(expression, filePath string) (interface{}, error) {
-	disableYqlibLogging()
 	b, err := readFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-	node, err := getYamlNode(b)
+	return QueryBytes(expression, b)
+}
+
+// QueryBytes get result of apply query to yaml content
+func QueryBytes(expression string, content []byte) (interface{}, error) {
+	disableYqlibLogging()
+	node, err := getYamlNode(content)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +92,7 @@ func QueryFile(expression, filePath string) (interface{}, error) {
 	}
 	// should only match a single node
 	if len(nodes) != 1 {
-		return nil, errors.Errorf("returned non singular result for yq expression: '%s'", expression)
+		return nil, pkgerrors.Errorf("returned non singular result for yq expression: '%s'", expression)
 	}
 
 	var result interface{}
@@ -85,49 +102,132 @@ func QueryFile(expression, filePath string) (interface{}, error) {
 	return result, nil
 }
 
-// InplaceApply applies the yq expression to the given file
-func InplaceApply(key, value string, targetFile string) error {
+// splitLeadingContent separates the comments and document separators present at the
+// beginning of the yaml content, which are lost by the yaml decoder, from the rest of content
+func splitLeadingContent(reader *bufio.Reader) (io.Reader, string, error) {
+	var sb strings.Builder
+	for {
+		peekBytes, err := reader.Peek(3)
+		if errors.Is(err, io.EOF) {
+			return reader, sb.String(), nil
+		} else if err != nil {
+			return reader, sb.String(), err
+		} else if string(peekBytes) == "---" {
+			_, err := reader.ReadString('\n')
+			sb.WriteString(yqDocSeparator + "\n")
+			if errors.Is(err, io.EOF) {
+				return reader, sb.String(), nil
+			} else if err != nil {
+				return reader, sb.String(), err
+			}
+		} else if commentLineRegEx.MatchString(string(peekBytes)) {
+			line, err := reader.ReadString('\n')
+			sb.WriteString(line)
+			if errors.Is(err, io.EOF) {
+				return reader, sb.String(), nil
+			} else if err != nil {
+				return reader, sb.String(), err
+			}
+		} else {
+			return reader, sb.String(), nil
+		}
+	}
+}
+
+// ValidateKey checks the key is a plain path of map keys and array indexes, eg. .image.tag
+func ValidateKey(key string) error {
 	if !strings.HasPrefix(key, ".") {
 		return fmt.Errorf("key %s doesn't start with '.'", key)
 	}
+	if !keyRegEx.MatchString(key) {
+		return fmt.Errorf("key %s must be a path of keys and indexes, eg. .image.tag or .containers[0].image", key)
+	}
+	return nil
+}
 
-	expression := fmt.Sprintf("%s=\"%s\"", key, value)
-	writeInPlaceHandler := yqlib.NewWriteInPlaceHandler(targetFile)
-	out, err := writeInPlaceHandler.CreateTempFile()
+// assignment parses the yq expression setting the key to the string value. The value is set in the
+// parsed expression instead of being written in it, so it's never evaluated as part of the expression
+func assignment(key, value string) (*yqlib.ExpressionNode, error) {
+	node, err := yqlib.NewExpressionParser().ParseExpression(key + ` = ""`)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if node.Operation.OperationType.Type != "ASSIGN" || node.Rhs == nil || node.Rhs.Operation.CandidateNode == nil {
+		return nil, fmt.Errorf("could not parse the assignment of key %s", key)
+	}
+	operation := node.Rhs.Operation
+	operation.Value, operation.StringValue = value, value
+	operation.CandidateNode.Node.Value = value
+	return node, nil
+}
+
+// Apply applies the yq expression setting the key to value in the given
+// yaml content and returns the resulting content
+func Apply(key, value string, content []byte) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	disableYqlibLogging()
+
+	node, err := assignment(key, value)
+	if err != nil {
+		return nil, err
 	}
-	// need to indirectly call the function so  that completedSuccessfully is
-	// passed when we finish execution as opposed to now
-	defer func() { writeInPlaceHandler.FinishWriteInPlace(completedSuccessfully) }()
 
 	format, err := yqlib.OutputFormatFromString(outputFormat)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	printer := yqlib.NewPrinterWithSingleWriter(&out, format, true, false, 2, true)
+	reader, leadingContent, err := splitLeadingContent(bufio.NewReader(bytes.NewReader(content)))
+	if err != nil {
+		return nil, err
 	}
 
-	printerWriter := yqlib.NewSinglePrinterWriter(out)
-	printer := yqlib.NewPrinter(printerWriter, format, true, false, 2, true)
 	streamEvaluator := yqlib.NewStreamEvaluator()
-	targetFiles := []string{
-		targetFile,
+	processedDocs, err := streamEvaluator.Evaluate("", reader, node, printer, leadingContent)
+	if err != nil {
+		return nil, err
+	}
+	if processedDocs == 0 {
+		// the key is created in a new document when the content is empty
+		if _, err = streamEvaluator.Evaluate("", strings.NewReader("null"), node, printer, leadingContent); err != nil {
+			return nil, err
+		}
 	}
-	err = streamEvaluator.EvaluateFiles(expression, targetFiles, printer, true)
-	completedSuccessfully = err == nil
 
-	return err
+	return out.Bytes(), nil
 }
 
 // ReadKey reads the value of the given key from the given file
 func ReadKey(key string, targetFile string) (*string, error) {
-	if !strings.HasPrefix(key, ".") {
-		return nil, fmt.Errorf("key %s doesn't start with '.'", key)
+	if err := ValidateKey(key); err != nil {
+		return nil, err
 	}
 	query, err := QueryFile(key, targetFile)
 	if err != nil {
 		return nil, err
 	}
+	return formatKeyValue(query), nil
+}
+
+// ReadKeyFromBytes reads the value of the given key from the given yaml content
+func ReadKeyFromBytes(key string, content []byte) (*string, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	query, err := QueryBytes(key, content)
+	if err != nil {
+		return nil, err
+	}
+	return formatKeyValue(query), nil
+}
+
+// formatKeyValue returns the string representation of a value obtained with a query
+func formatKeyValue(query interface{}) *string {
 	str := fmt.Sprintf("%v", query)
 	keyValue := strings.TrimSpace(str)
-	return &keyValue, nil
+	return &keyValue
 }
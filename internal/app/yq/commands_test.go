@@ -77,7 +77,7 @@ func TestQueryFileIncorrectFile(t *testing.T) {
 	assert.Error(t, err, expectedErrorMessage)
 }
 
-func TestInplaceApplyInvalidKey(t *testing.T) {
+func TestReadKey(t *testing.T) {
 	yamlFile, err := writeSimpleYamlInTempFile()
 
 	if err != nil {
@@ -86,18 +86,37 @@ func TestInplaceApplyInvalidKey(t *testing.T) {
 
 	defer os.Remove(*yamlFile)
 
-	value := "Saga"
-	err = InplaceApply(invalidKey, value, *yamlFile)
+	expectedKeyValue := "Sagar"
+
+	keyValue, err := ReadKey(validKey, *yamlFile)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	assert.DeepEqual(t, *keyValue, expectedKeyValue)
+}
+
+func TestReadKeyInvalidKey(t *testing.T) {
+	yamlFile, err := writeSimpleYamlInTempFile()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer os.Remove(*yamlFile)
+
+	_, err = ReadKey(invalidKey, *yamlFile)
 
 	expectedErrorMessage := fmt.Sprintf(
-		`key %s doesn't start with '.'`,
+		"key %s doesn't start with '.'",
 		invalidKey,
 	)
 
 	assert.Error(t, err, expectedErrorMessage)
 }
 
-func TestInplaceApplyInexistentFile(t *testing.T) {
+func TestReadKeyInexistentFile(t *testing.T) {
 	yamlFile, err := writeSimpleYamlInTempFile()
 
 	incorrectYamlFile := *yamlFile + "ts"
@@ -108,112 +127,82 @@ func TestInplaceApplyInexistentFile(t *testing.T) {
 
 	defer os.Remove(*yamlFile)
 
-	value := "Saga"
-	err = InplaceApply(validKey, value, incorrectYamlFile)
+	_, err = ReadKey(validKey, incorrectYamlFile)
 
 	expectedErrorMessage := fmt.Sprintf(
-		"stat %s: no such file or directory",
+		"open %s: no such file or directory",
 		incorrectYamlFile,
 	)
 
 	assert.Error(t, err, expectedErrorMessage)
 }
 
-func TestInplaceApply(t *testing.T) {
-	yamlFile, err := writeSimpleYamlInTempFile()
+func TestReadKeyIncorrectFile(t *testing.T) {
+	simpleTmpFile, err := writeSimpleTempFile()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer os.Remove(*yamlFile)
-
-	key := ".student-name"
-	value := "Saga"
+	defer os.Remove(*simpleTmpFile)
 
-	err = InplaceApply(key, value, *yamlFile)
-	if err != nil {
-		log.Fatal(err)
-	}
+	_, err = ReadKey(validKey, *simpleTmpFile)
 
-	keyValueAfterInPlaceApply, err := ReadKey(key, *yamlFile)
-	if err != nil {
-		log.Fatal(err)
-	}
+	expectedErrorMessage := fmt.Sprintf(
+		"returned non singular result for yq expression: '%s'",
+		validKey,
+	)
 
-	assert.DeepEqual(t, value, *keyValueAfterInPlaceApply)
+	assert.Error(t, err, expectedErrorMessage)
 }
 
-func TestReadKey(t *testing.T) {
-	yamlFile, err := writeSimpleYamlInTempFile()
+func TestApply(t *testing.T) {
+	yamlData, err := createSimpleYaml()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer os.Remove(*yamlFile)
-
-	expectedKeyValue := "Sagar"
-
-	keyValue, err := ReadKey(validKey, *yamlFile)
+	value := "Saga"
 
+	content, err := Apply(validKey, value, yamlData)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	assert.DeepEqual(t, *keyValue, expectedKeyValue)
-}
-
-func TestReadKeyInvalidKey(t *testing.T) {
-	yamlFile, err := writeSimpleYamlInTempFile()
-
+	keyValueAfterApply, err := ReadKeyFromBytes(validKey, content)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer os.Remove(*yamlFile)
-
-	_, err = ReadKey(invalidKey, *yamlFile)
-
-	expectedErrorMessage := fmt.Sprintf(
-		"key %s doesn't start with '.'",
-		invalidKey,
-	)
-
-	assert.Error(t, err, expectedErrorMessage)
+	assert.DeepEqual(t, value, *keyValueAfterApply)
 }
 
-func TestReadKeyInexistentFile(t *testing.T) {
-	yamlFile, err := writeSimpleYamlInTempFile()
-
-	incorrectYamlFile := *yamlFile + "ts"
+func TestApplyKeepsComments(t *testing.T) {
+	content := []byte("# leading comment\n---\nimage:\n  # tag of the image\n  tag: 1.0.0 # inline comment\n  repository: example\n")
 
+	appliedContent, err := Apply(".image.tag", "1.1.0", content)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer os.Remove(*yamlFile)
+	expectedContent := "# leading comment\n---\nimage:\n  # tag of the image\n  tag: 1.1.0 # inline comment\n  repository: example\n"
+	assert.Equal(t, string(appliedContent), expectedContent)
+}
 
-	_, err = ReadKey(validKey, incorrectYamlFile)
+func TestApplyInvalidKey(t *testing.T) {
+	_, err := Apply(invalidKey, "Saga", []byte(contentSimpleFile))
 
 	expectedErrorMessage := fmt.Sprintf(
-		"open %s: no such file or directory",
-		incorrectYamlFile,
+		`key %s doesn't start with '.'`,
+		invalidKey,
 	)
 
 	assert.Error(t, err, expectedErrorMessage)
 }
 
-func TestReadKeyIncorrectFile(t *testing.T) {
-	simpleTmpFile, err := writeSimpleTempFile()
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer os.Remove(*simpleTmpFile)
-
-	_, err = ReadKey(validKey, *simpleTmpFile)
+func TestReadKeyFromBytesIncorrectContent(t *testing.T) {
+	_, err := ReadKeyFromBytes(validKey, []byte(contentSimpleFile))
 
 	expectedErrorMessage := fmt.Sprintf(
 		"returned non singular result for yq expression: '%s'",
@@ -287,3 +276,30 @@ func writeSimpleTempFile() (*string, error) {
 	}
 	return &tmpFileName, nil
 }
+
+func TestApplyValueNotEvaluated(t *testing.T) {
+	// the value is set as is, without being evaluated as part of the yq expression
+	value := `1.0" | .image.tag = load("/etc/hostname") | .x = "\`
+	content, err := Apply(".image.tag", value, []byte("image:\n  tag: 1.0.0\n"))
+	assert.NilError(t, err)
+	var values map[string]map[string]string
+	assert.NilError(t, yaml.Unmarshal(content, &values))
+	assert.DeepEqual(t, values, map[string]map[string]string{"image": {"tag": value}})
+}
+
+func TestApplyEmptyContent(t *testing.T) {
+	content, err := Apply(".image.tag", "1.1.0", []byte("# values of the app\n"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), "# values of the app\nimage:\n  tag: 1.1.0\n")
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{".image.tag", ".student-name", ".containers[0].image", ".a_b.c1[10][2]"} {
+		assert.NilError(t, ValidateKey(key), key)
+	}
+	for _, key := range []string{`.x = load("/path/secret") | .image.tag`, ".image.tag | .x", ".image..tag", ".image.", ".[0]", `.image."tag"`, ".image.*"} {
+		assert.ErrorContains(t, ValidateKey(key), "must be a path of keys and indexes", key)
+	}
+	_, err := Apply(".x = 1 | .image.tag", "1.1.0", []byte("image:\n  tag: 1.0.0\n"))
+	assert.ErrorContains(t, err, "must be a path of keys and indexes")
+}